@@ -0,0 +1,79 @@
+package captcha
+
+import (
+	"errors"
+	"strings"
+)
+
+// DefaultAlnumCharset excludes chars easily confused with each other, like 0/O, 1/I
+const DefaultAlnumCharset = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// CaptchaAlnum renders random alphanumeric chars, verification ignores case.
+type CaptchaAlnum struct {
+	Length  int
+	Charset []rune
+	Store   Store
+	Limits  Limits
+	render  *textRender
+}
+
+func NewCaptchaAlnum(cfg Config) (c *CaptchaAlnum, err error) {
+	if cfg.Length <= 0 {
+		err = errors.New("invalid captcha length")
+		return
+	}
+	if cfg.Charset == "" {
+		cfg.Charset = DefaultAlnumCharset
+	}
+	c = &CaptchaAlnum{
+		Length:  cfg.Length,
+		Charset: []rune(cfg.Charset),
+		Store:   defaultStore(cfg),
+		Limits:  defaultLimits(cfg),
+	}
+	if c.render, err = newTextRender(cfg, c.Charset); err != nil {
+		c = nil
+	}
+	return
+}
+
+func (c *CaptchaAlnum) Generate(kind MediaKind) (id string, data []byte, err error) {
+	if kind != MediaImage {
+		err = ErrorCaptchaMedia
+		return
+	}
+	rng := newRand()
+	text := make([]rune, c.Length)
+	for i := range text {
+		text[i] = c.Charset[rng.Intn(len(c.Charset))]
+	}
+	if data, err = c.render.render(text); err != nil {
+		return
+	}
+	id = randomId()
+	c.Store.Set(id, []byte(string(text)))
+	return
+}
+
+func (c *CaptchaAlnum) NewCaptcha(params ...interface{}) (id string, data []byte) {
+	// ext string
+	return newCaptchaByExt(c, params...)
+}
+
+func (c *CaptchaAlnum) GenerateFor(client string, kind MediaKind) (id string, data []byte, err error) {
+	if err = issue(c.Store, c.Limits, client); err != nil {
+		return
+	}
+	return c.Generate(kind)
+}
+
+func (c *CaptchaAlnum) Verify(id, answer string) VerifyResult {
+	return verifyAnswer(c.Store, c.Limits, id, answer, func(real []byte, answer string) bool {
+		answer = strings.TrimSpace(answer)
+		return answer != "" && strings.EqualFold(string(real), answer)
+	})
+}
+
+func (c *CaptchaAlnum) VerifyCaptcha(id, answer string) bool {
+	return c.Verify(id, answer).OK()
+}
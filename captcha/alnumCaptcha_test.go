@@ -0,0 +1,72 @@
+package captcha
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestAlnumCaptcha(t *testing.T) {
+	ct, err := New("alnum", Config{
+		Length:     6,
+		Width:      240,
+		Height:     80,
+		Distortion: 5,
+		NoiseLines: 8,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := ct.(*CaptchaAlnum)
+
+	id, data := c.NewCaptcha(".png")
+	if _, err = png.Decode(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	answer := string(c.Store.Get(id, false))
+	if len(answer) != 6 || strings.Trim(answer, DefaultAlnumCharset) != "" {
+		t.Fatal("answer error", answer)
+	}
+	if !c.VerifyCaptcha(id, strings.ToLower(answer)) {
+		t.Fatal("verify failed")
+	}
+	if c.VerifyCaptcha(id, answer) {
+		t.Fatal("verified twice")
+	}
+
+	if id, _ = c.NewCaptcha(".wav"); id != "" {
+		t.Fatal("audio is unsupported")
+	}
+}
+
+func TestAlnumCaptchaOptions(t *testing.T) {
+	c, err := NewCaptchaAlnum(Config{
+		Length:     4,
+		Width:      120,
+		Height:     40,
+		Distortion: -1,
+		NoiseLines: -1,
+		Charset:    "AB",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.render.distortion != 0 || c.render.noiseLines != 0 {
+		t.Fatal("distortion and noise need disabled")
+	}
+	id, _, err := c.Generate(MediaImage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer := string(c.Store.Get(id, false)); strings.Trim(answer, "AB") != "" {
+		t.Fatal("answer out of charset", answer)
+	}
+
+	if _, err = NewCaptchaAlnum(Config{Length: 4, Width: 120, Height: 40, Charset: "ab"}); err == nil {
+		t.Fatal("need lost glyph error")
+	}
+	if _, err = NewCaptchaAlnum(Config{Width: 120, Height: 40}); err == nil {
+		t.Fatal("need length error")
+	}
+}
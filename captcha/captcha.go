@@ -1,17 +1,136 @@
 package captcha
 
 import (
+	"crypto/rand"
+	"errors"
 	"fmt"
+	dchestCaptcha "github.com/dchest/captcha"
+	"image"
 	"strings"
+	"time"
 )
 
 type Captcha interface {
-	InitCaptcha(params ...interface{}) (instance Captcha, err error)
+	Generate(kind MediaKind) (id string, data []byte, err error)
+	// GenerateFor is Generate limited by client key (ip, session id...), see Limits
+	GenerateFor(client string, kind MediaKind) (id string, data []byte, err error)
+	Verify(id, answer string) VerifyResult
+	VerifyCaptcha(id, answer string) bool
+
+	// NewCaptcha is the variadic version of Generate, params[0] is the file
+	// extension (".png", ".wav"). Kept for compatibility.
 	NewCaptcha(params ...interface{}) (id string, data []byte)
-	VerifyCaptcha(id, digits string) bool
 }
 
+// Store keeps the answer of captcha, compatible with dchest/captcha.Store
+type Store interface {
+	// Set sets the answer for the captcha id.
+	Set(id string, answer []byte)
+	// Get returns stored answer for the captcha id. Clear indicates
+	// whether the captcha must be deleted from the store.
+	Get(id string, clear bool) (answer []byte)
+}
+
+type MediaKind int
+
+const (
+	MediaImage MediaKind = iota //.png
+	MediaAudio                  //.wav
+)
+
+func (k MediaKind) String() string {
+	switch k {
+	case MediaImage:
+		return "image"
+	case MediaAudio:
+		return "audio"
+	}
+	return fmt.Sprintf("MediaKind(%d)", int(k))
+}
+
+// Ext returns the file extension of media kind
+func (k MediaKind) Ext() string {
+	switch k {
+	case MediaImage:
+		return ".png"
+	case MediaAudio:
+		return ".wav"
+	}
+	return ""
+}
+
+// ParseMediaKind converts file extension(".png", ".wav") to MediaKind
+func ParseMediaKind(ext string) (k MediaKind, err error) {
+	switch strings.TrimPrefix(strings.ToLower(ext), ".") {
+	case "png":
+		k = MediaImage
+	case "wav":
+		k = MediaAudio
+	default:
+		err = fmt.Errorf("unsupported media ext %s", ext)
+	}
+	return
+}
+
+var (
+	ErrorCaptchaMedia  = errors.New("unsupported media kind")
+	ErrorCaptchaParams = errors.New("params error")
+)
+
+type Config struct {
+	Length     int
+	Width      int
+	Height     int
+	Lang       string        //en,ru,zh,ja; audio only
+	Expiration time.Duration //used by default memory store
+	Store      Store         //nil: memory store
+	Limits     Limits
+
+	//text based captchas: math, alnum
+	Distortion float64 //wave amplitude in pixels; 0: default, negative: none
+	NoiseLines int     //0: default, negative: none
+	Fonts      []Font  //nil: DefaultFont; a random font is picked for each char
+	Charset    string  //alnum only; "": DefaultAlnumCharset
+
+	//slider only
+	Backgrounds []image.Image //see LoadBackgrounds
+	PieceSize   int           //0: Height/4
+	Tolerance   int           //pixels of x offset; 0: default
+	Trajectory  bool          //check drag trajectory
+}
+
+// New creates a captcha instance by type
+func New(captchaType string, cfg Config) (ct Captcha, err error) {
+	switch strings.ToLower(captchaType) {
+	case "dchest":
+		ct, err = NewCaptchaDchest(cfg)
+	case "math":
+		ct, err = NewCaptchaMath(cfg)
+	case "alnum":
+		ct, err = NewCaptchaAlnum(cfg)
+	case "slider":
+		ct, err = NewCaptchaSlider(cfg)
+	default:
+		err = fmt.Errorf("unsupported captcha type %s", captchaType)
+	}
+	return
+}
+
+// Using creates a captcha instance by type. params is a Config, or the
+// positional params of CaptchaDchest.InitCaptcha for compatibility.
 func Using(captchaType string, params ...interface{}) (ct Captcha, err error) {
+	if len(params) == 1 {
+		switch cfg := params[0].(type) {
+		case Config:
+			return New(captchaType, cfg)
+		case *Config:
+			if cfg == nil {
+				err = ErrorCaptchaParams
+				return
+			}
+			return New(captchaType, *cfg)
+		}
+	}
 	switch strings.ToLower(captchaType) {
 	case "dchest":
 		c := &CaptchaDchest{}
@@ -21,3 +140,60 @@ func Using(captchaType string, params ...interface{}) (ct Captcha, err error) {
 	}
 	return
 }
+
+// defaultStore returns the store of config, or a new memory store
+func defaultStore(cfg Config) Store {
+	if cfg.Store != nil {
+		return cfg.Store
+	}
+	if cfg.Expiration <= 0 {
+		cfg.Expiration = dchestCaptcha.Expiration
+	}
+	return dchestCaptcha.NewMemoryStore(dchestCaptcha.CollectNum, cfg.Expiration)
+}
+
+// newCaptchaByExt implements Captcha.NewCaptcha by Captcha.Generate
+func newCaptchaByExt(c Captcha, params ...interface{}) (id string, data []byte) {
+	if len(params) == 0 {
+		return
+	}
+	ext, ok := params[0].(string)
+	if !ok {
+		return
+	}
+	kind, err := ParseMediaKind(ext)
+	if err != nil {
+		return
+	}
+	id, data, _ = c.Generate(kind)
+	return
+}
+
+const idLen = 20
+
+var idChars = []byte("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789")
+
+// randomId returns a new random captcha id, same format as dchest/captcha
+func randomId() string {
+	var (
+		b   = make([]byte, idLen)
+		buf = make([]byte, idLen+idLen/4)
+		max = byte(256 - 256%len(idChars))
+		i   int
+	)
+	for i < idLen {
+		if _, err := rand.Read(buf); err != nil {
+			panic("captcha: error reading random source: " + err.Error())
+		}
+		for _, c := range buf {
+			if c >= max {
+				continue
+			}
+			b[i] = idChars[int(c)%len(idChars)]
+			if i++; i == idLen {
+				break
+			}
+		}
+	}
+	return string(b)
+}
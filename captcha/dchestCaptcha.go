@@ -5,59 +5,162 @@ import (
 	"errors"
 	dchestCaptcha "github.com/dchest/captcha"
 	"github.com/go-redis/redis"
-	"strings"
 	"time"
 )
 
+// CaptchaDchest renders digit captchas by dchest/captcha. Each instance keeps
+// its own store, length and expiration, nothing is shared through the global
+// state of dchest/captcha.
 type CaptchaDchest struct {
-	Length int
-	Width  int
-	Height int
-	Lang   string
-	Store  dchestCaptcha.Store
+	Length     int
+	Width      int
+	Height     int
+	Lang       string
+	Expiration time.Duration //used by default memory store
+	Store      Store
+	Limits     Limits
 }
 
+func NewCaptchaDchest(cfg Config) (c *CaptchaDchest, err error) {
+	if cfg.Length <= 0 {
+		err = errors.New("invalid captcha length")
+		return
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		err = errors.New("invalid captcha size")
+		return
+	}
+	c = &CaptchaDchest{
+		Length:     cfg.Length,
+		Width:      cfg.Width,
+		Height:     cfg.Height,
+		Lang:       cfg.Lang,
+		Expiration: cfg.Expiration,
+		Store:      defaultStore(cfg),
+		Limits:     defaultLimits(cfg),
+	}
+	if c.Lang == "" {
+		c.Lang = "en"
+	}
+	if c.Expiration <= 0 {
+		c.Expiration = dchestCaptcha.Expiration
+	}
+	return
+}
+
+// InitCaptcha initializes by positional params, using NewCaptchaDchest instead.
 func (c *CaptchaDchest) InitCaptcha(params ...interface{}) (instance Captcha, err error) {
 	// length int
 	// width int
 	// height int
 	// lang string	 //en,ru,zh,ja
-	// store dchestCaptcha.Store
+	// store Store
+	// expiration time.Duration	//optional
 
-	if params == nil || len(params) != 5 {
-		err = errors.New("params error")
+	if len(params) != 5 && len(params) != 6 {
+		err = ErrorCaptchaParams
 		return
 	}
 
-	c.Length = params[0].(int)
-	c.Width = params[1].(int)
-	c.Height = params[2].(int)
-	c.Lang = params[3].(string)
-	c.Store = params[4].(dchestCaptcha.Store)
+	var (
+		cfg Config
+		ok  bool
+	)
+	if cfg.Length, ok = params[0].(int); !ok {
+		err = errors.New("params error: length need int")
+		return
+	}
+	if cfg.Width, ok = params[1].(int); !ok {
+		err = errors.New("params error: width need int")
+		return
+	}
+	if cfg.Height, ok = params[2].(int); !ok {
+		err = errors.New("params error: height need int")
+		return
+	}
+	if cfg.Lang, ok = params[3].(string); !ok {
+		err = errors.New("params error: lang need string")
+		return
+	}
+	if cfg.Store, ok = params[4].(Store); !ok && params[4] != nil {
+		err = errors.New("params error: store need captcha.Store")
+		return
+	}
+	if len(params) == 6 {
+		if cfg.Expiration, ok = params[5].(time.Duration); !ok {
+			err = errors.New("params error: expiration need time.Duration")
+			return
+		}
+	}
 
-	dchestCaptcha.SetCustomStore(c.Store)
+	n, err := NewCaptchaDchest(cfg)
+	if err != nil {
+		return
+	}
+	*c = *n
 	instance = c
 	return
 }
 
-func (c *CaptchaDchest) NewCaptcha(params ...interface{}) (id string, data []byte) {
-	// ext string
-	ext := params[0].(string)
+func (c *CaptchaDchest) Generate(kind MediaKind) (id string, data []byte, err error) {
+	if kind != MediaImage && kind != MediaAudio {
+		err = ErrorCaptchaMedia
+		return
+	}
+	id = randomId()
+	digits := dchestCaptcha.RandomDigits(c.Length)
+	c.Store.Set(id, digits)
 
-	id = dchestCaptcha.NewLen(c.Length)
 	buf := bytes.NewBuffer(nil)
-	switch strings.ToLower(ext) {
-	case ".png":
-		dchestCaptcha.WriteImage(buf, id, c.Width, c.Height)
-	case ".wav":
-		dchestCaptcha.WriteAudio(buf, id, c.Lang)
+	switch kind {
+	case MediaImage:
+		_, err = dchestCaptcha.NewImage(id, digits, c.Width, c.Height).WriteTo(buf)
+	case MediaAudio:
+		_, err = dchestCaptcha.NewAudio(id, digits, c.Lang).WriteTo(buf)
+	}
+	if err != nil {
+		id = ""
+		return
 	}
 	data = buf.Bytes()
 	return
 }
 
+func (c *CaptchaDchest) NewCaptcha(params ...interface{}) (id string, data []byte) {
+	// ext string
+	return newCaptchaByExt(c, params...)
+}
+
+func (c *CaptchaDchest) GenerateFor(client string, kind MediaKind) (id string, data []byte, err error) {
+	if err = issue(c.Store, c.Limits, client); err != nil {
+		return
+	}
+	return c.Generate(kind)
+}
+
+func (c *CaptchaDchest) Verify(id, digits string) VerifyResult {
+	return verifyAnswer(c.Store, c.Limits, id, digits, func(real []byte, digits string) bool {
+		if digits == "" {
+			return false
+		}
+		ns := make([]byte, 0, len(digits))
+		for i := 0; i < len(digits); i++ {
+			d := digits[i]
+			switch {
+			case '0' <= d && d <= '9':
+				ns = append(ns, d-'0')
+			case d == ' ' || d == ',':
+				// ignore
+			default:
+				return false
+			}
+		}
+		return bytes.Equal(ns, real)
+	})
+}
+
 func (c *CaptchaDchest) VerifyCaptcha(id, digits string) bool {
-	return dchestCaptcha.VerifyString(id, digits)
+	return c.Verify(id, digits).OK()
 }
 
 type CaptchaDchestStore struct {
@@ -91,3 +194,19 @@ func (cs *CaptchaDchestStore) Get(id string, clear bool) (digits []byte) {
 	//log.Println("captcha get:", id, digits, clear)
 	return
 }
+
+// Incr counts limits in the same redis, so CaptchaDchest shares attempts and issuance with other processes
+func (cs *CaptchaDchestStore) Incr(key string, ttl time.Duration) (n int64, err error) {
+	if cs.RedisCli == nil {
+		err = errors.New("lost redis client")
+		return
+	}
+	return (&RedisLimitStore{RedisCli: cs.RedisCli}).Incr(key, ttl)
+}
+
+func (cs *CaptchaDchestStore) Del(key string) error {
+	if cs.RedisCli == nil {
+		return nil
+	}
+	return (&RedisLimitStore{RedisCli: cs.RedisCli}).Del(key)
+}
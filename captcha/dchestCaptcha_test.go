@@ -6,6 +6,7 @@ import (
 	"github.com/go-redis/redis"
 	"io/ioutil"
 	"os"
+	"sync"
 	"testing"
 	"time"
 )
@@ -65,3 +66,119 @@ func initRedisCache() (cli *redis.Client, err error) {
 	}
 	return
 }
+
+func TestDchestCaptchaInstances(t *testing.T) {
+	a, err := (&CaptchaDchest{}).InitCaptcha(4, 240, 80, "en", nil, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := (&CaptchaDchest{}).InitCaptcha(6, 240, 80, "en", nil, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sa, sb := a.(*CaptchaDchest).Store, b.(*CaptchaDchest).Store
+	if sa == sb {
+		t.Fatal("instances share one store")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			idA, data := a.NewCaptcha(".png")
+			if len(data) == 0 {
+				t.Error("empty image")
+				return
+			}
+			idB, _ := b.NewCaptcha(".wav")
+
+			da, db := sa.Get(idA, false), sb.Get(idB, false)
+			if len(da) != 4 || len(db) != 6 {
+				t.Errorf("length mismatch: %d %d", len(da), len(db))
+				return
+			}
+			if sb.Get(idA, false) != nil || sa.Get(idB, false) != nil {
+				t.Error("captcha leaked into another instance")
+				return
+			}
+			if b.VerifyCaptcha(idA, digitsString(da)) {
+				t.Error("verified by another instance")
+			}
+			if !a.VerifyCaptcha(idA, digitsString(da)) {
+				t.Error("verify failed")
+			}
+			if a.VerifyCaptcha(idA, digitsString(da)) {
+				t.Error("verified twice")
+			}
+			if !b.VerifyCaptcha(idB, digitsString(db)) {
+				t.Error("verify failed")
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func digitsString(d []byte) string {
+	s := make([]byte, len(d))
+	for i := range d {
+		s[i] = d[i] + '0'
+	}
+	return string(s)
+}
+
+func TestDchestCaptchaConfig(t *testing.T) {
+	ct, err := New("dchest", Config{Length: 5, Width: 240, Height: 80})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, data, err := ct.Generate(MediaAudio)
+	if err != nil || id == "" || len(data) == 0 {
+		t.Fatal("generate audio failed", err)
+	}
+	if _, _, err = ct.Generate(MediaKind(9)); err != ErrorCaptchaMedia {
+		t.Fatal("unexpected error", err)
+	}
+
+	if _, err = Using("dchest", &Config{Length: 5, Width: 240, Height: 80}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = New("dchest", Config{Width: 240, Height: 80}); err == nil {
+		t.Fatal("need length error")
+	}
+	if _, err = New("unknown", Config{Length: 5, Width: 240, Height: 80}); err == nil {
+		t.Fatal("need type error")
+	}
+
+	//legacy params, wrong order or missing value returns error
+	if _, err = Using("dchest", 5, 240, 80, "en"); err == nil {
+		t.Fatal("need params error")
+	}
+	if _, err = Using("dchest", "en", 5, 240, 80, nil); err == nil {
+		t.Fatal("need params error")
+	}
+	if _, err = Using("dchest", 5, 240, 80, "en", "store"); err == nil {
+		t.Fatal("need params error")
+	}
+	if ct, err = Using("dchest", 5, 240, 80, "en", nil); err != nil {
+		t.Fatal(err)
+	}
+	if id, _ = ct.NewCaptcha(); id != "" {
+		t.Fatal("need empty id without ext")
+	}
+	if id, _ = ct.NewCaptcha(123); id != "" {
+		t.Fatal("need empty id with invalid ext")
+	}
+	if id, data = ct.NewCaptcha(".PNG"); id == "" || len(data) == 0 {
+		t.Fatal("new captcha failed")
+	}
+
+	for ext, kind := range map[string]MediaKind{".png": MediaImage, "wav": MediaAudio} {
+		if k, err := ParseMediaKind(ext); err != nil || k != kind {
+			t.Fatal("parse media kind failed", ext, err)
+		}
+	}
+	if _, err = ParseMediaKind(".gif"); err == nil {
+		t.Fatal("need media error")
+	}
+}
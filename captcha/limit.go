@@ -0,0 +1,236 @@
+package captcha
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis"
+	"sync"
+	"time"
+)
+
+var ErrorCaptchaTooMany = errors.New("too many captchas requested")
+
+// Limits of verification attempts and issuance
+type Limits struct {
+	MaxAttempts int           //per captcha id; 0: 1, the captcha is removed after first verification
+	MaxIssue    int           //per client key in IssueWindow; 0: unlimited
+	IssueWindow time.Duration //0: 1 hour
+	// Store counts attempts and issuance, nil: the captcha store if it implements LimitStore
+	// (CaptchaDchestStore), or memory store in process
+	Store LimitStore
+}
+
+// LimitStore counts by atomic increment. A captcha store could implement it to keep limits with captchas,
+// counters expire by their own ttl, so IssueWindow is not cut by the captcha expiration
+type LimitStore interface {
+	// Incr increases counter of key by 1 and returns the new value, the counter expires ttl after it is created
+	Incr(key string, ttl time.Duration) (n int64, err error)
+	Del(key string) error
+}
+
+// MemoryLimitStore is a LimitStore in process
+type MemoryLimitStore struct {
+	mu       sync.Mutex
+	counters map[string]*limitCounter
+	collect  time.Time
+}
+
+type limitCounter struct {
+	n      int64
+	expire time.Time
+}
+
+func NewMemoryLimitStore() *MemoryLimitStore {
+	return &MemoryLimitStore{counters: make(map[string]*limitCounter)}
+}
+
+func (s *MemoryLimitStore) Incr(key string, ttl time.Duration) (n int64, err error) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.After(s.collect) {
+		for k, c := range s.counters {
+			if now.After(c.expire) {
+				delete(s.counters, k)
+			}
+		}
+		s.collect = now.Add(time.Minute)
+	}
+	c, has := s.counters[key]
+	if !has || now.After(c.expire) {
+		c = &limitCounter{expire: now.Add(ttl)}
+		s.counters[key] = c
+	}
+	c.n++
+	return c.n, nil
+}
+
+func (s *MemoryLimitStore) Del(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.counters, key)
+	return nil
+}
+
+// incrScript sets ttl when the counter is created, INCR and PEXPIRE are atomic in script
+var incrScript = redis.NewScript(`
+local n = redis.call("INCR", KEYS[1])
+if n == 1 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return n`)
+
+// RedisLimitStore is a LimitStore shared by processes using the same redis
+type RedisLimitStore struct {
+	RedisCli *redis.Client
+	Prefix   string //key prefix, "": "captcha:limit:"
+}
+
+func (s *RedisLimitStore) key(key string) string {
+	if s.Prefix == "" {
+		return "captcha:limit:" + key
+	}
+	return s.Prefix + key
+}
+
+func (s *RedisLimitStore) Incr(key string, ttl time.Duration) (n int64, err error) {
+	ms := ttl.Nanoseconds() / int64(time.Millisecond)
+	if ms <= 0 {
+		ms = 1
+	}
+	return incrScript.Run(s.RedisCli, []string{s.key(key)}, ms).Int64()
+}
+
+func (s *RedisLimitStore) Del(key string) error {
+	return s.RedisCli.Del(s.key(key)).Err()
+}
+
+// defaultLimits returns limits of config, counted by the captcha store or a new memory store if store is nil
+func defaultLimits(cfg Config) Limits {
+	l := cfg.Limits
+	if l.Store == nil {
+		if ls, ok := cfg.Store.(LimitStore); ok {
+			l.Store = ls
+		} else {
+			l.Store = NewMemoryLimitStore()
+		}
+	}
+	return l
+}
+
+// processLimitStore is used by Limits without store, e.g. assigned after creating captcha
+var processLimitStore = NewMemoryLimitStore()
+
+func (l Limits) store(s Store) LimitStore {
+	if l.Store != nil {
+		return l.Store
+	}
+	if ls, ok := s.(LimitStore); ok {
+		return ls
+	}
+	return processLimitStore
+}
+
+type VerifyStatus int
+
+const (
+	VerifyOK VerifyStatus = iota
+	VerifyWrong
+	VerifyExpired //also unknown id
+	VerifyTooManyAttempts
+)
+
+func (s VerifyStatus) String() string {
+	switch s {
+	case VerifyOK:
+		return "ok"
+	case VerifyWrong:
+		return "wrong"
+	case VerifyExpired:
+		return "expired"
+	case VerifyTooManyAttempts:
+		return "too many attempts"
+	}
+	return fmt.Sprintf("VerifyStatus(%d)", int(s))
+}
+
+type VerifyResult struct {
+	Status    VerifyStatus
+	Remaining int //attempts remaining for VerifyWrong
+}
+
+func (r VerifyResult) OK() bool {
+	return r.Status == VerifyOK
+}
+
+const (
+	attemptsKeyPrefix = "attempts:"
+	issueKeyPrefix    = "issue:"
+	// attemptsTTL is longer than expiration of captchas, attempts are counted until the captcha is removed
+	attemptsTTL = 24 * time.Hour
+)
+
+// verifyAnswer checks answer by match, attempts are counted before checking,
+// so concurrent guesses from processes sharing the LimitStore can't exceed MaxAttempts
+func verifyAnswer(s Store, l Limits, id, answer string, match func(real []byte, answer string) bool) (r VerifyResult) {
+	r.Status = VerifyExpired
+	if id == "" {
+		return
+	}
+	max := int64(l.MaxAttempts)
+	if max <= 0 {
+		max = 1
+	}
+
+	real := s.Get(id, false)
+	if real == nil {
+		return
+	}
+	key := attemptsKeyPrefix + id
+	attempts, err := l.store(s).Incr(key, attemptsTTL)
+	if err != nil {
+		//can't count, the captcha is kept
+		return
+	}
+	if attempts > max {
+		s.Get(id, true)
+		l.store(s).Del(key)
+		r.Status = VerifyTooManyAttempts
+		return
+	}
+	if match(real, answer) {
+		s.Get(id, true)
+		l.store(s).Del(key)
+		r.Status = VerifyOK
+		return
+	}
+	if attempts >= max {
+		s.Get(id, true)
+		l.store(s).Del(key)
+	}
+	r.Status, r.Remaining = VerifyWrong, int(max-attempts)
+	return
+}
+
+// issue counts captchas requested by client in a fixed window, client is ip, session id and so on
+func issue(s Store, l Limits, client string) (err error) {
+	if l.MaxIssue <= 0 {
+		return
+	}
+	if client == "" {
+		err = errors.New("lost client key")
+		return
+	}
+	window := l.IssueWindow
+	if window <= 0 {
+		window = time.Hour
+	}
+	count, err := l.store(s).Incr(issueKeyPrefix+client, window)
+	if err != nil {
+		return
+	}
+	if count > int64(l.MaxIssue) {
+		err = ErrorCaptchaTooMany
+	}
+	return
+}
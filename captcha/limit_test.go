@@ -0,0 +1,212 @@
+package captcha
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCaptchaAttempts(t *testing.T) {
+	c, err := NewCaptchaMath(Config{
+		Width:  240,
+		Height: 80,
+		Limits: Limits{MaxAttempts: 3},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, _, err := c.Generate(MediaImage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	answer := string(c.Store.Get(id, false))
+	wrong := answer + "0"
+	for i := 2; i >= 1; i-- {
+		if r := c.Verify(id, wrong); r.Status != VerifyWrong || r.Remaining != i {
+			t.Fatalf("unexpected result %s, remaining %d", r.Status, r.Remaining)
+		}
+		if n := c.Limits.Store.(*MemoryLimitStore).counters[attemptsKeyPrefix+id].n; n != int64(3-i) {
+			t.Fatal("attempts not counted in limit store", n)
+		}
+	}
+	if r := c.Verify(id, answer); r.Status != VerifyOK {
+		t.Fatal("unexpected result", r.Status)
+	}
+	if _, has := c.Limits.Store.(*MemoryLimitStore).counters[attemptsKeyPrefix+id]; has {
+		t.Fatal("attempts not cleared")
+	}
+	if r := c.Verify(id, answer); r.Status != VerifyExpired {
+		t.Fatal("unexpected result", r.Status)
+	}
+
+	//exhaust attempts
+	id, _, _ = c.Generate(MediaImage)
+	answer = string(c.Store.Get(id, false))
+	for i := 0; i < 3; i++ {
+		if r := c.Verify(id, answer+"0"); r.Status != VerifyWrong {
+			t.Fatal("unexpected result", r.Status)
+		}
+	}
+	if r := c.Verify(id, answer); r.Status != VerifyExpired {
+		t.Fatal("unexpected result", r.Status)
+	}
+
+	//limit lowered after attempts were stored
+	id, _, _ = c.Generate(MediaImage)
+	c.Verify(id, "x")
+	c.Limits.MaxAttempts = 1
+	if r := c.Verify(id, string(c.Store.Get(id, false))); r.Status != VerifyTooManyAttempts {
+		t.Fatal("unexpected result", r.Status)
+	}
+
+	//default: one attempt
+	c.Limits.MaxAttempts = 0
+	id, _, _ = c.Generate(MediaImage)
+	answer = string(c.Store.Get(id, false))
+	if r := c.Verify(id, "x"); r.Status != VerifyWrong || r.Remaining != 0 {
+		t.Fatal("unexpected result", r.Status)
+	}
+	if c.VerifyCaptcha(id, answer) {
+		t.Fatal("verified after the only attempt")
+	}
+}
+
+func TestCaptchaIssueLimit(t *testing.T) {
+	ct, err := New("dchest", Config{
+		Length: 4,
+		Width:  240,
+		Height: 80,
+		Limits: Limits{MaxIssue: 2, IssueWindow: 100 * time.Millisecond},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, _, err = ct.GenerateFor("127.0.0.1", MediaImage); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, _, err = ct.GenerateFor("127.0.0.1", MediaImage); err != ErrorCaptchaTooMany {
+		t.Fatal("need too many error", err)
+	}
+	if _, _, err = ct.GenerateFor("127.0.0.2", MediaImage); err != nil {
+		t.Fatal("other client limited", err)
+	}
+	if _, _, err = ct.GenerateFor("", MediaImage); err == nil {
+		t.Fatal("need client key error")
+	}
+	time.Sleep(150 * time.Millisecond)
+	if _, _, err = ct.GenerateFor("127.0.0.1", MediaImage); err != nil {
+		t.Fatal("window not reset", err)
+	}
+}
+
+// TestCaptchaIssueWindow checks IssueWindow longer than expiration of captcha store
+func TestCaptchaIssueWindow(t *testing.T) {
+	c, err := NewCaptchaMath(Config{
+		Width:      240,
+		Height:     80,
+		Expiration: 50 * time.Millisecond,
+		Limits:     Limits{MaxIssue: 1, IssueWindow: time.Hour},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = c.GenerateFor("127.0.0.1", MediaImage); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if _, _, err = c.GenerateFor("127.0.0.1", MediaImage); err != ErrorCaptchaTooMany {
+		t.Fatal("window cut by captcha expiration", err)
+	}
+}
+
+func TestCaptchaConcurrentAttempts(t *testing.T) {
+	c, err := NewCaptchaMath(Config{
+		Width:  240,
+		Height: 80,
+		Limits: Limits{MaxAttempts: 3},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _, _ := c.Generate(MediaImage)
+	answer := string(c.Store.Get(id, false))
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		checked int
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if r := c.Verify(id, answer+"0"); r.Status == VerifyWrong {
+				mu.Lock()
+				checked++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if checked != 3 {
+		t.Fatal("answers checked", checked)
+	}
+}
+
+func TestMemoryLimitStore(t *testing.T) {
+	s := NewMemoryLimitStore()
+	for i := int64(1); i <= 2; i++ {
+		if n, _ := s.Incr("k", 50*time.Millisecond); n != i {
+			t.Fatal(n)
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n, _ := s.Incr("k", time.Hour); n != 1 {
+		t.Fatal("counter not expired", n)
+	}
+	s.Del("k")
+	if n, _ := s.Incr("k", time.Hour); n != 1 {
+		t.Fatal("counter not deleted", n)
+	}
+}
+
+// sharedStore is a captcha store counting limits, like CaptchaDchestStore of redis shared by processes
+type sharedStore struct {
+	Store
+	*MemoryLimitStore
+}
+
+func TestCaptchaLimitsInStore(t *testing.T) {
+	redisStore := &CaptchaDchestStore{}
+	if c, _ := NewCaptchaDchest(Config{Length: 4, Width: 240, Height: 80, Store: redisStore}); c.Limits.Store != redisStore {
+		t.Fatal("limits should be counted by the redis captcha store")
+	}
+
+	store := &sharedStore{Store: defaultStore(Config{}), MemoryLimitStore: NewMemoryLimitStore()}
+	cfg := Config{Width: 240, Height: 80, Store: store, Limits: Limits{MaxAttempts: 2, MaxIssue: 1}}
+	a, _ := NewCaptchaMath(cfg)
+	b, _ := NewCaptchaMath(cfg)
+	if _, _, err := a.GenerateFor("127.0.0.1", MediaImage); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := b.GenerateFor("127.0.0.1", MediaImage); err != ErrorCaptchaTooMany {
+		t.Fatal("issuance not shared", err)
+	}
+
+	id, _, _ := a.Generate(MediaImage)
+	answer := string(store.Get(id, false))
+	a.Verify(id, answer+"0")
+	if r := b.Verify(id, answer+"0"); r.Status != VerifyWrong || r.Remaining != 0 {
+		t.Fatal("attempts not shared", r)
+	}
+
+	//limits assigned after creating captcha
+	a.Limits = Limits{MaxAttempts: 2}
+	id, _, _ = a.Generate(MediaImage)
+	a.Verify(id, "x")
+	if n, _ := store.Incr(attemptsKeyPrefix+id, time.Hour); n != 2 {
+		t.Fatal("attempts not counted by the captcha store", n)
+	}
+}
@@ -0,0 +1,79 @@
+package captcha
+
+import (
+	"strconv"
+	"strings"
+)
+
+// CaptchaMath renders a simple arithmetic expression like "7+12=?", the
+// answer is the result of the expression.
+type CaptchaMath struct {
+	Store  Store
+	Limits Limits
+	render *textRender
+}
+
+func NewCaptchaMath(cfg Config) (c *CaptchaMath, err error) {
+	c = &CaptchaMath{Store: defaultStore(cfg), Limits: defaultLimits(cfg)}
+	if c.render, err = newTextRender(cfg, []rune("0123456789+-×=?")); err != nil {
+		c = nil
+	}
+	return
+}
+
+func (c *CaptchaMath) Generate(kind MediaKind) (id string, data []byte, err error) {
+	if kind != MediaImage {
+		err = ErrorCaptchaMedia
+		return
+	}
+	expr, answer := c.expression()
+	if data, err = c.render.render([]rune(expr)); err != nil {
+		return
+	}
+	id = randomId()
+	c.Store.Set(id, []byte(strconv.Itoa(answer)))
+	return
+}
+
+func (c *CaptchaMath) NewCaptcha(params ...interface{}) (id string, data []byte) {
+	// ext string
+	return newCaptchaByExt(c, params...)
+}
+
+func (c *CaptchaMath) GenerateFor(client string, kind MediaKind) (id string, data []byte, err error) {
+	if err = issue(c.Store, c.Limits, client); err != nil {
+		return
+	}
+	return c.Generate(kind)
+}
+
+func (c *CaptchaMath) Verify(id, answer string) VerifyResult {
+	return verifyAnswer(c.Store, c.Limits, id, answer, func(real []byte, answer string) bool {
+		return string(real) == strings.TrimSpace(answer)
+	})
+}
+
+func (c *CaptchaMath) VerifyCaptcha(id, answer string) bool {
+	return c.Verify(id, answer).OK()
+}
+
+// expression returns a random expression and its result, the result is never negative
+func (c *CaptchaMath) expression() (expr string, answer int) {
+	rng := newRand()
+	var a, b int
+	var op string
+	switch rng.Intn(3) {
+	case 0:
+		a, b, op = 1+rng.Intn(20), 1+rng.Intn(20), "+"
+		answer = a + b
+	case 1:
+		a = 2 + rng.Intn(19)
+		b, op = 1+rng.Intn(a), "-"
+		answer = a - b
+	default:
+		a, b, op = 1+rng.Intn(9), 1+rng.Intn(9), "×"
+		answer = a * b
+	}
+	expr = strconv.Itoa(a) + op + strconv.Itoa(b) + "=?"
+	return
+}
@@ -0,0 +1,96 @@
+package captcha
+
+import (
+	"bytes"
+	"image/png"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestMathCaptcha(t *testing.T) {
+	ct, err := Using("math", Config{Width: 240, Height: 80})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := ct.(*CaptchaMath)
+
+	id, data, err := c.Generate(MediaImage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 240 || b.Dy() != 80 {
+		t.Fatal("image size error", b)
+	}
+	answer := string(c.Store.Get(id, false))
+	if c.VerifyCaptcha(id, answer+"1") {
+		t.Fatal("wrong answer passed")
+	}
+	if id, _, err = c.Generate(MediaImage); err != nil {
+		t.Fatal(err)
+	}
+	answer = string(c.Store.Get(id, false))
+	if !c.VerifyCaptcha(id, " "+answer+" ") {
+		t.Fatal("verify failed")
+	}
+	if c.VerifyCaptcha(id, answer) {
+		t.Fatal("verified twice")
+	}
+
+	if _, _, err = c.Generate(MediaAudio); err != ErrorCaptchaMedia {
+		t.Fatal("need media error", err)
+	}
+}
+
+func TestMathCaptchaExpression(t *testing.T) {
+	c := &CaptchaMath{}
+	for i := 0; i < 1000; i++ {
+		expr, answer := c.expression()
+		if !strings.HasSuffix(expr, "=?") {
+			t.Fatal("invalid expression", expr)
+		}
+		expr = strings.TrimSuffix(expr, "=?")
+		var result int
+		for _, op := range []string{"+", "-", "×"} {
+			tmp := strings.Split(expr, op)
+			if len(tmp) != 2 {
+				continue
+			}
+			a, _ := strconv.Atoi(tmp[0])
+			b, _ := strconv.Atoi(tmp[1])
+			switch op {
+			case "+":
+				result = a + b
+			case "-":
+				result = a - b
+			case "×":
+				result = a * b
+			}
+		}
+		if result != answer || answer < 0 {
+			t.Fatal("answer error", expr, answer)
+		}
+	}
+}
+
+func TestMathCaptchaFonts(t *testing.T) {
+	f := Font{}
+	for k, v := range DefaultFont {
+		f[k] = v
+	}
+	delete(f, '×')
+	if _, err := NewCaptchaMath(Config{Width: 240, Height: 80, Fonts: []Font{f}}); err == nil {
+		t.Fatal("need lost glyph error")
+	}
+	f['×'] = []string{"#"}
+	if _, err := NewCaptchaMath(Config{Width: 240, Height: 80, Fonts: []Font{f}}); err == nil {
+		t.Fatal("need glyph size error")
+	}
+	if _, err := NewCaptchaMath(Config{Width: 0, Height: 80}); err == nil {
+		t.Fatal("need size error")
+	}
+}
@@ -0,0 +1,185 @@
+package captcha
+
+import (
+	"bytes"
+	crand "crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"math/rand"
+)
+
+const (
+	defaultDistortion = 3.0
+	defaultNoiseLines = 4
+)
+
+// textRender draws text into PNG image, shared by text based captchas
+type textRender struct {
+	width      int
+	height     int
+	distortion float64
+	noiseLines int
+	fonts      []Font
+}
+
+func newTextRender(cfg Config, charset []rune) (r *textRender, err error) {
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		err = fmt.Errorf("invalid captcha size")
+		return
+	}
+	r = &textRender{
+		width:      cfg.Width,
+		height:     cfg.Height,
+		distortion: cfg.Distortion,
+		noiseLines: cfg.NoiseLines,
+		fonts:      cfg.Fonts,
+	}
+	if r.distortion == 0 {
+		r.distortion = defaultDistortion
+	} else if r.distortion < 0 {
+		r.distortion = 0
+	}
+	if r.noiseLines == 0 {
+		r.noiseLines = defaultNoiseLines
+	} else if r.noiseLines < 0 {
+		r.noiseLines = 0
+	}
+	if len(r.fonts) == 0 {
+		r.fonts = []Font{DefaultFont}
+	}
+	for i, f := range r.fonts {
+		if _, _, err = f.size(); err != nil {
+			err = fmt.Errorf("font %d: %v", i, err)
+			return
+		}
+		for _, c := range charset {
+			if _, has := f[c]; !has {
+				err = fmt.Errorf("font %d: lost glyph %q", i, c)
+				return
+			}
+		}
+	}
+	return
+}
+
+// newRand returns a math/rand seeded by crypto/rand, not shared between goroutines
+func newRand() *rand.Rand {
+	var seed [8]byte
+	if _, err := crand.Read(seed[:]); err != nil {
+		panic("captcha: error reading random source: " + err.Error())
+	}
+	return rand.New(rand.NewSource(int64(binary.LittleEndian.Uint64(seed[:]))))
+}
+
+func (r *textRender) render(text []rune) (data []byte, err error) {
+	if len(text) == 0 {
+		err = fmt.Errorf("empty text")
+		return
+	}
+	var (
+		rng    = newRand()
+		img    = image.NewRGBA(image.Rect(0, 0, r.width, r.height))
+		margin = r.width / 10
+		cellW  = float64(r.width-2*margin) / float64(len(text))
+	)
+	bg := color.RGBA{uint8(225 + rng.Intn(31)), uint8(225 + rng.Intn(31)), uint8(225 + rng.Intn(31)), 0xff}
+	draw.Draw(img, img.Bounds(), &image.Uniform{C: bg}, image.Point{}, draw.Src)
+
+	for i, c := range text {
+		f := r.fonts[rng.Intn(len(r.fonts))]
+		glyph := f[c]
+		if glyph == nil {
+			err = fmt.Errorf("lost glyph %q", c)
+			return
+		}
+		gw, gh := len(glyph[0]), len(glyph)
+		scale := math.Min(cellW/float64(gw+1), float64(r.height)*0.7/float64(gh))
+		if scale < 1 {
+			scale = 1
+		}
+		var (
+			x0    = float64(margin) + float64(i)*cellW + (cellW-scale*float64(gw))/2 + (rng.Float64()-0.5)*scale
+			y0    = (float64(r.height)-scale*float64(gh))/2 + (rng.Float64()-0.5)*scale*2
+			shear = rng.Float64()*0.6 - 0.3
+			ink   = r.randomInk(rng)
+		)
+		for gy, row := range glyph {
+			for gx := 0; gx < len(row); gx++ {
+				if row[gx] != '#' {
+					continue
+				}
+				x := x0 + (float64(gx)+shear*float64(gh-gy))*scale
+				y := y0 + float64(gy)*scale
+				fillRect(img, int(x), int(y), int(x+scale+0.5), int(y+scale+0.5), ink)
+			}
+		}
+	}
+
+	for i := 0; i < r.noiseLines; i++ {
+		y1, y2 := rng.Intn(r.height), rng.Intn(r.height)
+		drawLine(img, 0, y1, r.width-1, y2, 1+rng.Intn(2), r.randomInk(rng))
+	}
+	for i := r.width * r.height / 40; i > 0; i-- {
+		img.Set(rng.Intn(r.width), rng.Intn(r.height), r.randomInk(rng))
+	}
+
+	var out image.Image = img
+	if r.distortion > 0 {
+		out = distort(img, r.distortion, float64(r.height)/(1+rng.Float64()), rng.Float64()*2*math.Pi, bg)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if err = png.Encode(buf, out); err != nil {
+		return
+	}
+	data = buf.Bytes()
+	return
+}
+
+func (r *textRender) randomInk(rng *rand.Rand) color.RGBA {
+	return color.RGBA{uint8(rng.Intn(130)), uint8(rng.Intn(130)), uint8(rng.Intn(130)), 0xff}
+}
+
+func fillRect(img *image.RGBA, x1, y1, x2, y2 int, c color.Color) {
+	draw.Draw(img, image.Rect(x1, y1, x2, y2).Intersect(img.Bounds()), &image.Uniform{C: c}, image.Point{}, draw.Src)
+}
+
+// drawLine draws a line from left to right by DDA
+func drawLine(img *image.RGBA, x1, y1, x2, y2, thick int, c color.Color) {
+	if x2 < x1 {
+		x1, y1, x2, y2 = x2, y2, x1, y1
+	}
+	k := 0.0
+	if x2 != x1 {
+		k = float64(y2-y1) / float64(x2-x1)
+	}
+	for x := x1; x <= x2; x++ {
+		y := y1 + int(k*float64(x-x1))
+		for t := 0; t < thick; t++ {
+			img.Set(x, y+t, c)
+		}
+	}
+}
+
+// distort warps the image by sine waves on both axes
+func distort(src *image.RGBA, amplitude, period, phase float64, bg color.RGBA) *image.RGBA {
+	b := src.Bounds()
+	dst := image.NewRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			sx := x + int(amplitude*math.Sin(2*math.Pi*float64(y)/period+phase))
+			sy := y + int(amplitude*math.Cos(2*math.Pi*float64(x)/period+phase))
+			if image.Pt(sx, sy).In(b) {
+				dst.SetRGBA(x, y, src.RGBAAt(sx, sy))
+			} else {
+				dst.SetRGBA(x, y, bg)
+			}
+		}
+	}
+	return dst
+}
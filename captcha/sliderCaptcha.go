@@ -0,0 +1,335 @@
+package captcha
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	MinSliderTrackPoints = 5
+	MinSliderDragTime    = 200 * time.Millisecond
+	MaxSliderDragTime    = 30 * time.Second
+	//coefficient of variation of drag speed, a bot usually drags at constant speed
+	MinSliderSpeedVariation = 0.1
+)
+
+const defaultSliderTolerance = 5
+
+// CaptchaSlider cuts a jigsaw piece out of a background image, the user drags
+// the piece horizontally into the hole.
+type CaptchaSlider struct {
+	Width       int
+	Height      int
+	PieceSize   int
+	Tolerance   int  //pixels
+	Trajectory  bool //check drag trajectory
+	Backgrounds []image.Image
+	Store       Store
+	Limits      Limits
+}
+
+// SliderPuzzle is the challenge sent to client
+type SliderPuzzle struct {
+	Id         string `json:"id"`
+	Background []byte `json:"background"` //png, with the hole
+	Piece      []byte `json:"piece"`      //png, place it at (0, Y) of background
+	Y          int    `json:"y"`
+}
+
+// SliderAnswer is submitted by client
+type SliderAnswer struct {
+	X     int          `json:"x"`
+	Track []TrackPoint `json:"track,omitempty"`
+}
+
+// TrackPoint is a point of the drag trajectory
+type TrackPoint struct {
+	X int   `json:"x"`
+	Y int   `json:"y"`
+	T int64 `json:"t"` //milliseconds
+}
+
+func NewCaptchaSlider(cfg Config) (c *CaptchaSlider, err error) {
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		err = errors.New("invalid captcha size")
+		return
+	}
+	if len(cfg.Backgrounds) == 0 {
+		err = errors.New("lost slider backgrounds")
+		return
+	}
+	c = &CaptchaSlider{
+		Width:       cfg.Width,
+		Height:      cfg.Height,
+		PieceSize:   cfg.PieceSize,
+		Tolerance:   cfg.Tolerance,
+		Trajectory:  cfg.Trajectory,
+		Backgrounds: cfg.Backgrounds,
+		Store:       defaultStore(cfg),
+		Limits:      defaultLimits(cfg),
+	}
+	if c.PieceSize <= 0 {
+		c.PieceSize = c.Height / 4
+	}
+	if c.Tolerance <= 0 {
+		c.Tolerance = defaultSliderTolerance
+	}
+	if r := c.PieceSize / 5; 2*(c.PieceSize+2*r) > c.Width || c.PieceSize+2*r > c.Height {
+		err = fmt.Errorf("piece size %d is too large", c.PieceSize)
+		c = nil
+	}
+	return
+}
+
+// LoadBackgrounds decodes all png and jpeg images in dir
+func LoadBackgrounds(dir string) (imgs []image.Image, err error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, f := range files {
+		ext := strings.ToLower(filepath.Ext(f.Name()))
+		if f.IsDir() || (ext != ".png" && ext != ".jpg" && ext != ".jpeg") {
+			continue
+		}
+		var (
+			fp  *os.File
+			img image.Image
+		)
+		if fp, err = os.Open(filepath.Join(dir, f.Name())); err != nil {
+			return
+		}
+		img, _, err = image.Decode(fp)
+		fp.Close()
+		if err != nil {
+			err = fmt.Errorf("decode %s: %v", f.Name(), err)
+			return
+		}
+		imgs = append(imgs, img)
+	}
+	if len(imgs) == 0 {
+		err = fmt.Errorf("no image in %s", dir)
+	}
+	return
+}
+
+// NewPuzzle creates a slider challenge
+func (c *CaptchaSlider) NewPuzzle() (p *SliderPuzzle, err error) {
+	var (
+		rng   = newRand()
+		bg    = scaleImage(c.Backgrounds[rng.Intn(len(c.Backgrounds))], c.Width, c.Height)
+		mask  = newPieceMask(c.PieceSize)
+		size  = mask.Bounds().Dx()
+		x     = size + rng.Intn(c.Width-2*size+1)
+		y     = rng.Intn(c.Height - size + 1)
+		piece = image.NewRGBA(image.Rect(0, 0, size, size))
+	)
+	for py := 0; py < size; py++ {
+		for px := 0; px < size; px++ {
+			a := mask.AlphaAt(px, py).A
+			if a == 0 {
+				continue
+			}
+			src := bg.RGBAAt(x+px, y+py)
+			if a == edgeAlpha {
+				piece.SetRGBA(px, py, color.RGBA{0xff, 0xff, 0xff, 0xff})
+				bg.SetRGBA(x+px, y+py, color.RGBA{0xff, 0xff, 0xff, 0xff})
+				continue
+			}
+			piece.SetRGBA(px, py, src)
+			bg.SetRGBA(x+px, y+py, color.RGBA{src.R / 3, src.G / 3, src.B / 3, 0xff})
+		}
+	}
+
+	p = &SliderPuzzle{Y: y}
+	buf := bytes.NewBuffer(nil)
+	if err = png.Encode(buf, bg); err != nil {
+		return
+	}
+	p.Background = buf.Bytes()
+	buf = bytes.NewBuffer(nil)
+	if err = png.Encode(buf, piece); err != nil {
+		return
+	}
+	p.Piece = buf.Bytes()
+	p.Id = randomId()
+	c.Store.Set(p.Id, []byte(strconv.Itoa(x)))
+	return
+}
+
+// Generate returns SliderPuzzle encoded in json as data
+func (c *CaptchaSlider) Generate(kind MediaKind) (id string, data []byte, err error) {
+	if kind != MediaImage {
+		err = ErrorCaptchaMedia
+		return
+	}
+	p, err := c.NewPuzzle()
+	if err != nil {
+		return
+	}
+	if data, err = json.Marshal(p); err != nil {
+		return
+	}
+	id = p.Id
+	return
+}
+
+func (c *CaptchaSlider) NewCaptcha(params ...interface{}) (id string, data []byte) {
+	// ext string
+	return newCaptchaByExt(c, params...)
+}
+
+func (c *CaptchaSlider) GenerateFor(client string, kind MediaKind) (id string, data []byte, err error) {
+	if err = issue(c.Store, c.Limits, client); err != nil {
+		return
+	}
+	return c.Generate(kind)
+}
+
+// Verify accepts x offset in decimal, or SliderAnswer in json
+func (c *CaptchaSlider) Verify(id, answer string) VerifyResult {
+	answer = strings.TrimSpace(answer)
+	var (
+		ans SliderAnswer
+		err error
+	)
+	if strings.HasPrefix(answer, "{") {
+		err = json.Unmarshal([]byte(answer), &ans)
+	} else {
+		ans.X, err = strconv.Atoi(answer)
+	}
+	if err != nil {
+		return verifyAnswer(c.Store, c.Limits, id, answer, func([]byte, string) bool { return false })
+	}
+	return c.VerifySlider(id, ans)
+}
+
+func (c *CaptchaSlider) VerifyCaptcha(id, answer string) bool {
+	return c.Verify(id, answer).OK()
+}
+
+// VerifySlider checks x offset within tolerance, and the trajectory if enabled
+func (c *CaptchaSlider) VerifySlider(id string, ans SliderAnswer) VerifyResult {
+	return verifyAnswer(c.Store, c.Limits, id, "", func(real []byte, _ string) bool {
+		x, err := strconv.Atoi(string(real))
+		if err != nil || abs(ans.X-x) > c.Tolerance {
+			return false
+		}
+		return !c.Trajectory || isHumanTrack(ans.Track, ans.X, c.Tolerance)
+	})
+}
+
+// isHumanTrack checks points count, drag time, end point and speed variation
+func isHumanTrack(track []TrackPoint, x, tolerance int) bool {
+	if len(track) < MinSliderTrackPoints {
+		return false
+	}
+	d := time.Duration(track[len(track)-1].T-track[0].T) * time.Millisecond
+	if d < MinSliderDragTime || d > MaxSliderDragTime {
+		return false
+	}
+	if abs(track[len(track)-1].X-x) > tolerance {
+		return false
+	}
+	var speeds []float64
+	for i := 1; i < len(track); i++ {
+		dt := track[i].T - track[i-1].T
+		if dt < 0 {
+			return false
+		}
+		if dt == 0 {
+			continue
+		}
+		speeds = append(speeds, float64(track[i].X-track[i-1].X)/float64(dt))
+	}
+	if len(speeds) < 2 {
+		return false
+	}
+	var sum, sq float64
+	for _, v := range speeds {
+		sum += v
+	}
+	mean := sum / float64(len(speeds))
+	if mean == 0 {
+		return false
+	}
+	for _, v := range speeds {
+		sq += (v - mean) * (v - mean)
+	}
+	return math.Sqrt(sq/float64(len(speeds)))/math.Abs(mean) >= MinSliderSpeedVariation
+}
+
+const edgeAlpha = 0x80
+
+// newPieceMask returns jigsaw shape: a square with knobs on top and right and
+// an indent on left. Edge pixels have edgeAlpha, inner pixels are opaque.
+func newPieceMask(pieceSize int) *image.Alpha {
+	var (
+		r    = pieceSize / 5
+		size = pieceSize + 2*r
+		m    = image.NewAlpha(image.Rect(0, 0, size, size))
+		rf   = float64(r)
+		s    = float64(pieceSize)
+	)
+	in := func(x, y int) bool {
+		if x < 0 || y < 0 || x >= size || y >= size {
+			return false
+		}
+		fx, fy := float64(x)+0.5, float64(y)+0.5
+		inCircle := func(cx, cy float64) bool {
+			return (fx-cx)*(fx-cx)+(fy-cy)*(fy-cy) <= rf*rf
+		}
+		body := fx >= rf && fx < rf+s && fy >= rf && fy < rf+s && !inCircle(rf, rf+s/2)
+		return body || inCircle(rf+s/2, rf) || inCircle(rf+s, rf+s/2)
+	}
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			if !in(x, y) {
+				continue
+			}
+			if in(x-1, y) && in(x+1, y) && in(x, y-1) && in(x, y+1) {
+				m.SetAlpha(x, y, color.Alpha{A: 0xff})
+			} else {
+				m.SetAlpha(x, y, color.Alpha{A: edgeAlpha})
+			}
+		}
+	}
+	return m
+}
+
+// scaleImage resizes by nearest neighbor into a new RGBA
+func scaleImage(src image.Image, w, h int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	b := src.Bounds()
+	if b.Dx() == w && b.Dy() == h {
+		draw.Draw(dst, dst.Bounds(), src, b.Min, draw.Src)
+		return dst
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			dst.Set(x, y, src.At(b.Min.X+x*b.Dx()/w, b.Min.Y+y*b.Dy()/h))
+		}
+	}
+	return dst
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,185 @@
+package captcha
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func testBackground(w, h int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 0xc0, 0xff})
+		}
+	}
+	return img
+}
+
+func TestSliderCaptcha(t *testing.T) {
+	ct, err := Using("slider", Config{
+		Width:       300,
+		Height:      150,
+		Backgrounds: []image.Image{testBackground(600, 300)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := ct.(*CaptchaSlider)
+
+	p, err := c.NewPuzzle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bg, err := png.Decode(bytes.NewReader(p.Background))
+	if err != nil {
+		t.Fatal(err)
+	}
+	piece, err := png.Decode(bytes.NewReader(p.Piece))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := bg.Bounds(); b.Dx() != 300 || b.Dy() != 150 {
+		t.Fatal("background size error", b)
+	}
+	size := piece.Bounds().Dx()
+	if size != c.PieceSize+2*(c.PieceSize/5) || p.Y < 0 || p.Y+size > 150 {
+		t.Fatal("piece error", size, p.Y)
+	}
+
+	//the hole is darker than the piece
+	x, _ := strconv.Atoi(string(c.Store.Get(p.Id, false)))
+	cx, cy := size/2, size/2
+	pr, _, _, _ := piece.At(cx, cy).RGBA()
+	hr, _, _, _ := bg.At(x+cx, p.Y+cy).RGBA()
+	if hr >= pr {
+		t.Fatal("hole not found at answer", x)
+	}
+
+	if !c.VerifyCaptcha(p.Id, strconv.Itoa(x+c.Tolerance)) {
+		t.Fatal("verify failed within tolerance")
+	}
+	if c.VerifyCaptcha(p.Id, strconv.Itoa(x)) {
+		t.Fatal("verified twice")
+	}
+
+	id, _, err := c.Generate(MediaImage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x, _ = strconv.Atoi(string(c.Store.Get(id, false)))
+	if c.VerifyCaptcha(id, strconv.Itoa(x+c.Tolerance+1)) {
+		t.Fatal("verified out of tolerance")
+	}
+
+	id, data, err := c.Generate(MediaImage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sp SliderPuzzle
+	if err = json.Unmarshal(data, &sp); err != nil || sp.Id != id || len(sp.Piece) == 0 {
+		t.Fatal("puzzle json error", err)
+	}
+
+	if _, err = NewCaptchaSlider(Config{Width: 300, Height: 150}); err == nil {
+		t.Fatal("need backgrounds error")
+	}
+	if _, err = NewCaptchaSlider(Config{Width: 50, Height: 150, Backgrounds: []image.Image{testBackground(1, 1)}}); err == nil {
+		t.Fatal("need piece size error")
+	}
+}
+
+func TestSliderCaptchaTrajectory(t *testing.T) {
+	c, err := NewCaptchaSlider(Config{
+		Width:       300,
+		Height:      150,
+		Trajectory:  true,
+		Backgrounds: []image.Image{testBackground(300, 150)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newAnswer := func() (id string, x int) {
+		p, err := c.NewPuzzle()
+		if err != nil {
+			t.Fatal(err)
+		}
+		x, _ = strconv.Atoi(string(c.Store.Get(p.Id, false)))
+		return p.Id, x
+	}
+
+	//accelerate then decelerate
+	id, x := newAnswer()
+	human := SliderAnswer{X: x}
+	for i, ts := range []int64{0, 80, 140, 190, 240, 300, 380, 500, 700} {
+		progress := []float64{0, 0.05, 0.2, 0.45, 0.7, 0.85, 0.94, 0.98, 1}[i]
+		human.Track = append(human.Track, TrackPoint{X: int(float64(x) * progress), Y: i % 2, T: ts})
+	}
+	d, _ := json.Marshal(human)
+	if !c.VerifyCaptcha(id, string(d)) {
+		t.Fatal("human track rejected")
+	}
+
+	//constant speed
+	id, x = newAnswer()
+	bot := SliderAnswer{X: x}
+	for i := 0; i <= 10; i++ {
+		bot.Track = append(bot.Track, TrackPoint{X: x * i / 10, T: int64(i * 50)})
+	}
+	if c.VerifySlider(id, bot).OK() {
+		t.Fatal("constant speed track accepted")
+	}
+
+	//too fast
+	id, x = newAnswer()
+	fast := SliderAnswer{X: x}
+	for i, p := range human.Track {
+		fast.Track = append(fast.Track, TrackPoint{X: x * i / (len(human.Track) - 1), T: p.T / 10})
+	}
+	if c.VerifySlider(id, fast).OK() {
+		t.Fatal("too fast track accepted")
+	}
+
+	//no track
+	id, x = newAnswer()
+	if c.VerifyCaptcha(id, strconv.Itoa(x)) {
+		t.Fatal("answer without track accepted")
+	}
+}
+
+func TestLoadBackgrounds(t *testing.T) {
+	dir, err := ioutil.TempDir("", "captcha")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err = LoadBackgrounds(dir); err == nil {
+		t.Fatal("need empty dir error")
+	}
+	buf := bytes.NewBuffer(nil)
+	if err = png.Encode(buf, testBackground(30, 20)); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, "a.png"), buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, "readme.txt"), []byte("skip"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	imgs, err := LoadBackgrounds(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(imgs) != 1 || imgs[0].Bounds().Dx() != 30 {
+		t.Fatal("load backgrounds error", len(imgs))
+	}
+}
@@ -0,0 +1,29 @@
+package email
+
+// disposableDomains is a bundled list of well-known disposable mail services,
+// subdomains are matched too, e.g. "x.mailinator.com"
+var disposableDomains = []string{
+	"0-mail.com", "10minutemail.com", "10minutemail.net", "10minutemail.co.uk", "20minutemail.com",
+	"33mail.com", "anonbox.net", "anonymbox.com", "armyspy.com", "binkmail.com",
+	"bobmail.info", "burnermail.io", "chacuo.net", "cuvox.de", "dayrep.com",
+	"deadaddress.com", "discard.email", "discardmail.com", "dispostable.com", "dodgit.com",
+	"drdrb.com", "dropmail.me", "einrot.com", "emailondeck.com", "fakeinbox.com",
+	"fakemail.net", "fleckens.hu", "getairmail.com", "getnada.com", "gishpuppy.com",
+	"guerrillamail.biz", "guerrillamail.com", "guerrillamail.de", "guerrillamail.info", "guerrillamail.net",
+	"guerrillamail.org", "guerrillamailblock.com", "gustr.com", "harakirimail.com", "incognitomail.org",
+	"inboxbear.com", "jetable.org", "jourrapide.com", "kasmail.com", "mailcatch.com",
+	"maildrop.cc", "mailexpire.com", "mailforspam.com", "mailinator.com", "mailinator.net",
+	"mailinator2.com", "mailmetrash.com", "mailnesia.com", "mailnull.com", "mailsac.com",
+	"mailtemp.info", "meltmail.com", "mintemail.com", "moakt.com", "mohmal.com",
+	"mt2015.com", "mytemp.email", "mytrashmail.com", "nada.email", "no-spam.ws",
+	"nowmymail.com", "objectmail.com", "proxymail.eu", "rcpt.at", "rhyta.com",
+	"sharklasers.com", "shieldemail.com", "slopsbox.com", "spam4.me", "spamavert.com",
+	"spambog.com", "spambox.us", "spamfree24.org", "spamgourmet.com", "spamherelots.com",
+	"spaml.com", "superrito.com", "teleworm.us", "temp-mail.io", "temp-mail.org",
+	"tempail.com", "tempinbox.com", "tempmail.com", "tempmail.net", "tempmailaddress.com",
+	"tempmailo.com", "tempr.email", "tempsky.com", "throwam.com", "throwawaymail.com",
+	"tmail.ws", "tmailinator.com", "trash-mail.com", "trashmail.com", "trashmail.de",
+	"trashmail.net", "trbvm.com", "wegwerfmail.de", "wegwerfmail.net", "yopmail.com",
+	"yopmail.fr", "yopmail.net", "zetmail.com", "zippymail.info", "zoemail.org",
+	"027168.com", "bccto.me", "linshiyouxiang.net", "maildu.de", "snapmail.cc",
+}
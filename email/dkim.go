@@ -0,0 +1,263 @@
+package email
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	gcrypto "github.com/IrvinYoung/gutil/crypto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrorDKIMKey = errors.New("unsupported dkim key, need rsa or ed25519 private key")
+
+// DefaultDKIMHeaders are signed if present in message
+var DefaultDKIMHeaders = []string{
+	"From", "Reply-To", "Subject", "Date", "To", "Cc", "Message-ID",
+	"In-Reply-To", "References", "MIME-Version", "Content-Type", "Content-Transfer-Encoding",
+}
+
+// DKIMSigner signs messages by rsa-sha256 or ed25519-sha256 with relaxed/relaxed canonicalization
+type DKIMSigner struct {
+	Domain     string        //d= tag
+	Selector   string        //s= tag, public key is published at selector._domainkey.domain
+	Headers    []string      //signed headers, default DefaultDKIMHeaders, From is always signed
+	Expiration time.Duration //x= tag after signing time, 0 for none
+
+	key  crypto.Signer
+	algo string
+	now  func() time.Time
+}
+
+// LoadDKIMKey loads PKCS1 rsa key, or PKCS8 rsa/ed25519 key from pem
+func LoadDKIMKey(d []byte) (key crypto.Signer, err error) {
+	p, _ := pem.Decode(d)
+	if p == nil {
+		err = errors.New("load private key failed")
+		return
+	}
+	if p.Type == "RSA PRIVATE KEY" {
+		return gcrypto.LoadRSAPrivateKey(d)
+	}
+	k, err := x509.ParsePKCS8PrivateKey(p.Bytes)
+	if err != nil {
+		return
+	}
+	key, ok := k.(crypto.Signer)
+	if !ok {
+		err = ErrorDKIMKey
+	}
+	return
+}
+
+func NewDKIMSigner(domain, selector string, key crypto.Signer) (s *DKIMSigner, err error) {
+	if domain == "" || selector == "" {
+		err = errors.New("lost dkim domain or selector")
+		return
+	}
+	s = &DKIMSigner{Domain: domain, Selector: selector, key: key, now: time.Now}
+	switch key.(type) {
+	case *rsa.PrivateKey:
+		s.algo = "rsa-sha256"
+	case ed25519.PrivateKey:
+		s.algo = "ed25519-sha256"
+	default:
+		return nil, ErrorDKIMKey
+	}
+	return
+}
+
+// DNSRecord returns TXT record which should be published at Selector._domainkey.Domain
+func (s *DKIMSigner) DNSRecord() (string, error) {
+	if k, ok := s.key.Public().(ed25519.PublicKey); ok {
+		return "v=DKIM1; k=ed25519; p=" + base64.StdEncoding.EncodeToString(k), nil
+	}
+	pub, err := x509.MarshalPKIXPublicKey(s.key.Public())
+	if err != nil {
+		return "", err
+	}
+	return "v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(pub), nil
+}
+
+// Sign returns message with DKIM-Signature header prepended, line breaks are converted to CRLF
+func (s *DKIMSigner) Sign(msg []byte) (signed []byte, err error) {
+	msg = toCRLF(msg)
+	header, body := msg, []byte(nil)
+	if i := bytes.Index(msg, []byte("\r\n\r\n")); i >= 0 {
+		header, body = msg[:i+2], msg[i+4:]
+	}
+	fields := splitHeader(header)
+
+	bodyHash := sha256.Sum256(relaxedBody(body))
+	h := sha256.New()
+	var names []string
+	used := make(map[string]int) //name: instances used from bottom
+	headers := s.Headers
+	if len(headers) == 0 {
+		headers = DefaultDKIMHeaders
+	}
+	hasFrom := false
+	for _, name := range headers {
+		if strings.EqualFold(name, "From") {
+			hasFrom = true
+		}
+	}
+	if !hasFrom {
+		headers = append([]string{"From"}, headers...)
+	}
+	for _, name := range headers {
+		key := strings.ToLower(name)
+		//multiple instances are signed from the bottom up
+		for {
+			f := lastField(fields, key, used[key])
+			if f == "" {
+				break
+			}
+			used[key]++
+			names = append(names, name)
+			h.Write([]byte(relaxedHeader(f)))
+		}
+	}
+	if used["from"] == 0 {
+		err = ErrorMailNoFrom
+		return
+	}
+
+	now := s.now()
+	tags := fmt.Sprintf("v=1; a=%s; c=relaxed/relaxed; d=%s; s=%s;\r\n\tt=%d;", s.algo, s.Domain, s.Selector, now.Unix())
+	if s.Expiration > 0 {
+		tags += " x=" + strconv.FormatInt(now.Add(s.Expiration).Unix(), 10) + ";"
+	}
+	tags += "\r\n\th=" + strings.Join(names, ":") + ";\r\n\tbh=" + base64.StdEncoding.EncodeToString(bodyHash[:]) + ";\r\n\tb="
+	sigField := "DKIM-Signature: " + tags
+	//the signature header is hashed without trailing CRLF
+	h.Write([]byte(strings.TrimSuffix(relaxedHeader(sigField), "\r\n")))
+	hashed := h.Sum(nil)
+
+	var sig []byte
+	if s.algo == "ed25519-sha256" {
+		sig, err = s.key.Sign(rand.Reader, hashed, crypto.Hash(0))
+	} else {
+		sig, err = s.key.Sign(rand.Reader, hashed, crypto.SHA256)
+	}
+	if err != nil {
+		return
+	}
+	b := base64.StdEncoding.EncodeToString(sig)
+	var out bytes.Buffer
+	out.WriteString(sigField)
+	for len(b) > 72 {
+		out.WriteString(b[:72] + "\r\n\t")
+		b = b[72:]
+	}
+	out.WriteString(b + "\r\n")
+	out.Write(msg)
+	return out.Bytes(), nil
+}
+
+// signMessage returns bytes of message, signed if dkim is not nil
+func signMessage(m *Message, dkim *DKIMSigner) (data []byte, err error) {
+	if data, err = m.Bytes(); err != nil || dkim == nil {
+		return
+	}
+	return dkim.Sign(data)
+}
+
+func toCRLF(b []byte) []byte {
+	if !bytes.Contains(b, []byte("\n")) {
+		return b
+	}
+	out := make([]byte, 0, len(b)+len(b)/50)
+	for i, c := range b {
+		if c == '\n' && (i == 0 || b[i-1] != '\r') {
+			out = append(out, '\r')
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// splitHeader splits header block into fields with continuation lines and CRLF
+func splitHeader(header []byte) (fields []string) {
+	for _, line := range strings.SplitAfter(string(header), "\r\n") {
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(fields) != 0 {
+			fields[len(fields)-1] += line
+			continue
+		}
+		fields = append(fields, line)
+	}
+	return
+}
+
+// lastField returns the (skip+1)th field named key from the bottom
+func lastField(fields []string, key string, skip int) string {
+	for i := len(fields) - 1; i >= 0; i-- {
+		f := fields[i]
+		if j := strings.IndexByte(f, ':'); j > 0 && strings.ToLower(strings.TrimRight(f[:j], " \t")) == key {
+			if skip == 0 {
+				return f
+			}
+			skip--
+		}
+	}
+	return ""
+}
+
+// relaxedHeader: lowercase name, unfold, compress whitespaces, no whitespaces around colon
+func relaxedHeader(f string) string {
+	i := strings.IndexByte(f, ':')
+	name := strings.ToLower(strings.TrimRight(f[:i], " \t"))
+	value := compressWSP(strings.Replace(f[i+1:], "\r\n", "", -1))
+	return name + ":" + strings.Trim(value, " ") + "\r\n"
+}
+
+// relaxedBody: compress whitespaces, no trailing whitespaces and empty lines
+func relaxedBody(body []byte) []byte {
+	lines := strings.Split(string(body), "\r\n")
+	var b strings.Builder
+	blank := 0
+	for _, l := range lines {
+		if l = strings.TrimRight(compressWSP(l), " "); l == "" {
+			blank++
+			continue
+		}
+		for ; blank > 0; blank-- {
+			b.WriteString("\r\n")
+		}
+		b.WriteString(l + "\r\n")
+	}
+	return []byte(b.String())
+}
+
+// compressWSP replaces runs of space and tab by a space
+func compressWSP(s string) string {
+	var b strings.Builder
+	wsp := false
+	for i := 0; i < len(s); i++ {
+		if s[i] == ' ' || s[i] == '\t' {
+			wsp = true
+			continue
+		}
+		if wsp {
+			b.WriteByte(' ')
+			wsp = false
+		}
+		b.WriteByte(s[i])
+	}
+	if wsp {
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
@@ -0,0 +1,156 @@
+package email
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"github.com/emersion/go-msgauth/dkim"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testDKIMSigners(t *testing.T) map[string]*DKIMSigner {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(edKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signers := make(map[string]*DKIMSigner)
+	for algo, p := range map[string]*pem.Block{
+		"rsa-sha256":     {Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)},
+		"ed25519-sha256": {Type: "PRIVATE KEY", Bytes: pkcs8},
+	} {
+		key, err := LoadDKIMKey(pem.EncodeToMemory(p))
+		if err != nil {
+			t.Fatal(algo, err)
+		}
+		if signers[algo], err = NewDKIMSigner("example.com", "s1", key); err != nil {
+			t.Fatal(algo, err)
+		}
+	}
+	return signers
+}
+
+// verifyDKIM verifies by go-msgauth with public key of signer
+func verifyDKIM(s *DKIMSigner, msg []byte) error {
+	record, err := s.DNSRecord()
+	if err != nil {
+		return err
+	}
+	vs, err := dkim.VerifyWithOptions(bytes.NewReader(msg), &dkim.VerifyOptions{
+		LookupTXT: func(domain string) ([]string, error) {
+			if domain != s.Selector+"._domainkey."+s.Domain {
+				return nil, nil
+			}
+			return []string{record}, nil
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if len(vs) != 1 {
+		return ErrorMailNoBody
+	}
+	return vs[0].Err
+}
+
+func TestDKIMSigner(t *testing.T) {
+	data, err := testAttachments(testMessage()).Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for algo, s := range testDKIMSigners(t) {
+		signed, err := s.Sign(data)
+		if err != nil {
+			t.Fatal(algo, err)
+		}
+		if !bytes.HasPrefix(signed, []byte("DKIM-Signature: v=1; a="+algo+"; c=relaxed/relaxed; d=example.com; s=s1;")) {
+			t.Fatal(algo, string(signed[:200]))
+		}
+		if err = verifyDKIM(s, signed); err != nil {
+			t.Fatal(algo, err)
+		}
+
+		//relaxed canonicalization tolerates whitespaces and folding
+		relaxed := bytes.Replace(signed, []byte("Subject: Hello!"), []byte("subject:  \r\n\tHello!  "), 1)
+		relaxed = bytes.Replace(relaxed, []byte("\r\n--"), []byte("  \r\n\r\n--"), 1)
+		if err = verifyDKIM(s, append(relaxed, "\r\n\r\n"...)); err != nil {
+			t.Fatal(algo, "relaxed", err)
+		}
+		for name, tampered := range map[string][]byte{
+			"header": bytes.Replace(signed, []byte("Subject: Hello!"), []byte("Subject: Hello?"), 1),
+			"body":   bytes.Replace(signed, []byte("Hello Bob"), []byte("Hello Eve"), 1),
+			//verifiers use the bottom instance of signed header
+			"added": bytes.Replace(signed, []byte("\r\n\r\n"), []byte("\r\nTo: eve@example.com\r\n\r\n"), 1),
+		} {
+			if bytes.Equal(tampered, signed) {
+				t.Fatal(algo, name, "not tampered")
+			}
+			if err = verifyDKIM(s, tampered); err == nil {
+				t.Fatal(algo, name, "need verifying error")
+			}
+		}
+	}
+}
+
+func TestDKIMSignerHeaders(t *testing.T) {
+	s := testDKIMSigners(t)["ed25519-sha256"]
+	s.Headers = []string{"Subject", "X-Campaign"}
+	s.Expiration = time.Hour
+	now := time.Now()
+	s.now = func() time.Time { return now }
+	msg := []byte("From: a@example.com\nSubject: hi\nX-Campaign: one\nX-Campaign: two\nX-Other: x\n\nbody  \n\n")
+	signed, err := s.Sign(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := string(signed[:bytes.Index(signed, []byte("\r\nFrom:"))])
+	if !strings.Contains(sig, fmt.Sprintf("t=%d; x=%d;", now.Unix(), now.Unix()+3600)) || !strings.Contains(sig, "h=From:Subject:X-Campaign:X-Campaign;") {
+		t.Fatal(sig)
+	}
+	//X-Other is not signed
+	if err = verifyDKIM(s, bytes.Replace(signed, []byte("X-Other: x"), []byte("X-Other: y"), 1)); err != nil {
+		t.Fatal(err)
+	}
+	if err = verifyDKIM(s, bytes.Replace(signed, []byte("X-Campaign: one"), []byte("X-Campaign: 1"), 1)); err == nil {
+		t.Fatal("need verifying error")
+	}
+	if _, err = s.Sign([]byte("Subject: hi\r\n\r\nbody")); err != ErrorMailNoFrom {
+		t.Fatal("need no from error", err)
+	}
+}
+
+func TestSMTPMailerDKIM(t *testing.T) {
+	f := newFakeSMTP(t, &fakeSMTP{})
+	defer f.ln.Close()
+	s := testDKIMSigners(t)["rsa-sha256"]
+	cfg := f.config(TLSNone)
+	cfg.DKIM = s
+	m, err := Using("smtp", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = m.Send(testMessage()); err != nil {
+		t.Fatal(err)
+	}
+	mails := f.received()
+	if len(mails) != 1 {
+		t.Fatal(mails)
+	}
+	data := bytes.Replace(bytes.Replace(mails[0].Data, []byte("\r\n"), []byte("\n"), -1), []byte("\n"), []byte("\r\n"), -1)
+	if err = verifyDKIM(s, data); err != nil {
+		t.Fatal(err)
+	}
+}
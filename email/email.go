@@ -0,0 +1,75 @@
+package email
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type Mailer interface {
+	InitMailer(Config) (Mailer, error)
+	// Send returns id of message, Message-ID for smtp
+	Send(*Message) (id string, err error)
+	SupportBy() string
+}
+
+var (
+	ErrorMailNoFrom      = errors.New("lost from address")
+	ErrorMailNoRecipient = errors.New("lost recipients")
+	ErrorMailNoBody      = errors.New("lost text or html body")
+)
+
+// TLSMode of smtp connection
+type TLSMode string
+
+const (
+	TLSImplicit TLSMode = "implicit" //smtps, port 465
+	TLSStartTLS TLSMode = "starttls" //required, port 587
+	TLSNone     TLSMode = "none"     //plain text, port 25
+)
+
+// Config of mailer, fields are used by mailers as needed
+type Config struct {
+	Host      string
+	Port      int //0: default port of TLS mode
+	Username  string
+	Password  string
+	TLS       TLSMode //"": implicit for port 465, otherwise starttls
+	TLSConfig *tls.Config
+	LocalName string //name sent by HELO, default localhost
+
+	DialTimeout time.Duration //default 10 seconds
+	Timeout     time.Duration //deadline of sending a message, default 1 minute
+
+	// http api mailers
+	APIKey    string //sendgrid, mailgun: api key; ses: access key id
+	APISecret string //ses: secret access key
+	Domain    string //mailgun: sending domain
+	Region    string //ses: us-east-1; mailgun: eu for eu endpoint
+	Endpoint  string //api address, "": provider default
+
+	// DKIM signs messages sent as raw MIME by smtp, queue and ses, nil for none
+	DKIM *DKIMSigner
+	// Suppression is checked by all mailers, suppressed recipients are skipped, nil for none
+	Suppression SuppressionList
+
+	Options map[string]string //mailer specific options
+}
+
+func Using(MailerType string, cfg Config) (mailer Mailer, err error) {
+	switch strings.ToLower(MailerType) {
+	case "smtp":
+		mailer, err = (&SMTPMailer{}).InitMailer(cfg)
+	case "sendgrid":
+		mailer, err = (&SendGridMailer{}).InitMailer(cfg)
+	case "mailgun":
+		mailer, err = (&MailgunMailer{}).InitMailer(cfg)
+	case "ses":
+		mailer, err = (&SESMailer{}).InitMailer(cfg)
+	default:
+		err = fmt.Errorf("unsupported mailer type %s", MailerType)
+	}
+	return
+}
@@ -0,0 +1,97 @@
+package email
+
+import (
+	"golang.org/x/net/html"
+	"regexp"
+	"strings"
+)
+
+var (
+	textSpaces    = regexp.MustCompile(`[ \t\r\n\f]+`)
+	textBlankRuns = regexp.MustCompile(`\n{3,}`)
+)
+
+// blocks are separated by line break, paragraphs by blank line
+var (
+	htmlBlocks     = map[string]bool{"div": true, "tr": true, "ul": true, "ol": true, "section": true, "header": true, "footer": true, "article": true, "blockquote": true, "center": true}
+	htmlParagraphs = map[string]bool{"p": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "table": true, "pre": true}
+	htmlSkipped    = map[string]bool{"head": true, "title": true, "style": true, "script": true}
+)
+
+// HTMLToText converts html to plain text alternative, links are written as "text (url)"
+func HTMLToText(src string) (string, error) {
+	doc, err := html.Parse(strings.NewReader(src))
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	writeText(&b, doc, false)
+
+	lines := strings.Split(b.String(), "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimSpace(l)
+	}
+	text := textBlankRuns.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return strings.TrimSpace(text), nil
+}
+
+func writeText(b *strings.Builder, n *html.Node, pre bool) {
+	switch n.Type {
+	case html.TextNode:
+		if pre {
+			b.WriteString(n.Data)
+		} else {
+			b.WriteString(textSpaces.ReplaceAllString(n.Data, " "))
+		}
+		return
+	case html.ElementNode:
+	default:
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			writeText(b, c, pre)
+		}
+		return
+	}
+
+	tag := n.Data
+	switch {
+	case htmlSkipped[tag]:
+		return
+	case tag == "br":
+		b.WriteString("\n")
+		return
+	case tag == "hr":
+		b.WriteString("\n----------\n")
+		return
+	case tag == "img":
+		if alt := attr(n, "alt"); alt != "" {
+			b.WriteString(alt)
+		}
+		return
+	case tag == "li":
+		b.WriteString("\n- ")
+	case tag == "td" || tag == "th":
+		b.WriteString(" ")
+	case htmlParagraphs[tag]:
+		b.WriteString("\n\n")
+	case htmlBlocks[tag]:
+		b.WriteString("\n")
+	}
+
+	start := b.Len()
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		writeText(b, c, pre || tag == "pre")
+	}
+
+	switch {
+	case tag == "a":
+		href := attr(n, "href")
+		text := strings.TrimSpace(b.String()[start:])
+		if href != "" && !strings.HasPrefix(href, "#") && strings.TrimPrefix(href, "mailto:") != text {
+			b.WriteString(" (" + href + ")")
+		}
+	case htmlParagraphs[tag]:
+		b.WriteString("\n\n")
+	case htmlBlocks[tag]:
+		b.WriteString("\n")
+	}
+}
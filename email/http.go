@@ -0,0 +1,57 @@
+package email
+
+import (
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"time"
+)
+
+const defaultHTTPTimeout = 30 * time.Second
+
+func newHTTPClient(timeout time.Duration) *http.Client {
+	if timeout <= 0 {
+		timeout = defaultHTTPTimeout
+	}
+	return &http.Client{Timeout: timeout}
+}
+
+// sendHTTP sends request and returns response with body
+func sendHTTP(cli *http.Client, req *http.Request) (resp *http.Response, data []byte, err error) {
+	if resp, err = cli.Do(req); err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	data, err = ioutil.ReadAll(resp.Body)
+	return
+}
+
+// HTTPError is returned when provider responds non 2xx status
+type HTTPError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("http status %d: %s", e.StatusCode, e.Body)
+}
+
+// contentType of attachment, by extension if not set
+func (a *Attachment) contentType() string {
+	if a.ContentType != "" {
+		return a.ContentType
+	}
+	if ct := mime.TypeByExtension(filepath.Ext(a.Filename)); ct != "" {
+		return ct
+	}
+	return "application/octet-stream"
+}
+
+func (a *Attachment) contentId() string {
+	if a.ContentId != "" {
+		return a.ContentId
+	}
+	return a.Filename
+}
@@ -0,0 +1,276 @@
+package email
+
+import (
+	"bytes"
+	"golang.org/x/net/html"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var cssComment = regexp.MustCompile(`(?s)/\*.*?\*/`)
+
+type cssRule struct {
+	selector    []cssCompound //descendant combinator
+	specificity [3]int
+	order       int
+	decls       [][2]string
+}
+
+// cssCompound is a simple selector like "td.cell#id"
+type cssCompound struct {
+	tag     string
+	id      string
+	classes []string
+}
+
+// InlineCSS moves rules of <style> into style attributes of elements,
+// rules with pseudo classes, attribute selectors, combinators except descendant, and at-rules(e.g. @media) are kept in <style>
+func InlineCSS(src string) (string, error) {
+	doc, err := html.Parse(strings.NewReader(src))
+	if err != nil {
+		return "", err
+	}
+	var (
+		styles []*html.Node
+		rules  []cssRule
+	)
+	walkNodes(doc, func(n *html.Node) bool {
+		if n.Type == html.ElementNode && n.Data == "style" {
+			styles = append(styles, n)
+			return false
+		}
+		return true
+	})
+	for _, st := range styles {
+		var css bytes.Buffer
+		for c := st.FirstChild; c != nil; c = c.NextSibling {
+			css.WriteString(c.Data)
+		}
+		var keep string
+		rules, keep = parseCSS(css.String(), rules)
+		if keep = strings.TrimSpace(keep); keep == "" {
+			st.Parent.RemoveChild(st)
+			continue
+		}
+		for st.FirstChild != nil {
+			st.RemoveChild(st.FirstChild)
+		}
+		st.AppendChild(&html.Node{Type: html.TextNode, Data: keep})
+	}
+
+	if len(rules) != 0 {
+		walkNodes(doc, func(n *html.Node) bool {
+			if n.Type == html.ElementNode {
+				applyCSS(n, rules)
+			}
+			return true
+		})
+	}
+	var out bytes.Buffer
+	if err = html.Render(&out, doc); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+func walkNodes(n *html.Node, fn func(*html.Node) bool) {
+	if !fn(n) {
+		return
+	}
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling //c could be removed by fn
+		walkNodes(c, fn)
+		c = next
+	}
+}
+
+// parseCSS appends inlinable rules, and returns css which can't be inlined
+func parseCSS(css string, rules []cssRule) ([]cssRule, string) {
+	css = cssComment.ReplaceAllString(css, "")
+	var keep strings.Builder
+	for {
+		css = strings.TrimSpace(css)
+		if css == "" {
+			break
+		}
+		open := strings.IndexByte(css, '{')
+		if open < 0 {
+			break
+		}
+		//find the end of block, at-rules could have nested blocks
+		depth, end := 0, -1
+		for i := open; i < len(css) && end < 0; i++ {
+			switch css[i] {
+			case '{':
+				depth++
+			case '}':
+				if depth--; depth == 0 {
+					end = i
+				}
+			}
+		}
+		if end < 0 {
+			end = len(css) - 1
+		}
+		prelude, body, block := strings.TrimSpace(css[:open]), css[open+1:end], css[:end+1]
+		css = css[end+1:]
+
+		if strings.HasPrefix(prelude, "@") || strings.ContainsAny(prelude, ":[>+~") {
+			keep.WriteString(block + "\n")
+			continue
+		}
+		var decls [][2]string
+		for _, d := range strings.Split(body, ";") {
+			if i := strings.IndexByte(d, ':'); i > 0 {
+				decls = append(decls, [2]string{strings.ToLower(strings.TrimSpace(d[:i])), strings.TrimSpace(d[i+1:])})
+			}
+		}
+		for _, sel := range strings.Split(prelude, ",") {
+			r := cssRule{decls: decls, order: len(rules)}
+			for _, part := range strings.Fields(sel) {
+				c := parseCompound(part)
+				r.selector = append(r.selector, c)
+				r.specificity[1] += len(c.classes)
+				if c.id != "" {
+					r.specificity[0]++
+				}
+				if c.tag != "" && c.tag != "*" {
+					r.specificity[2]++
+				}
+			}
+			if len(r.selector) != 0 {
+				rules = append(rules, r)
+			}
+		}
+	}
+	return rules, keep.String()
+}
+
+func parseCompound(s string) (c cssCompound) {
+	i := strings.IndexAny(s, ".#")
+	if i < 0 {
+		i = len(s)
+	}
+	c.tag = strings.ToLower(s[:i])
+	for s = s[i:]; s != ""; {
+		kind := s[0]
+		s = s[1:]
+		j := strings.IndexAny(s, ".#")
+		if j < 0 {
+			j = len(s)
+		}
+		if kind == '.' {
+			c.classes = append(c.classes, s[:j])
+		} else {
+			c.id = s[:j]
+		}
+		s = s[j:]
+	}
+	return
+}
+
+func (c *cssCompound) match(n *html.Node) bool {
+	if n.Type != html.ElementNode || (c.tag != "" && c.tag != "*" && c.tag != n.Data) {
+		return false
+	}
+	if c.id != "" && attr(n, "id") != c.id {
+		return false
+	}
+	classes := strings.Fields(attr(n, "class"))
+	for _, want := range c.classes {
+		found := false
+		for _, cl := range classes {
+			if cl == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *cssRule) match(n *html.Node) bool {
+	last := len(r.selector) - 1
+	if !r.selector[last].match(n) {
+		return false
+	}
+	i := last - 1
+	for p := n.Parent; p != nil && i >= 0; p = p.Parent {
+		if r.selector[i].match(p) {
+			i--
+		}
+	}
+	return i < 0
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// applyCSS merges matched rules by specificity, the existing style attribute wins
+func applyCSS(n *html.Node, rules []cssRule) {
+	var matched []*cssRule
+	for i := range rules {
+		if rules[i].match(n) {
+			matched = append(matched, &rules[i])
+		}
+	}
+	if len(matched) == 0 {
+		return
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		a, b := matched[i].specificity, matched[j].specificity
+		for k := range a {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return matched[i].order < matched[j].order
+	})
+
+	var (
+		props  []string
+		values = make(map[string]string)
+	)
+	set := func(k, v string) {
+		if _, has := values[k]; !has {
+			props = append(props, k)
+		}
+		values[k] = v
+	}
+	for _, r := range matched {
+		for _, d := range r.decls {
+			set(d[0], d[1])
+		}
+	}
+	idx := -1
+	for i, a := range n.Attr {
+		if a.Key == "style" {
+			idx = i
+			for _, d := range strings.Split(a.Val, ";") {
+				if k := strings.IndexByte(d, ':'); k > 0 {
+					set(strings.ToLower(strings.TrimSpace(d[:k])), strings.TrimSpace(d[k+1:]))
+				}
+			}
+		}
+	}
+	decls := make([]string, len(props))
+	for i, k := range props {
+		decls[i] = k + ": " + values[k]
+	}
+	style := strings.Join(decls, "; ")
+	if idx >= 0 {
+		n.Attr[idx].Val = style
+	} else {
+		n.Attr = append(n.Attr, html.Attribute{Key: "style", Val: style})
+	}
+}
@@ -0,0 +1,146 @@
+package email
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/mail"
+	"net/textproto"
+	"net/url"
+	"strings"
+)
+
+const (
+	mailgunEndpoint   = "https://api.mailgun.net"
+	mailgunEUEndpoint = "https://api.eu.mailgun.net"
+)
+
+// MailgunMailer APIKey and Domain are required, Region "eu" for eu endpoint
+type MailgunMailer struct {
+	apiKey   string
+	domain   string
+	endpoint string
+	cli      *http.Client
+
+	suppression SuppressionList
+}
+
+func (s *MailgunMailer) InitMailer(cfg Config) (instance Mailer, err error) {
+	if cfg.APIKey == "" || cfg.Domain == "" {
+		err = errors.New("lost api key or domain")
+		return
+	}
+	s.apiKey, s.domain = cfg.APIKey, cfg.Domain
+	if s.endpoint = strings.TrimRight(cfg.Endpoint, "/"); s.endpoint == "" {
+		s.endpoint = mailgunEndpoint
+		if strings.EqualFold(cfg.Region, "eu") {
+			s.endpoint = mailgunEUEndpoint
+		}
+	}
+	s.cli, s.suppression = newHTTPClient(cfg.Timeout), cfg.Suppression
+	instance = s
+	return
+}
+
+// Send returns id of mailgun, which is the Message-ID
+func (s *MailgunMailer) Send(m *Message) (id string, err error) {
+	if err = m.Validate(); err != nil {
+		return
+	}
+	if m, err = suppress(m, s.suppression); err != nil {
+		return
+	}
+	var (
+		body bytes.Buffer
+		w    = multipart.NewWriter(&body)
+	)
+	field := func(k, v string) {
+		if v != "" {
+			w.WriteField(k, v)
+		}
+	}
+	field("from", m.From.String())
+	for k, list := range map[string][]mail.Address{"to": m.To, "cc": m.Cc, "bcc": m.Bcc} {
+		for _, a := range list {
+			field(k, a.String())
+		}
+	}
+	field("subject", m.Subject)
+	field("text", m.Text)
+	field("html", m.HTML)
+	if len(m.ReplyTo) != 0 {
+		rs := make([]string, len(m.ReplyTo))
+		for i, a := range m.ReplyTo {
+			rs[i] = a.String()
+		}
+		field("h:Reply-To", strings.Join(rs, ", "))
+	}
+	for k, v := range m.Headers {
+		field("h:"+k, v)
+	}
+	files := func(field string, list []Attachment, name func(*Attachment) string) error {
+		for i := range list {
+			a := &list[i]
+			h := make(textproto.MIMEHeader)
+			h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, field, escapeQuotes(name(a))))
+			h.Set("Content-Type", a.contentType())
+			fw, err := w.CreatePart(h)
+			if err != nil {
+				return err
+			}
+			if _, err = fw.Write(a.Data); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	//inline is referenced by filename in mailgun
+	if err = files("attachment", m.Attachments, func(a *Attachment) string { return a.Filename }); err != nil {
+		return
+	}
+	if err = files("inline", m.Inlines, (*Attachment).contentId); err != nil {
+		return
+	}
+	if err = w.Close(); err != nil {
+		return
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.endpoint+"/v3/"+url.PathEscape(s.domain)+"/messages", &body)
+	if err != nil {
+		return
+	}
+	req.SetBasicAuth("api", s.apiKey)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	resp, data, err := sendHTTP(s.cli, req)
+	if err != nil {
+		return
+	}
+	var r struct {
+		Id      string `json:"id"`
+		Message string `json:"message"`
+	}
+	if resp.StatusCode/100 != 2 {
+		if json.Unmarshal(data, &r) == nil && r.Message != "" {
+			err = fmt.Errorf("mailgun(%d): %s", resp.StatusCode, r.Message)
+		} else {
+			err = &HTTPError{StatusCode: resp.StatusCode, Body: string(data)}
+		}
+		return
+	}
+	if err = json.Unmarshal(data, &r); err != nil {
+		return
+	}
+	id = r.Id
+	return
+}
+
+func (s *MailgunMailer) SupportBy() string {
+	return "mailgun"
+}
+
+func escapeQuotes(s string) string {
+	return strings.NewReplacer("\\", "\\\\", `"`, "\\\"").Replace(s)
+}
@@ -0,0 +1,71 @@
+package email
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMailgunMailer(t *testing.T) {
+	var (
+		form  map[string][]string
+		files = make(map[string]string)
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); user != "api" || pass != "key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte("Forbidden"))
+			return
+		}
+		if r.URL.Path != "/v3/mg.example.com/messages" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"Domain not found: ` + r.URL.Path + `"}`))
+			return
+		}
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Error(err)
+		}
+		form = r.MultipartForm.Value
+		for field, fhs := range r.MultipartForm.File {
+			for _, fh := range fhs {
+				f, _ := fh.Open()
+				data, _ := ioutil.ReadAll(f)
+				files[field+":"+fh.Filename] = string(data)
+			}
+		}
+		w.Write([]byte(`{"id":"<20200101.1@mg.example.com>","message":"Queued. Thank you."}`))
+	}))
+	defer srv.Close()
+
+	m, err := Using("mailgun", Config{APIKey: "key", Domain: "mg.example.com", Endpoint: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := m.Send(testAttachments(testMessage()))
+	if err != nil || id != "<20200101.1@mg.example.com>" {
+		t.Fatal(id, err)
+	}
+	if form["from"][0] != `"gutil" <noreply@example.com>` || form["to"][0] != `"Bob" <bob@example.com>` || form["bcc"][0] != "<dan@example.com>" {
+		t.Fatal(form)
+	}
+	if form["h:Reply-To"][0] != "<support@example.com>" || form["h:X-Campaign"][0] != "welcome" || form["html"][0] != "Hello <b>Bob</b>" {
+		t.Fatal(form)
+	}
+	if files["attachment:a.csv"] != "1,2" || files["inline:logo"] != "png" {
+		t.Fatal(files)
+	}
+
+	m, _ = Using("mailgun", Config{APIKey: "key", Domain: "lost.example.com", Endpoint: srv.URL})
+	if _, err = m.Send(testMessage()); err == nil || !strings.Contains(err.Error(), "Domain not found") {
+		t.Fatal("need domain error", err)
+	}
+	m, _ = Using("mailgun", Config{APIKey: "bad", Domain: "mg.example.com", Endpoint: srv.URL})
+	if _, err = m.Send(testMessage()); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Fatal("need auth error", err)
+	}
+	if m, _ = Using("mailgun", Config{APIKey: "key", Domain: "mg.example.com", Region: "EU"}); m.(*MailgunMailer).endpoint != mailgunEUEndpoint {
+		t.Fatal("need eu endpoint")
+	}
+}
@@ -0,0 +1,178 @@
+package email
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"gopkg.in/gomail.v2"
+	"io"
+	"io/ioutil"
+	"net/mail"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Message is a mail with text and/or html body
+type Message struct {
+	From    mail.Address
+	To      []mail.Address
+	Cc      []mail.Address
+	Bcc     []mail.Address //not written to headers
+	ReplyTo []mail.Address
+	Subject string
+
+	Text string
+	HTML string
+
+	Attachments []Attachment
+	Inlines     []Attachment //referenced in html by "cid:ContentId"
+
+	Headers   map[string]string //custom headers, e.g. List-Unsubscribe
+	MessageId string            //generated if empty
+	Date      time.Time         //zero: now
+}
+
+// Attachment of message
+type Attachment struct {
+	Filename    string
+	ContentType string //"": by extension of Filename
+	ContentId   string //inline only, "": Filename
+	Data        []byte
+}
+
+// AttachFile reads file as attachment
+func AttachFile(path string) (a Attachment, err error) {
+	if a.Data, err = ioutil.ReadFile(path); err != nil {
+		return
+	}
+	a.Filename = filepath.Base(path)
+	return
+}
+
+// Validate checks from, recipients, body and custom headers
+func (m *Message) Validate() error {
+	if m.From.Address == "" {
+		return ErrorMailNoFrom
+	}
+	if len(m.To)+len(m.Cc)+len(m.Bcc) == 0 {
+		return ErrorMailNoRecipient
+	}
+	for _, list := range [][]mail.Address{{m.From}, m.To, m.Cc, m.Bcc, m.ReplyTo} {
+		for _, a := range list {
+			if _, err := mail.ParseAddress(a.Address); err != nil {
+				return fmt.Errorf("invalid address %q: %v", a.Address, err)
+			}
+		}
+	}
+	if m.Text == "" && m.HTML == "" {
+		return ErrorMailNoBody
+	}
+	for k, v := range m.Headers {
+		if k == "" || strings.ContainsAny(k, ": \r\n") || strings.ContainsAny(v, "\r\n") {
+			return fmt.Errorf("invalid header %q", k)
+		}
+	}
+	return nil
+}
+
+// Recipients returns addresses of To, Cc and Bcc
+func (m *Message) Recipients() []string {
+	rcpts := make([]string, 0, len(m.To)+len(m.Cc)+len(m.Bcc))
+	for _, list := range [][]mail.Address{m.To, m.Cc, m.Bcc} {
+		for _, a := range list {
+			rcpts = append(rcpts, a.Address)
+		}
+	}
+	return rcpts
+}
+
+// ensureId generates MessageId if empty
+func (m *Message) ensureId() string {
+	if m.MessageId == "" {
+		b := make([]byte, 16)
+		rand.Read(b)
+		domain := "localhost"
+		if i := strings.LastIndexByte(m.From.Address, '@'); i >= 0 {
+			domain = m.From.Address[i+1:]
+		}
+		m.MessageId = "<" + hex.EncodeToString(b) + "@" + domain + ">"
+	}
+	return m.MessageId
+}
+
+func formatAddresses(gm *gomail.Message, list []mail.Address) []string {
+	vs := make([]string, len(list))
+	for i, a := range list {
+		vs[i] = gm.FormatAddress(a.Address, a.Name)
+	}
+	return vs
+}
+
+func (m *Message) gomail() *gomail.Message {
+	gm := gomail.NewMessage()
+	gm.SetHeader("From", gm.FormatAddress(m.From.Address, m.From.Name))
+	for field, list := range map[string][]mail.Address{"To": m.To, "Cc": m.Cc, "Reply-To": m.ReplyTo} {
+		if len(list) != 0 {
+			gm.SetHeader(field, formatAddresses(gm, list)...)
+		}
+	}
+	gm.SetHeader("Subject", m.Subject)
+	gm.SetHeader("Message-ID", m.ensureId())
+	date := m.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	gm.SetDateHeader("Date", date)
+	for k, v := range m.Headers {
+		gm.SetHeader(k, v)
+	}
+
+	switch {
+	case m.Text != "" && m.HTML != "":
+		gm.SetBody("text/plain", m.Text)
+		gm.AddAlternative("text/html", m.HTML)
+	case m.HTML != "":
+		gm.SetBody("text/html", m.HTML)
+	default:
+		gm.SetBody("text/plain", m.Text)
+	}
+	for _, a := range m.Inlines {
+		cid := a.ContentId
+		if cid == "" {
+			cid = a.Filename
+		}
+		gm.Embed(a.Filename, fileSettings(a, map[string][]string{"Content-ID": {"<" + cid + ">"}})...)
+	}
+	for _, a := range m.Attachments {
+		gm.Attach(a.Filename, fileSettings(a, map[string][]string{})...)
+	}
+	return gm
+}
+
+func fileSettings(a Attachment, header map[string][]string) []gomail.FileSetting {
+	data := a.Data
+	if a.ContentType != "" {
+		header["Content-Type"] = []string{a.ContentType + `; name="` + a.Filename + `"`}
+	}
+	return []gomail.FileSetting{
+		gomail.SetHeader(header),
+		gomail.SetCopyFunc(func(w io.Writer) error {
+			_, err := w.Write(data)
+			return err
+		}),
+	}
+}
+
+// WriteTo writes message in MIME format, Bcc is not written
+func (m *Message) WriteTo(w io.Writer) (int64, error) {
+	return m.gomail().WriteTo(w)
+}
+
+// Bytes returns message in MIME format
+func (m *Message) Bytes() ([]byte, error) {
+	var b bytes.Buffer
+	_, err := m.WriteTo(&b)
+	return b.Bytes(), err
+}
@@ -0,0 +1,97 @@
+package email
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+// walkParts returns content types of leaf parts by depth first, with their data
+func walkParts(t *testing.T, header map[string][]string, body []byte, leaves map[string][]byte, types *[]string) {
+	mt, params, err := mime.ParseMediaType(mail.Header(header).Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	*types = append(*types, mt)
+	if !strings.HasPrefix(mt, "multipart/") {
+		leaves[mt] = body
+		return
+	}
+	r := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for {
+		p, err := r.NextPart()
+		if err != nil {
+			break
+		}
+		// multipart.Reader decodes quoted-printable only
+		data, _ := ioutil.ReadAll(p)
+		walkParts(t, p.Header, data, leaves, types)
+	}
+}
+
+func TestMessageMIME(t *testing.T) {
+	msg := testMessage()
+	msg.ReplyTo = []mail.Address{{Address: "support@example.com"}}
+	msg.HTML = `<img src="cid:logo">Hello`
+	msg.Headers = map[string]string{"List-Unsubscribe": "<mailto:unsub@example.com>"}
+	msg.Inlines = []Attachment{{Filename: "logo.png", ContentId: "logo", Data: []byte("png")}}
+	msg.Attachments = []Attachment{{Filename: "a.txt", ContentType: "text/csv", Data: []byte("1,2")}}
+
+	data, err := msg.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := parsed.Header
+	if h.Get("Reply-To") != "support@example.com" || h.Get("List-Unsubscribe") == "" || h.Get("Bcc") != "" || h.Get("Message-ID") != msg.MessageId {
+		t.Fatal(h)
+	}
+	if to, err := h.AddressList("To"); err != nil || to[0].Name != "Bob" {
+		t.Fatal(to, err)
+	}
+
+	body, _ := ioutil.ReadAll(parsed.Body)
+	var types []string
+	leaves := make(map[string][]byte)
+	walkParts(t, h, body, leaves, &types)
+	if strings.Join(types, ",") != "multipart/mixed,multipart/related,multipart/alternative,text/plain,text/html,image/png,text/csv" {
+		t.Fatal(types)
+	}
+	if !strings.Contains(string(data), "Content-ID: <logo>") || !strings.Contains(string(data), `filename="a.txt"`) {
+		t.Fatal(string(data))
+	}
+	if string(leaves["text/plain"]) != "Hello Bob" {
+		t.Fatalf("%q", leaves["text/plain"])
+	}
+}
+
+func TestMessageValidate(t *testing.T) {
+	for want, modify := range map[error]func(*Message){
+		ErrorMailNoFrom:      func(m *Message) { m.From = mail.Address{} },
+		ErrorMailNoRecipient: func(m *Message) { m.To, m.Cc, m.Bcc = nil, nil, nil },
+		ErrorMailNoBody:      func(m *Message) { m.Text, m.HTML = "", "" },
+	} {
+		m := testMessage()
+		modify(m)
+		if err := m.Validate(); err != want {
+			t.Fatal(want, err)
+		}
+	}
+	m := testMessage()
+	m.To = append(m.To, mail.Address{Address: "bad"})
+	if err := m.Validate(); err == nil {
+		t.Fatal("need address error")
+	}
+	m = testMessage()
+	m.Headers = map[string]string{"X-Test": "a\r\nBcc: evil@example.com"}
+	if err := m.Validate(); err == nil {
+		t.Fatal("need header error")
+	}
+}
@@ -0,0 +1,177 @@
+package email
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"golang.org/x/net/html/charset"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+)
+
+// parsed headers which are not kept in Message.Headers
+var parsedHeaders = map[string]bool{
+	"From": true, "To": true, "Cc": true, "Bcc": true, "Reply-To": true, "Subject": true,
+	"Message-Id": true, "Date": true, "Mime-Version": true,
+	"Content-Type": true, "Content-Transfer-Encoding": true, "Content-Disposition": true,
+}
+
+var headerDecoder = &mime.WordDecoder{CharsetReader: charset.NewReaderLabel}
+
+// ParseMessage parses a MIME message, e.g. a reply or a bounce.
+// Encoded headers and bodies are decoded to utf-8, the first text/plain and text/html parts are the bodies,
+// other parts are attachments, or inlines if they have Content-ID.
+// Headers keeps the last value of other headers, e.g. In-Reply-To
+func ParseMessage(r io.Reader) (m *Message, err error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return
+	}
+	h := msg.Header
+	m = &Message{
+		Subject:   decodeHeader(h.Get("Subject")),
+		MessageId: h.Get("Message-Id"),
+		Headers:   make(map[string]string),
+	}
+	m.Date, _ = h.Date()
+	parser := mail.AddressParser{WordDecoder: headerDecoder}
+	if from, e := parser.ParseList(h.Get("From")); e == nil && len(from) != 0 {
+		m.From = *from[0]
+	}
+	for _, f := range []struct {
+		key  string
+		list *[]mail.Address
+	}{{"To", &m.To}, {"Cc", &m.Cc}, {"Bcc", &m.Bcc}, {"Reply-To", &m.ReplyTo}} {
+		if v := h.Get(f.key); v != "" {
+			//invalid address lists are ignored
+			list, _ := parser.ParseList(v)
+			for _, a := range list {
+				*f.list = append(*f.list, *a)
+			}
+		}
+	}
+	for k, vs := range h {
+		if !parsedHeaders[k] && len(vs) != 0 {
+			m.Headers[k] = decodeHeader(vs[len(vs)-1])
+		}
+	}
+	err = m.parsePart(textproto.MIMEHeader(h), msg.Body, 0)
+	return
+}
+
+// decodeHeader decodes RFC 2047 encoded words, returns raw value for unknown charsets
+func decodeHeader(v string) string {
+	d, err := headerDecoder.DecodeHeader(v)
+	if err != nil {
+		return v
+	}
+	return d
+}
+
+func (m *Message) parsePart(h textproto.MIMEHeader, body io.Reader, depth int) (err error) {
+	if depth > 10 {
+		return errors.New("too deep multipart")
+	}
+	mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		mediaType, params, err = "text/plain", map[string]string{}, nil
+	}
+	if strings.HasPrefix(mediaType, "multipart/") {
+		if params["boundary"] == "" {
+			return errors.New("lost boundary of multipart")
+		}
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			p, e := mr.NextPart()
+			if e == io.EOF {
+				return
+			}
+			if e != nil {
+				return e
+			}
+			if err = m.parsePart(p.Header, p, depth+1); err != nil {
+				return
+			}
+		}
+	}
+
+	data, err := ioutil.ReadAll(decodeTransfer(h.Get("Content-Transfer-Encoding"), body))
+	if err != nil {
+		return
+	}
+	disposition, dparams, _ := mime.ParseMediaType(h.Get("Content-Disposition"))
+	filename := decodeHeader(dparams["filename"])
+	if filename == "" {
+		filename = decodeHeader(params["name"])
+	}
+	if disposition != "attachment" && filename == "" && strings.HasPrefix(mediaType, "text/") {
+		text := toUTF8(data, params["charset"])
+		switch {
+		case mediaType == "text/plain" && m.Text == "":
+			m.Text = text
+			return
+		case mediaType == "text/html" && m.HTML == "":
+			m.HTML = text
+			return
+		}
+	}
+	a := Attachment{Filename: filename, ContentType: mediaType, Data: data}
+	if cid := strings.Trim(h.Get("Content-Id"), "<> "); cid != "" && disposition != "attachment" {
+		a.ContentId = cid
+		m.Inlines = append(m.Inlines, a)
+	} else {
+		m.Attachments = append(m.Attachments, a)
+	}
+	return
+}
+
+func decodeTransfer(encoding string, r io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, &lineSkipper{r: r})
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	}
+	return r
+}
+
+// lineSkipper removes line breaks and spaces of base64 content
+type lineSkipper struct {
+	r io.Reader
+}
+
+func (l *lineSkipper) Read(p []byte) (n int, err error) {
+	for n == 0 && err == nil {
+		n, err = l.r.Read(p)
+		j := 0
+		for _, c := range p[:n] {
+			if c != '\r' && c != '\n' && c != ' ' && c != '\t' {
+				p[j] = c
+				j++
+			}
+		}
+		n = j
+	}
+	return
+}
+
+// toUTF8 converts text of charset, raw text is returned for unknown charsets
+func toUTF8(data []byte, cs string) string {
+	if cs == "" || strings.EqualFold(cs, "utf-8") || strings.EqualFold(cs, "us-ascii") {
+		return string(data)
+	}
+	r, err := charset.NewReaderLabel(cs, bytes.NewReader(data))
+	if err != nil {
+		return string(data)
+	}
+	if d, err := ioutil.ReadAll(r); err == nil {
+		return string(d)
+	}
+	return string(data)
+}
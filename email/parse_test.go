@@ -0,0 +1,74 @@
+package email
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseMessage(t *testing.T) {
+	f, err := os.Open("testdata/inbound/reply.eml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	m, err := ParseMessage(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.From.Name != "张三" || m.From.Address != "bob@example.com" || m.Subject != "你好，世界" {
+		t.Fatalf("%+v %q", m.From, m.Subject)
+	}
+	if len(m.To) != 2 || m.To[1].Address != "cora@example.com" || m.Cc[0].Name != "Dan" || m.ReplyTo[0].Address != "bob+reply@example.com" {
+		t.Fatalf("%+v %+v %+v", m.To, m.Cc, m.ReplyTo)
+	}
+	if m.MessageId != "<reply-1@example.com>" || m.Headers["In-Reply-To"] != "<abc@example.com>" || m.Date.Unix() != 1136185445 {
+		t.Fatal(m.MessageId, m.Headers, m.Date)
+	}
+	if _, has := m.Headers["Subject"]; has {
+		t.Fatal("parsed headers should not be kept")
+	}
+	if m.Text != "Merci beaucoup, très bien!\r\n\r\n> Hello Bob" || m.HTML != `<p>Thanks <img src="cid:logo@example.com"></p>` {
+		t.Fatalf("%q %q", m.Text, m.HTML)
+	}
+	if len(m.Inlines) != 1 || m.Inlines[0].ContentId != "logo@example.com" || string(m.Inlines[0].Data) != "png" || m.Inlines[0].ContentType != "image/png" {
+		t.Fatalf("%+v", m.Inlines)
+	}
+	if len(m.Attachments) != 1 || m.Attachments[0].Filename != "报表.csv" || string(m.Attachments[0].Data) != "1,23,\n" {
+		t.Fatalf("%+v", m.Attachments)
+	}
+}
+
+func TestParseMessageRoundTrip(t *testing.T) {
+	sent := testAttachments(testMessage())
+	sent.Subject = "你好 Bob"
+	data, err := sent.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := ParseMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Subject != sent.Subject || m.From != sent.From || m.To[0] != sent.To[0] || len(m.Bcc) != 0 || m.MessageId != sent.MessageId {
+		t.Fatalf("%+v", m)
+	}
+	if m.Text != sent.Text || m.HTML != sent.HTML || m.Headers["X-Campaign"] != "welcome" {
+		t.Fatalf("%q %q %v", m.Text, m.HTML, m.Headers)
+	}
+	if len(m.Attachments) != 1 || string(m.Attachments[0].Data) != "1,2" || m.Attachments[0].Filename != "a.csv" {
+		t.Fatalf("%+v", m.Attachments)
+	}
+	if len(m.Inlines) != 1 || m.Inlines[0].ContentId != "logo" || string(m.Inlines[0].Data) != "png" {
+		t.Fatalf("%+v", m.Inlines)
+	}
+
+	plain, err := ParseMessage(strings.NewReader("From: a@example.com\r\nSubject: hi\r\n\r\nbody\r\n"))
+	if err != nil || plain.Text != "body\r\n" || plain.From.Address != "a@example.com" {
+		t.Fatal(plain, err)
+	}
+	if _, err = ParseMessage(strings.NewReader("Content-Type: multipart/mixed\r\n\r\nbody")); err == nil {
+		t.Fatal("need boundary error")
+	}
+}
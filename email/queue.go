@@ -0,0 +1,291 @@
+package email
+
+import (
+	"errors"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrorMailQueueFull   = errors.New("mail queue is full")
+	ErrorMailQueueClosed = errors.New("mail queue is closed")
+)
+
+// SendResult of a queued message
+type SendResult struct {
+	Message  *Message
+	Id       string
+	Attempts int
+	Err      error
+}
+
+// SMTPQueue sends messages by a pool of persistent smtp connections
+type SMTPQueue struct {
+	Workers     int           //connections, default 4
+	QueueSize   int           //default 100
+	MaxAttempts int           //default 3
+	Backoff     time.Duration //delay of first retry, doubled each time, default 1 second
+	MaxBackoff  time.Duration //default 1 minute
+	KeepAlive   time.Duration //NOOP interval of idle connection, default 30 seconds
+	IdleTimeout time.Duration //idle connection is closed after, default 5 minutes
+	// DomainRate limits messages per minute by recipient domain, "*" for others
+	DomainRate map[string]int
+	// Callback is called by workers concurrently, could be nil
+	Callback func(SendResult)
+
+	mailer  *SMTPMailer
+	limiter *domainLimiter
+	jobs    chan *queueJob
+
+	mu      sync.Mutex
+	started bool
+	closed  bool
+	pending sync.WaitGroup //queued messages until result
+	workers sync.WaitGroup
+}
+
+type queueJob struct {
+	msg      *Message
+	data     []byte
+	attempts int
+}
+
+func NewSMTPQueue(cfg Config, callback func(SendResult)) (q *SMTPQueue, err error) {
+	mailer := &SMTPMailer{}
+	if _, err = mailer.InitMailer(cfg); err != nil {
+		return
+	}
+	q = &SMTPQueue{
+		Workers:     4,
+		QueueSize:   100,
+		MaxAttempts: 3,
+		Backoff:     time.Second,
+		MaxBackoff:  time.Minute,
+		KeepAlive:   30 * time.Second,
+		IdleTimeout: 5 * time.Minute,
+		Callback:    callback,
+		mailer:      mailer,
+	}
+	return
+}
+
+// Start runs workers, fields can't be changed after
+func (q *SMTPQueue) Start() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.started {
+		return
+	}
+	q.started = true
+	if q.Workers <= 0 {
+		q.Workers = 1
+	}
+	if q.QueueSize <= 0 {
+		q.QueueSize = 100
+	}
+	if q.MaxAttempts <= 0 {
+		q.MaxAttempts = 1
+	}
+	q.limiter = newDomainLimiter(q.DomainRate)
+	q.jobs = make(chan *queueJob, q.QueueSize)
+	for i := 0; i < q.Workers; i++ {
+		q.workers.Add(1)
+		go q.work()
+	}
+}
+
+// Enqueue validates message and queues it, returns Message-ID
+func (q *SMTPQueue) Enqueue(m *Message) (id string, err error) {
+	if err = m.Validate(); err != nil {
+		return
+	}
+	id = m.ensureId() //before suppress, the caller's message keeps the sent id
+	if m, err = suppress(m, q.mailer.suppression); err != nil {
+		return
+	}
+	data, err := signMessage(m, q.mailer.dkim)
+	if err != nil {
+		return
+	}
+	q.Start()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return "", ErrorMailQueueClosed
+	}
+	q.pending.Add(1)
+	select {
+	case q.jobs <- &queueJob{msg: m, data: data}:
+	default:
+		q.pending.Done()
+		return "", ErrorMailQueueFull
+	}
+	return
+}
+
+// Close stops accepting messages, waits for queued ones including retries, then closes connections
+func (q *SMTPQueue) Close() {
+	q.Start()
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return
+	}
+	q.closed = true
+	q.mu.Unlock()
+
+	q.pending.Wait()
+	close(q.jobs)
+	q.workers.Wait()
+}
+
+func (q *SMTPQueue) work() {
+	defer q.workers.Done()
+	var (
+		c        *smtpConn
+		lastUsed time.Time
+	)
+	closeConn := func() {
+		if c != nil {
+			c.conn.SetDeadline(time.Now().Add(q.mailer.timeout))
+			c.client.Quit()
+			c.close()
+			c = nil
+		}
+	}
+	defer closeConn()
+
+	keepAlive := q.KeepAlive
+	if keepAlive <= 0 {
+		keepAlive = 30 * time.Second
+	}
+	ticker := time.NewTicker(keepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case job, ok := <-q.jobs:
+			if !ok {
+				return
+			}
+			q.limiter.wait(job.msg.Recipients())
+			job.attempts++
+			err := q.deliver(&c, job)
+			lastUsed = time.Now()
+			q.done(job, err)
+		case <-ticker.C:
+			if c == nil {
+				continue
+			}
+			if q.IdleTimeout > 0 && time.Since(lastUsed) > q.IdleTimeout {
+				closeConn()
+				continue
+			}
+			c.conn.SetDeadline(time.Now().Add(q.mailer.timeout))
+			if err := c.client.Noop(); err != nil {
+				c.close()
+				c = nil
+				continue
+			}
+			c.conn.SetDeadline(time.Time{})
+		}
+	}
+}
+
+// deliver sends by connection c, reconnects once if the reused connection is broken
+func (q *SMTPQueue) deliver(c **smtpConn, job *queueJob) (err error) {
+	for {
+		fresh := *c == nil
+		if fresh {
+			if *c, err = q.mailer.dial(); err != nil {
+				return
+			}
+		}
+		err = (*c).send(job.msg.From.Address, job.msg.Recipients(), job.data, q.mailer.timeout)
+		if _, isReply := err.(*textproto.Error); err == nil || isReply {
+			return
+		}
+		(*c).close()
+		*c = nil
+		if fresh {
+			return
+		}
+	}
+}
+
+// done calls back or schedules retry of transient error
+func (q *SMTPQueue) done(job *queueJob, err error) {
+	if err != nil && job.attempts < q.MaxAttempts && isTransient(err) {
+		backoff := q.Backoff << uint(job.attempts-1)
+		if q.MaxBackoff > 0 && (backoff > q.MaxBackoff || backoff <= 0) {
+			backoff = q.MaxBackoff
+		}
+		time.AfterFunc(backoff, func() { q.jobs <- job })
+		return
+	}
+	if q.Callback != nil {
+		q.Callback(SendResult{Message: job.msg, Id: job.msg.MessageId, Attempts: job.attempts, Err: err})
+	}
+	q.pending.Done()
+}
+
+// isTransient returns true for 4xx replies and network errors
+func isTransient(err error) bool {
+	if e, ok := err.(*textproto.Error); ok {
+		return e.Code >= 400 && e.Code < 500
+	}
+	return true
+}
+
+// domainLimiter reserves sending time by domain
+type domainLimiter struct {
+	mu       sync.Mutex
+	interval map[string]time.Duration
+	next     map[string]time.Time
+}
+
+func newDomainLimiter(rates map[string]int) *domainLimiter {
+	l := &domainLimiter{interval: make(map[string]time.Duration), next: make(map[string]time.Time)}
+	for domain, rate := range rates {
+		if rate > 0 {
+			l.interval[strings.ToLower(domain)] = time.Minute / time.Duration(rate)
+		}
+	}
+	return l
+}
+
+// wait blocks until all domains of recipients are allowed
+func (l *domainLimiter) wait(rcpts []string) {
+	if len(l.interval) == 0 {
+		return
+	}
+	now := time.Now()
+	at := now
+	l.mu.Lock()
+	reserved := make(map[string]bool)
+	for _, rcpt := range rcpts {
+		domain := strings.ToLower(rcpt[strings.LastIndexByte(rcpt, '@')+1:])
+		interval, has := l.interval[domain]
+		if !has {
+			if interval, has = l.interval["*"]; !has {
+				continue
+			}
+		}
+		if reserved[domain] {
+			continue
+		}
+		reserved[domain] = true
+		t := l.next[domain]
+		if t.Before(now) {
+			t = now
+		}
+		l.next[domain] = t.Add(interval)
+		if t.After(at) {
+			at = t
+		}
+	}
+	l.mu.Unlock()
+	time.Sleep(at.Sub(now))
+}
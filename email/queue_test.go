@@ -0,0 +1,154 @@
+package email
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type resultRecorder struct {
+	mu      sync.Mutex
+	results []SendResult
+}
+
+func (r *resultRecorder) add(res SendResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.results = append(r.results, res)
+}
+
+func TestSMTPQueue(t *testing.T) {
+	f := newFakeSMTP(t, &fakeSMTP{})
+	defer f.ln.Close()
+	var (
+		mu    sync.Mutex
+		tries = make(map[string]int)
+	)
+	f.rcptReply = func(rcpt string) string {
+		mu.Lock()
+		defer mu.Unlock()
+		tries[rcpt]++
+		switch {
+		case strings.HasPrefix(rcpt, "busy") && tries[rcpt] == 1:
+			return "451 try again later"
+		case strings.HasPrefix(rcpt, "lost"):
+			return "550 no such user"
+		}
+		return ""
+	}
+
+	rec := &resultRecorder{}
+	q, err := NewSMTPQueue(f.config(TLSNone), rec.add)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Workers, q.Backoff = 2, 10*time.Millisecond
+	for i := 0; i < 20; i++ {
+		m := testMessage()
+		m.To, m.Cc, m.Bcc = []mail.Address{{Address: fmt.Sprintf("user%d@example.com", i)}}, nil, nil
+		switch i {
+		case 3:
+			m.To[0].Address = "busy@example.com"
+		case 5:
+			m.To[0].Address = "lost@example.com"
+		}
+		if _, err = q.Enqueue(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	q.Close()
+	if _, err = q.Enqueue(testMessage()); err != ErrorMailQueueClosed {
+		t.Fatal("need closed error", err)
+	}
+
+	if len(rec.results) != 20 || len(f.received()) != 19 {
+		t.Fatal(len(rec.results), len(f.received()))
+	}
+	for _, r := range rec.results {
+		switch r.Message.To[0].Address {
+		case "busy@example.com":
+			if r.Err != nil || r.Attempts != 2 {
+				t.Fatalf("%+v", r)
+			}
+		case "lost@example.com":
+			if r.Err == nil || r.Attempts != 1 {
+				t.Fatalf("%+v", r)
+			}
+		default:
+			if r.Err != nil || r.Attempts != 1 || r.Id == "" {
+				t.Fatalf("%+v", r)
+			}
+		}
+	}
+	if conns, _ := f.stats(); conns != 2 {
+		t.Fatal("need 2 persistent connections", conns)
+	}
+}
+
+func TestSMTPQueueReconnect(t *testing.T) {
+	f := newFakeSMTP(t, &fakeSMTP{})
+	defer f.ln.Close()
+	rec := &resultRecorder{}
+	q, _ := NewSMTPQueue(f.config(TLSNone), rec.add)
+	q.Workers, q.KeepAlive = 1, 20*time.Millisecond
+	q.Enqueue(testMessage())
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, noops := f.stats(); noops > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("need keep alive")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	//connection is dropped by server, the next message reconnects without retry
+	f.drop()
+	q.Enqueue(testMessage())
+	q.Close()
+	if len(rec.results) != 2 || rec.results[1].Err != nil || rec.results[1].Attempts != 1 {
+		t.Fatalf("%+v", rec.results)
+	}
+	if conns, _ := f.stats(); conns != 2 {
+		t.Fatal("need reconnect", conns)
+	}
+}
+
+func TestSMTPQueueRateLimit(t *testing.T) {
+	f := newFakeSMTP(t, &fakeSMTP{})
+	defer f.ln.Close()
+	q, _ := NewSMTPQueue(f.config(TLSNone), nil)
+	q.DomainRate = map[string]int{"example.com": 600} //100ms
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		q.Enqueue(testMessage())
+	}
+	q.Close()
+	if d := time.Since(start); d < 200*time.Millisecond {
+		t.Fatal("need rate limit", d)
+	}
+	if len(f.received()) != 3 {
+		t.Fatal(len(f.received()))
+	}
+}
+
+func TestSMTPQueueFull(t *testing.T) {
+	f := newFakeSMTP(t, &fakeSMTP{})
+	defer f.ln.Close()
+	q, _ := NewSMTPQueue(f.config(TLSNone), nil)
+	q.Workers, q.QueueSize = 1, 1
+	q.DomainRate = map[string]int{"*": 60}
+	var full bool
+	for i := 0; i < 5 && !full; i++ {
+		_, err := q.Enqueue(testMessage())
+		full = err == ErrorMailQueueFull
+	}
+	if !full {
+		t.Fatal("need full error")
+	}
+}
@@ -0,0 +1,245 @@
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net/mail"
+	"net/textproto"
+	"regexp"
+	"strings"
+)
+
+// ReportType of delivery report
+type ReportType string
+
+const (
+	ReportBounce    ReportType = "bounce"    //DSN of failed delivery
+	ReportDelay     ReportType = "delay"     //DSN of delayed delivery, still retrying
+	ReportDelivered ReportType = "delivered" //DSN of successful delivery
+	ReportComplaint ReportType = "complaint" //ARF feedback report
+)
+
+// BounceCategory of a report
+type BounceCategory string
+
+const (
+	BounceNone        BounceCategory = ""
+	BounceUnknownUser BounceCategory = "unknown_user" //mailbox doesn't exist
+	BounceBadDomain   BounceCategory = "bad_domain"   //domain or mx doesn't exist
+	BounceDisabled    BounceCategory = "disabled"     //mailbox is disabled
+	BounceMailboxFull BounceCategory = "mailbox_full" //over quota
+	BounceTooLarge    BounceCategory = "too_large"    //message is too large
+	BouncePolicy      BounceCategory = "policy"       //rejected as spam, by policy or reputation
+	BounceNetwork     BounceCategory = "network"      //routing, connection or timeout
+	BounceComplaint   BounceCategory = "complaint"    //marked as spam by recipient
+	BounceUnknown     BounceCategory = "unknown"
+)
+
+// Report of a recipient, parsed from DSN(RFC 3464) or ARF(RFC 5965)
+type Report struct {
+	Type      ReportType
+	Recipient string
+	Action    string //DSN: failed, delayed, delivered, relayed, expanded
+	Status    string //DSN: enhanced status code, e.g. 5.1.1
+	// Diagnostic is the Diagnostic-Code of DSN, e.g. "smtp; 550 5.1.1 user unknown"
+	Diagnostic   string
+	Category     BounceCategory
+	FeedbackType string //ARF: abuse, fraud, virus, other
+	ReportingMTA string
+	MessageId    string //Message-ID of the original message, if returned
+}
+
+// Hard returns true if the recipient should not be mailed again
+func (r *Report) Hard() bool {
+	if r.Type == ReportComplaint {
+		return true
+	}
+	if r.Type != ReportBounce || !strings.HasPrefix(r.Status, "5") {
+		return false
+	}
+	switch r.Category {
+	case BounceUnknownUser, BounceBadDomain, BounceDisabled:
+		return true
+	}
+	return false
+}
+
+// categories by "subject.detail" of enhanced status code, then by "subject.0"
+var bounceCategories = map[string]BounceCategory{
+	"1.1": BounceUnknownUser, "1.3": BounceUnknownUser, "1.6": BounceUnknownUser, "1.2": BounceBadDomain, "1.10": BounceBadDomain,
+	"2.1": BounceDisabled, "2.2": BounceMailboxFull, "2.3": BounceTooLarge, "3.4": BounceTooLarge,
+	"4.0": BounceNetwork, "4.1": BounceNetwork, "4.2": BounceNetwork, "4.3": BounceNetwork,
+	"4.4": BounceBadDomain, "4.6": BounceNetwork, "4.7": BounceNetwork,
+	"7.0": BouncePolicy, "7.1": BouncePolicy,
+}
+
+// heuristics for diagnostics with generic status, e.g. "550 5.0.0"
+var bounceKeywords = []struct {
+	words    []string
+	category BounceCategory
+}{
+	{[]string{"user unknown", "unknown user", "no such user", "does not exist", "mailbox unavailable", "invalid recipient", "recipient rejected", "address rejected"}, BounceUnknownUser},
+	{[]string{"quota", "mailbox full", "mailbox is full", "insufficient storage"}, BounceMailboxFull},
+	{[]string{"disabled", "inactive", "suspended"}, BounceDisabled},
+	{[]string{"too large", "size limit", "message size"}, BounceTooLarge},
+	{[]string{"spam", "blocked", "blacklist", "blocklist", "reputation", "policy", "dmarc", "spf", "dkim"}, BouncePolicy},
+	{[]string{"host not found", "domain not found", "no mx", "name or service not known"}, BounceBadDomain},
+	{[]string{"timed out", "timeout", "connection refused", "connection reset"}, BounceNetwork},
+}
+
+var statusInText = regexp.MustCompile(`\b([245])\.(\d{1,3})\.(\d{1,3})\b`)
+
+// ClassifyBounce returns category by enhanced status code and diagnostic text
+func ClassifyBounce(status, diagnostic string) BounceCategory {
+	if status == "" || strings.HasSuffix(status, ".0.0") {
+		if m := statusInText.FindString(diagnostic); m != "" {
+			status = m
+		}
+	}
+	if parts := strings.SplitN(status, ".", 3); len(parts) == 3 {
+		sub, detail := parts[1], parts[2]
+		if c, has := bounceCategories[sub+"."+detail]; has {
+			return c
+		}
+		if sub != "0" {
+			if c, has := bounceCategories[sub+".0"]; has {
+				return c
+			}
+		}
+	}
+	lower := strings.ToLower(diagnostic)
+	for _, k := range bounceKeywords {
+		for _, w := range k.words {
+			if strings.Contains(lower, w) {
+				return k.category
+			}
+		}
+	}
+	return BounceUnknown
+}
+
+// ParseReports returns reports of a DSN or ARF message parsed by ParseMessage,
+// nil for other messages
+func ParseReports(m *Message) (reports []Report, err error) {
+	var (
+		status, feedback []byte
+		original         *mail.Header
+	)
+	for _, a := range m.Attachments {
+		switch a.ContentType {
+		case "message/delivery-status", "message/global-delivery-status":
+			status = a.Data
+		case "message/feedback-report":
+			feedback = a.Data
+		case "message/rfc822", "message/global", "text/rfc822-headers", "message/rfc822-headers":
+			if original == nil {
+				if msg, e := mail.ReadMessage(bytes.NewReader(append(a.Data, "\r\n\r\n"...))); e == nil {
+					original = &msg.Header
+				}
+			}
+		}
+	}
+	originalId := ""
+	if original != nil {
+		originalId = original.Get("Message-Id")
+	}
+
+	switch {
+	case feedback != nil:
+		var blocks []textproto.MIMEHeader
+		if blocks, err = readFieldBlocks(feedback); err != nil || len(blocks) == 0 {
+			return
+		}
+		f := blocks[0]
+		r := Report{
+			Type:         ReportComplaint,
+			Recipient:    addressOf(f.Get("Original-Rcpt-To")),
+			Category:     BounceComplaint,
+			FeedbackType: strings.ToLower(f.Get("Feedback-Type")),
+			ReportingMTA: f.Get("Reporting-Mta"),
+			MessageId:    originalId,
+		}
+		if r.Recipient == "" && original != nil {
+			if to, e := original.AddressList("To"); e == nil && len(to) != 0 {
+				r.Recipient = to[0].Address
+			}
+		}
+		reports = append(reports, r)
+	case status != nil:
+		var blocks []textproto.MIMEHeader
+		if blocks, err = readFieldBlocks(status); err != nil || len(blocks) == 0 {
+			return
+		}
+		mta := typedValue(blocks[0].Get("Reporting-Mta"))
+		for _, f := range blocks[1:] {
+			r := Report{
+				Recipient:    addressOf(typedValue(f.Get("Final-Recipient"))),
+				Action:       strings.ToLower(f.Get("Action")),
+				Diagnostic:   f.Get("Diagnostic-Code"),
+				ReportingMTA: mta,
+				MessageId:    originalId,
+			}
+			if fs := strings.Fields(f.Get("Status")); len(fs) != 0 {
+				r.Status = fs[0]
+			}
+			if r.Recipient == "" {
+				r.Recipient = addressOf(typedValue(f.Get("Original-Recipient")))
+			}
+			switch r.Action {
+			case "failed":
+				r.Type = ReportBounce
+			case "delayed":
+				r.Type = ReportDelay
+			default:
+				r.Type = ReportDelivered
+			}
+			if r.Type != ReportDelivered {
+				r.Category = ClassifyBounce(r.Status, r.Diagnostic)
+			}
+			reports = append(reports, r)
+		}
+	}
+	return
+}
+
+// readFieldBlocks reads header blocks separated by blank lines
+func readFieldBlocks(data []byte) (blocks []textproto.MIMEHeader, err error) {
+	data = bytes.TrimLeft(bytes.Replace(data, []byte("\r\n"), []byte("\n"), -1), "\n")
+	tr := textproto.NewReader(bufio.NewReader(bytes.NewReader(append(data, "\n\n"...))))
+	for {
+		h, e := tr.ReadMIMEHeader()
+		if len(h) != 0 {
+			blocks = append(blocks, h)
+		}
+		if e == io.EOF {
+			return
+		}
+		if e != nil {
+			return blocks, e
+		}
+		//skip extra blank lines
+		for {
+			b, e := tr.R.Peek(1)
+			if e != nil || b[0] != '\n' {
+				break
+			}
+			tr.R.ReadByte()
+		}
+	}
+}
+
+// typedValue returns value of "type; value", e.g. "rfc822; bob@example.com"
+func typedValue(v string) string {
+	if i := strings.IndexByte(v, ';'); i >= 0 {
+		v = v[i+1:]
+	}
+	return strings.TrimSpace(v)
+}
+
+func addressOf(v string) string {
+	if a, err := mail.ParseAddress(v); err == nil {
+		return a.Address
+	}
+	return strings.Trim(v, "<> ")
+}
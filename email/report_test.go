@@ -0,0 +1,100 @@
+package email
+
+import (
+	"os"
+	"testing"
+)
+
+func parseFile(t *testing.T, path string) *Message {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	m, err := ParseMessage(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestParseReportsDSN(t *testing.T) {
+	reports, err := ParseReports(parseFile(t, "testdata/inbound/bounce.eml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 3 {
+		t.Fatalf("%+v", reports)
+	}
+	for i, want := range []struct {
+		typ       ReportType
+		recipient string
+		status    string
+		category  BounceCategory
+		hard      bool
+	}{
+		{ReportBounce, "Bob@Example.com", "5.1.1", BounceUnknownUser, true},
+		{ReportDelay, "cora@example.org", "4.4.1", BounceNetwork, false},
+		{ReportBounce, "dan@example.org", "5.0.0", BounceMailboxFull, false},
+	} {
+		r := reports[i]
+		if r.Type != want.typ || r.Recipient != want.recipient || r.Status != want.status || r.Category != want.category || r.Hard() != want.hard {
+			t.Fatalf("%d: %+v", i, r)
+		}
+		if r.ReportingMTA != "mx.example.net" || r.MessageId != "<abc@example.com>" {
+			t.Fatalf("%d: %+v", i, r)
+		}
+	}
+	if reports[0].Diagnostic != "smtp; 550 5.1.1 <bob@example.com>: Recipient address rejected: User unknown in virtual mailbox table" {
+		t.Fatalf("%q", reports[0].Diagnostic)
+	}
+
+	//Status is optional in a broken recipient block
+	reports, err = ParseReports(parseFile(t, "testdata/inbound/bounce-nostatus.eml"))
+	if err != nil || len(reports) != 1 {
+		t.Fatalf("%+v %v", reports, err)
+	}
+	if r := reports[0]; r.Type != ReportBounce || r.Recipient != "bob@example.com" || r.Status != "" || r.Category != BounceUnknownUser {
+		t.Fatalf("%+v", r)
+	}
+}
+
+func TestParseReportsARF(t *testing.T) {
+	reports, err := ParseReports(parseFile(t, "testdata/inbound/complaint.eml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 1 {
+		t.Fatalf("%+v", reports)
+	}
+	r := reports[0]
+	if r.Type != ReportComplaint || r.Recipient != "Eve@isp.example" || r.FeedbackType != "abuse" || r.MessageId != "<def@example.com>" || !r.Hard() {
+		t.Fatalf("%+v", r)
+	}
+
+	reports, err = ParseReports(parseFile(t, "testdata/inbound/reply.eml"))
+	if err != nil || reports != nil {
+		t.Fatal("reply is not a report", reports, err)
+	}
+}
+
+func TestClassifyBounce(t *testing.T) {
+	for _, c := range []struct {
+		status, diagnostic string
+		category           BounceCategory
+	}{
+		{"5.1.2", "", BounceBadDomain},
+		{"5.2.1", "", BounceDisabled},
+		{"5.7.1", "", BouncePolicy},
+		{"5.7.99", "", BouncePolicy},
+		{"5.3.4", "", BounceTooLarge},
+		{"", "smtp; 550 5.1.1 no such user", BounceUnknownUser},
+		{"5.0.0", "smtp; 554 rejected due to spam content", BouncePolicy},
+		{"5.0.0", "smtp; 550 account suspended", BounceDisabled},
+		{"5.0.0", "whatever", BounceUnknown},
+	} {
+		if got := ClassifyBounce(c.status, c.diagnostic); got != c.category {
+			t.Fatal(c, got)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package email
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strings"
+)
+
+const sendgridEndpoint = "https://api.sendgrid.com"
+
+// SendGridMailer sends by v3 api, APIKey is required
+type SendGridMailer struct {
+	apiKey   string
+	endpoint string
+	cli      *http.Client
+
+	suppression SuppressionList
+}
+
+func (s *SendGridMailer) InitMailer(cfg Config) (instance Mailer, err error) {
+	if cfg.APIKey == "" {
+		err = errors.New("lost api key")
+		return
+	}
+	s.apiKey = cfg.APIKey
+	if s.endpoint = strings.TrimRight(cfg.Endpoint, "/"); s.endpoint == "" {
+		s.endpoint = sendgridEndpoint
+	}
+	s.cli, s.suppression = newHTTPClient(cfg.Timeout), cfg.Suppression
+	instance = s
+	return
+}
+
+type sendgridAddress struct {
+	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
+}
+
+type sendgridContent struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type sendgridAttachment struct {
+	Content     string `json:"content"`
+	Type        string `json:"type"`
+	Filename    string `json:"filename"`
+	Disposition string `json:"disposition"`
+	ContentId   string `json:"content_id,omitempty"`
+}
+
+type sendgridMail struct {
+	Personalizations []struct {
+		To  []sendgridAddress `json:"to,omitempty"`
+		Cc  []sendgridAddress `json:"cc,omitempty"`
+		Bcc []sendgridAddress `json:"bcc,omitempty"`
+	} `json:"personalizations"`
+	From        sendgridAddress      `json:"from"`
+	ReplyToList []sendgridAddress    `json:"reply_to_list,omitempty"`
+	Subject     string               `json:"subject"`
+	Content     []sendgridContent    `json:"content"`
+	Attachments []sendgridAttachment `json:"attachments,omitempty"`
+	Headers     map[string]string    `json:"headers,omitempty"`
+}
+
+func sendgridAddresses(list []mail.Address) []sendgridAddress {
+	if len(list) == 0 {
+		return nil
+	}
+	as := make([]sendgridAddress, len(list))
+	for i, a := range list {
+		as[i] = sendgridAddress{Email: a.Address, Name: a.Name}
+	}
+	return as
+}
+
+// Send returns X-Message-Id
+func (s *SendGridMailer) Send(m *Message) (id string, err error) {
+	if err = m.Validate(); err != nil {
+		return
+	}
+	if m, err = suppress(m, s.suppression); err != nil {
+		return
+	}
+	body := sendgridMail{
+		From:        sendgridAddress{Email: m.From.Address, Name: m.From.Name},
+		ReplyToList: sendgridAddresses(m.ReplyTo),
+		Subject:     m.Subject,
+		Headers:     m.Headers,
+	}
+	body.Personalizations = make([]struct {
+		To  []sendgridAddress `json:"to,omitempty"`
+		Cc  []sendgridAddress `json:"cc,omitempty"`
+		Bcc []sendgridAddress `json:"bcc,omitempty"`
+	}, 1)
+	p := &body.Personalizations[0]
+	p.To, p.Cc, p.Bcc = sendgridAddresses(m.To), sendgridAddresses(m.Cc), sendgridAddresses(m.Bcc)
+	//text/plain must be the first
+	if m.Text != "" {
+		body.Content = append(body.Content, sendgridContent{Type: "text/plain", Value: m.Text})
+	}
+	if m.HTML != "" {
+		body.Content = append(body.Content, sendgridContent{Type: "text/html", Value: m.HTML})
+	}
+	for _, a := range m.Attachments {
+		body.Attachments = append(body.Attachments, sendgridAttachment{
+			Content: base64.StdEncoding.EncodeToString(a.Data), Type: a.contentType(), Filename: a.Filename, Disposition: "attachment",
+		})
+	}
+	for _, a := range m.Inlines {
+		body.Attachments = append(body.Attachments, sendgridAttachment{
+			Content: base64.StdEncoding.EncodeToString(a.Data), Type: a.contentType(), Filename: a.Filename, Disposition: "inline", ContentId: a.contentId(),
+		})
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return
+	}
+	req, err := http.NewRequest(http.MethodPost, s.endpoint+"/v3/mail/send", bytes.NewReader(data))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+	resp, data, err := sendHTTP(s.cli, req)
+	if err != nil {
+		return
+	}
+	if resp.StatusCode/100 != 2 {
+		var e struct {
+			Errors []struct {
+				Message string `json:"message"`
+				Field   string `json:"field"`
+			} `json:"errors"`
+		}
+		if json.Unmarshal(data, &e) == nil && len(e.Errors) != 0 {
+			err = fmt.Errorf("sendgrid(%d): %s %s", resp.StatusCode, e.Errors[0].Field, e.Errors[0].Message)
+		} else {
+			err = &HTTPError{StatusCode: resp.StatusCode, Body: string(data)}
+		}
+		return
+	}
+	id = resp.Header.Get("X-Message-Id")
+	return
+}
+
+func (s *SendGridMailer) SupportBy() string {
+	return "sendgrid"
+}
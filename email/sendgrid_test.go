@@ -0,0 +1,78 @@
+package email
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+func testAttachments(m *Message) *Message {
+	m.ReplyTo = []mail.Address{{Address: "support@example.com"}}
+	m.Headers = map[string]string{"X-Campaign": "welcome"}
+	m.Attachments = []Attachment{{Filename: "a.csv", Data: []byte("1,2")}}
+	m.Inlines = []Attachment{{Filename: "logo.png", ContentId: "logo", Data: []byte("png")}}
+	return m
+}
+
+func TestSendGridMailer(t *testing.T) {
+	var got sendgridMail
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v3/mail/send" || r.Header.Get("Authorization") != "Bearer key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"errors":[{"message":"The provided authorization grant is invalid","field":null}]}`))
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		if got.Subject == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"errors":[{"message":"The subject is required","field":"subject"}]}`))
+			return
+		}
+		w.Header().Set("X-Message-Id", "sg-1")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	m, err := Using("sendgrid", Config{APIKey: "key", Endpoint: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := m.Send(testAttachments(testMessage()))
+	if err != nil || id != "sg-1" {
+		t.Fatal(id, err)
+	}
+	p := got.Personalizations[0]
+	if p.To[0].Email != "bob@example.com" || p.To[0].Name != "Bob" || p.Cc[0].Email != "cora@example.com" || p.Bcc[0].Email != "dan@example.com" {
+		t.Fatalf("%+v", p)
+	}
+	if got.From.Name != "gutil" || got.ReplyToList[0].Email != "support@example.com" || got.Headers["X-Campaign"] != "welcome" {
+		t.Fatalf("%+v", got)
+	}
+	if len(got.Content) != 2 || got.Content[0].Type != "text/plain" || got.Content[1].Value != "Hello <b>Bob</b>" {
+		t.Fatalf("%+v", got.Content)
+	}
+	a, in := got.Attachments[0], got.Attachments[1]
+	if data, _ := base64.StdEncoding.DecodeString(a.Content); string(data) != "1,2" || a.Type != "text/csv; charset=utf-8" || a.Disposition != "attachment" {
+		t.Fatalf("%+v", a)
+	}
+	if in.Disposition != "inline" || in.ContentId != "logo" || in.Type != "image/png" {
+		t.Fatalf("%+v", in)
+	}
+
+	msg := testMessage()
+	msg.Subject = ""
+	if _, err = m.Send(msg); err == nil || !strings.Contains(err.Error(), "subject is required") {
+		t.Fatal("need api error", err)
+	}
+	m, _ = Using("sendgrid", Config{APIKey: "bad", Endpoint: srv.URL})
+	if _, err = m.Send(testMessage()); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Fatal("need auth error", err)
+	}
+	if _, err = Using("sendgrid", Config{}); err == nil {
+		t.Fatal("need api key error")
+	}
+}
@@ -0,0 +1,182 @@
+package email
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SESMailer sends raw MIME message by SES v2 api, APIKey: access key id, APISecret: secret access key
+type SESMailer struct {
+	accessKeyId  string
+	accessSecret string
+	sessionToken string
+	region       string
+	dkim         *DKIMSigner
+	suppression  SuppressionList
+	endpoint     string
+	cli          *http.Client
+	now          func() time.Time
+}
+
+// InitMailer Options["session_token"] for temporary credentials
+func (s *SESMailer) InitMailer(cfg Config) (instance Mailer, err error) {
+	if cfg.APIKey == "" || cfg.APISecret == "" {
+		err = errors.New("lost access key")
+		return
+	}
+	if cfg.Region == "" {
+		err = errors.New("lost region")
+		return
+	}
+	s.accessKeyId, s.accessSecret, s.region = cfg.APIKey, cfg.APISecret, cfg.Region
+	s.sessionToken, s.dkim, s.suppression = cfg.Options["session_token"], cfg.DKIM, cfg.Suppression
+	if s.endpoint = strings.TrimRight(cfg.Endpoint, "/"); s.endpoint == "" {
+		s.endpoint = "https://email." + cfg.Region + ".amazonaws.com"
+	}
+	s.cli = newHTTPClient(cfg.Timeout)
+	s.now = time.Now
+	instance = s
+	return
+}
+
+// Send returns MessageId of SES
+func (s *SESMailer) Send(m *Message) (id string, err error) {
+	if err = m.Validate(); err != nil {
+		return
+	}
+	m.ensureId() //before suppress, the caller's message keeps Message-ID of the raw message
+	if m, err = suppress(m, s.suppression); err != nil {
+		return
+	}
+	raw, err := signMessage(m, s.dkim)
+	if err != nil {
+		return
+	}
+	var body struct {
+		FromEmailAddress string
+		Destination      struct {
+			ToAddresses  []string `json:",omitempty"`
+			CcAddresses  []string `json:",omitempty"`
+			BccAddresses []string `json:",omitempty"`
+		}
+		Content struct {
+			Raw struct {
+				Data []byte //base64 by json
+			}
+		}
+	}
+	body.FromEmailAddress = m.From.Address
+	body.Destination.ToAddresses = addressStrings(m.To)
+	body.Destination.CcAddresses = addressStrings(m.Cc)
+	body.Destination.BccAddresses = addressStrings(m.Bcc)
+	body.Content.Raw.Data = raw
+	data, err := json.Marshal(body)
+	if err != nil {
+		return
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.endpoint+"/v2/email/outbound-emails", bytes.NewReader(data))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.sessionToken)
+	}
+	sigV4(req, data, s.accessKeyId, s.accessSecret, s.region, "ses", s.now())
+	resp, data, err := sendHTTP(s.cli, req)
+	if err != nil {
+		return
+	}
+	var r struct {
+		MessageId string
+		Message   string `json:"message"`
+	}
+	if resp.StatusCode/100 != 2 {
+		if json.Unmarshal(data, &r) == nil && r.Message != "" {
+			err = fmt.Errorf("ses %s(%d): %s", resp.Header.Get("X-Amzn-ErrorType"), resp.StatusCode, r.Message)
+		} else {
+			err = &HTTPError{StatusCode: resp.StatusCode, Body: string(data)}
+		}
+		return
+	}
+	if err = json.Unmarshal(data, &r); err != nil {
+		return
+	}
+	id = r.MessageId
+	return
+}
+
+func (s *SESMailer) SupportBy() string {
+	return "ses"
+}
+
+func addressStrings(list []mail.Address) []string {
+	vs := make([]string, len(list))
+	for i, a := range list {
+		vs[i] = a.Address
+	}
+	return vs
+}
+
+// sigV4 signs request by AWS Signature Version 4, host, x-amz-* and content-type headers are signed
+func sigV4(req *http.Request, payload []byte, accessKeyId, secret, region, service string, t time.Time) {
+	t = t.UTC()
+	amzDate, date := t.Format("20060102T150405Z"), t.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, vs := range req.Header {
+		if lk := strings.ToLower(k); lk == "content-type" || strings.HasPrefix(lk, "x-amz-") {
+			headers[lk] = strings.TrimSpace(strings.Join(vs, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	query := strings.Replace(req.URL.Query().Encode(), "+", "%20", -1)
+	payloadHash := sha256.Sum256(payload)
+	canonical := strings.Join([]string{
+		req.Method, path, query, canonicalHeaders.String(), signedHeaders, hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	canonicalHash := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secret), date)
+	for _, s := range []string{region, service, "aws4_request"} {
+		key = hmacSHA256(key, s)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKeyId, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,79 @@
+package email
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+// get-vanilla of aws signature v4 test suite
+func TestSigV4(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	sigV4(req, nil, "AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "us-east-1", "service",
+		time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, " +
+		"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Fatal(got)
+	}
+}
+
+func TestSESMailer(t *testing.T) {
+	var (
+		body struct {
+			FromEmailAddress string
+			Destination      struct{ ToAddresses, CcAddresses, BccAddresses []string }
+			Content          struct{ Raw struct{ Data []byte } }
+		}
+		auth string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		data, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(data, &body)
+		if r.URL.Path != "/v2/email/outbound-emails" || r.Header.Get("X-Amz-Security-Token") != "token" {
+			w.Header().Set("X-Amzn-ErrorType", "BadRequestException")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"message":"bad request"}`))
+			return
+		}
+		w.Write([]byte(`{"MessageId":"ses-1"}`))
+	}))
+	defer srv.Close()
+
+	m, err := Using("ses", Config{APIKey: "AKID", APISecret: "secret", Region: "us-west-2", Endpoint: srv.URL,
+		Options: map[string]string{"session_token": "token"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.(*SESMailer).now = func() time.Time { return time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC) }
+	id, err := m.Send(testAttachments(testMessage()))
+	if err != nil || id != "ses-1" {
+		t.Fatal(id, err)
+	}
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/20200102/us-west-2/ses/aws4_request, SignedHeaders=content-type;host;x-amz-date;x-amz-security-token, Signature=") {
+		t.Fatal(auth)
+	}
+	if body.FromEmailAddress != "noreply@example.com" || body.Destination.BccAddresses[0] != "dan@example.com" {
+		t.Fatalf("%+v", body)
+	}
+	raw, err := mail.ReadMessage(bytes.NewReader(body.Content.Raw.Data))
+	if err != nil || raw.Header.Get("Subject") != "Hello!" || raw.Header.Get("Bcc") != "" ||
+		!strings.HasPrefix(raw.Header.Get("Content-Type"), "multipart/mixed") {
+		t.Fatal(raw.Header, err)
+	}
+
+	m, _ = Using("ses", Config{APIKey: "AKID", APISecret: "secret", Region: "us-west-2", Endpoint: srv.URL})
+	if _, err = m.Send(testMessage()); err == nil || !strings.Contains(err.Error(), "BadRequestException") {
+		t.Fatal("need api error", err)
+	}
+	if _, err = Using("ses", Config{APIKey: "AKID", APISecret: "secret"}); err == nil {
+		t.Fatal("need region error")
+	}
+}
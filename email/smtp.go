@@ -0,0 +1,233 @@
+package email
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SMTPMailer sends message by a new connection each time
+type SMTPMailer struct {
+	host      string
+	addr      string
+	username  string
+	password  string
+	auth      string //plain, login
+	tlsMode   TLSMode
+	tlsConfig *tls.Config
+	localName string
+	dkim      *DKIMSigner
+
+	suppression SuppressionList
+	dialTimeout time.Duration
+	timeout     time.Duration
+}
+
+// InitMailer Options["auth"]: plain(default), login
+func (s *SMTPMailer) InitMailer(cfg Config) (instance Mailer, err error) {
+	if cfg.Host == "" {
+		err = errors.New("lost smtp host")
+		return
+	}
+	s.host, s.username, s.password = cfg.Host, cfg.Username, cfg.Password
+	if s.tlsMode = cfg.TLS; s.tlsMode == "" {
+		s.tlsMode = TLSStartTLS
+		if cfg.Port == 465 {
+			s.tlsMode = TLSImplicit
+		}
+	}
+	port := cfg.Port
+	switch s.tlsMode {
+	case TLSImplicit:
+		if port == 0 {
+			port = 465
+		}
+	case TLSStartTLS:
+		if port == 0 {
+			port = 587
+		}
+	case TLSNone:
+		if port == 0 {
+			port = 25
+		}
+	default:
+		err = fmt.Errorf("invalid tls mode %s", cfg.TLS)
+		return
+	}
+	s.addr = net.JoinHostPort(cfg.Host, strconv.Itoa(port))
+
+	if cfg.TLSConfig != nil {
+		s.tlsConfig = cfg.TLSConfig.Clone()
+	} else {
+		s.tlsConfig = &tls.Config{}
+	}
+	if s.tlsConfig.ServerName == "" {
+		s.tlsConfig.ServerName = cfg.Host
+	}
+	switch s.auth = strings.ToLower(cfg.Options["auth"]); s.auth {
+	case "":
+		s.auth = "plain"
+	case "plain", "login":
+	default:
+		err = fmt.Errorf("unsupported auth %s", s.auth)
+		return
+	}
+	s.dkim, s.suppression = cfg.DKIM, cfg.Suppression
+	if s.localName = cfg.LocalName; s.localName == "" {
+		s.localName = "localhost"
+	}
+	if s.dialTimeout = cfg.DialTimeout; s.dialTimeout <= 0 {
+		s.dialTimeout = 10 * time.Second
+	}
+	if s.timeout = cfg.Timeout; s.timeout <= 0 {
+		s.timeout = time.Minute
+	}
+	instance = s
+	return
+}
+
+func (s *SMTPMailer) Send(m *Message) (id string, err error) {
+	if err = m.Validate(); err != nil {
+		return
+	}
+	id = m.ensureId() //before suppress, the caller's message keeps the sent id
+	if m, err = suppress(m, s.suppression); err != nil {
+		return
+	}
+	data, err := signMessage(m, s.dkim)
+	if err != nil {
+		return
+	}
+	c, err := s.dial()
+	if err != nil {
+		return
+	}
+	defer c.close()
+	if err = c.send(m.From.Address, m.Recipients(), data, s.timeout); err != nil {
+		return
+	}
+	err = c.client.Quit()
+	return
+}
+
+func (s *SMTPMailer) SupportBy() string {
+	return "smtp"
+}
+
+// smtpConn is a connection after hello, tls and auth
+type smtpConn struct {
+	conn   net.Conn
+	client *smtp.Client
+}
+
+func (s *SMTPMailer) dial() (c *smtpConn, err error) {
+	conn, err := (&net.Dialer{Timeout: s.dialTimeout}).Dial("tcp", s.addr)
+	if err != nil {
+		return
+	}
+	if s.tlsMode == TLSImplicit {
+		conn = tls.Client(conn, s.tlsConfig)
+	}
+	conn.SetDeadline(time.Now().Add(s.timeout))
+	client, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	c = &smtpConn{conn: conn, client: client}
+	if err = s.handshake(c); err != nil {
+		c.close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return
+}
+
+func (s *SMTPMailer) handshake(c *smtpConn) (err error) {
+	if err = c.client.Hello(s.localName); err != nil {
+		return
+	}
+	if s.tlsMode == TLSStartTLS {
+		if ok, _ := c.client.Extension("STARTTLS"); !ok {
+			return errors.New("smtp server doesn't support STARTTLS")
+		}
+		if err = c.client.StartTLS(s.tlsConfig); err != nil {
+			return
+		}
+	}
+	if s.username == "" {
+		return
+	}
+	if ok, _ := c.client.Extension("AUTH"); !ok {
+		return errors.New("smtp server doesn't support AUTH")
+	}
+	var auth smtp.Auth
+	if s.auth == "login" {
+		auth = &loginAuth{username: s.username, password: s.password}
+	} else {
+		auth = smtp.PlainAuth("", s.username, s.password, s.host)
+	}
+	return c.client.Auth(auth)
+}
+
+// send a message, the connection could be reused if err is *textproto.Error
+func (c *smtpConn) send(from string, rcpts []string, data []byte, timeout time.Duration) (err error) {
+	c.conn.SetDeadline(time.Now().Add(timeout))
+	defer c.conn.SetDeadline(time.Time{})
+	defer func() {
+		if err != nil {
+			c.client.Reset()
+		}
+	}()
+	if err = c.client.Mail(from); err != nil {
+		return
+	}
+	for _, rcpt := range rcpts {
+		if err = c.client.Rcpt(rcpt); err != nil {
+			return
+		}
+	}
+	w, err := c.client.Data()
+	if err != nil {
+		return
+	}
+	if _, err = w.Write(data); err != nil {
+		w.Close()
+		return
+	}
+	return w.Close()
+}
+
+func (c *smtpConn) close() error {
+	return c.client.Close()
+}
+
+// loginAuth is AUTH LOGIN used by some servers, e.g. outlook
+type loginAuth struct {
+	username, password string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && server.Name != "localhost" && server.Name != "127.0.0.1" && server.Name != "::1" {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:":
+		return []byte(a.username), nil
+	case "password:":
+		return []byte(a.password), nil
+	}
+	return nil, fmt.Errorf("unexpected server challenge %q", fromServer)
+}
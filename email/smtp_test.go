@@ -0,0 +1,341 @@
+package email
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"math/big"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeMail struct {
+	From string
+	To   []string
+	Data []byte
+}
+
+// fakeSMTP is a local smtp server, accepting any mail
+type fakeSMTP struct {
+	ln       net.Listener
+	tls      *tls.Config
+	implicit bool
+	startTLS bool
+	user     string
+	pass     string
+	// rcptReply returns reply of RCPT, "" for 250
+	rcptReply func(rcpt string) string
+
+	mu    sync.Mutex
+	mails []fakeMail
+	conns int
+	noops int
+	open  []net.Conn
+}
+
+// testTLS returns config of server and client with a self-signed certificate
+func testTLS(t *testing.T) (server, client *tls.Config) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	server = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	client = &tls.Config{RootCAs: pool}
+	return
+}
+
+func newFakeSMTP(t *testing.T, f *fakeSMTP) *fakeSMTP {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.implicit {
+		ln = tls.NewListener(ln, f.tls)
+	}
+	f.ln = ln
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			f.mu.Lock()
+			f.conns++
+			f.open = append(f.open, conn)
+			f.mu.Unlock()
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeSMTP) config(tlsMode TLSMode) Config {
+	host, port, _ := net.SplitHostPort(f.ln.Addr().String())
+	p, _ := strconv.Atoi(port)
+	return Config{Host: host, Port: p, TLS: tlsMode, Username: f.user, Password: f.pass, Timeout: 5 * time.Second}
+}
+
+// drop closes all connections
+func (f *fakeSMTP) drop() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, c := range f.open {
+		c.Close()
+	}
+	f.open = nil
+}
+
+func (f *fakeSMTP) stats() (conns, noops int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.conns, f.noops
+}
+
+func (f *fakeSMTP) received() []fakeMail {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]fakeMail(nil), f.mails...)
+}
+
+func (f *fakeSMTP) serve(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	_, isTLS := conn.(*tls.Conn)
+	tp.PrintfLine("220 fake ESMTP")
+	var cur fakeMail
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd, arg := strings.ToUpper(line), ""
+		if i := strings.IndexByte(line, ' '); i > 0 {
+			cmd, arg = strings.ToUpper(line[:i]), line[i+1:]
+		}
+		switch cmd {
+		case "EHLO", "HELO":
+			lines := []string{"fake", "8BITMIME"}
+			if f.startTLS && !isTLS {
+				lines = append(lines, "STARTTLS")
+			}
+			if f.user != "" {
+				lines = append(lines, "AUTH PLAIN LOGIN")
+			}
+			for i, l := range lines {
+				sep := "-"
+				if i == len(lines)-1 {
+					sep = " "
+				}
+				tp.PrintfLine("250%s%s", sep, l)
+			}
+		case "STARTTLS":
+			tp.PrintfLine("220 ready")
+			tc := tls.Server(conn, f.tls)
+			if tc.Handshake() != nil {
+				return
+			}
+			conn, isTLS = tc, true
+			tp = textproto.NewConn(conn)
+		case "AUTH":
+			parts := strings.Fields(arg)
+			var user, pass string
+			if strings.ToUpper(parts[0]) == "PLAIN" && len(parts) == 2 {
+				b, _ := base64.StdEncoding.DecodeString(parts[1])
+				if fs := strings.Split(string(b), "\x00"); len(fs) == 3 {
+					user, pass = fs[1], fs[2]
+				}
+			} else {
+				read := func(prompt string) string {
+					tp.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte(prompt)))
+					l, _ := tp.ReadLine()
+					b, _ := base64.StdEncoding.DecodeString(l)
+					return string(b)
+				}
+				user, pass = read("Username:"), read("Password:")
+			}
+			if user == f.user && pass == f.pass {
+				tp.PrintfLine("235 authenticated")
+			} else {
+				tp.PrintfLine("535 authentication failed")
+			}
+		case "MAIL":
+			cur = fakeMail{From: angleAddr(arg)}
+			tp.PrintfLine("250 ok")
+		case "RCPT":
+			rcpt := angleAddr(arg)
+			if f.rcptReply != nil {
+				if reply := f.rcptReply(rcpt); reply != "" {
+					tp.PrintfLine("%s", reply)
+					continue
+				}
+			}
+			cur.To = append(cur.To, rcpt)
+			tp.PrintfLine("250 ok")
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+			if cur.Data, err = tp.ReadDotBytes(); err != nil {
+				return
+			}
+			f.mu.Lock()
+			f.mails = append(f.mails, cur)
+			f.mu.Unlock()
+			tp.PrintfLine("250 ok queued")
+		case "RSET":
+			cur = fakeMail{}
+			tp.PrintfLine("250 ok")
+		case "NOOP":
+			f.mu.Lock()
+			f.noops++
+			f.mu.Unlock()
+			tp.PrintfLine("250 ok")
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			return
+		default:
+			tp.PrintfLine("502 unsupported")
+		}
+	}
+}
+
+// angleAddr returns address in "FROM:<a@b> BODY=8BITMIME"
+func angleAddr(arg string) string {
+	i, j := strings.IndexByte(arg, '<'), strings.IndexByte(arg, '>')
+	if i < 0 || j < i {
+		return ""
+	}
+	return arg[i+1 : j]
+}
+
+func testMessage() *Message {
+	return &Message{
+		From:    mail.Address{Name: "gutil", Address: "noreply@example.com"},
+		To:      []mail.Address{{Name: "Bob", Address: "bob@example.com"}},
+		Cc:      []mail.Address{{Address: "cora@example.com"}},
+		Bcc:     []mail.Address{{Address: "dan@example.com"}},
+		Subject: "Hello!",
+		Text:    "Hello Bob",
+		HTML:    "Hello <b>Bob</b>",
+	}
+}
+
+func TestSMTPMailer(t *testing.T) {
+	serverTLS, clientTLS := testTLS(t)
+	for _, c := range []struct {
+		mode   TLSMode
+		server *fakeSMTP
+		auth   string
+	}{
+		{TLSStartTLS, &fakeSMTP{tls: serverTLS, startTLS: true, user: "user", pass: "123456"}, ""},
+		{TLSImplicit, &fakeSMTP{tls: serverTLS, implicit: true, user: "user", pass: "123456"}, "login"},
+		{TLSNone, &fakeSMTP{}, ""},
+	} {
+		f := newFakeSMTP(t, c.server)
+		defer f.ln.Close()
+		cfg := f.config(c.mode)
+		cfg.TLSConfig = clientTLS
+		cfg.Options = map[string]string{"auth": c.auth}
+		m, err := Using("smtp", cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg := testMessage()
+		id, err := m.Send(msg)
+		if err != nil {
+			t.Fatal(c.mode, err)
+		}
+		mails := f.received()
+		if len(mails) != 1 || mails[0].From != "noreply@example.com" || strings.Join(mails[0].To, ",") != "bob@example.com,cora@example.com,dan@example.com" {
+			t.Fatalf("%s: %+v", c.mode, mails)
+		}
+		parsed, err := mail.ReadMessage(bufio.NewReader(strings.NewReader(string(mails[0].Data))))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed.Header.Get("Message-ID") != id || parsed.Header.Get("Subject") != "Hello!" || parsed.Header.Get("Bcc") != "" {
+			t.Fatalf("%s: %v", c.mode, parsed.Header)
+		}
+	}
+}
+
+func TestSMTPMailerErrors(t *testing.T) {
+	serverTLS, clientTLS := testTLS(t)
+	f := newFakeSMTP(t, &fakeSMTP{tls: serverTLS, startTLS: true, user: "user", pass: "123456"})
+	defer f.ln.Close()
+
+	//wrong password
+	cfg := f.config(TLSStartTLS)
+	cfg.TLSConfig, cfg.Password = clientTLS, "x"
+	m, _ := Using("smtp", cfg)
+	if _, err := m.Send(testMessage()); err == nil || !strings.Contains(err.Error(), "535") {
+		t.Fatal("need auth error", err)
+	}
+
+	//rejected recipient
+	f.rcptReply = func(rcpt string) string {
+		if rcpt == "cora@example.com" {
+			return "550 no such user"
+		}
+		return ""
+	}
+	cfg.Password = "123456"
+	m, _ = Using("smtp", cfg)
+	if _, err := m.Send(testMessage()); err == nil || !strings.Contains(err.Error(), "no such user") {
+		t.Fatal("need rcpt error", err)
+	}
+	if len(f.received()) != 0 {
+		t.Fatal("need no mail")
+	}
+
+	//STARTTLS is required
+	plain := newFakeSMTP(t, &fakeSMTP{})
+	defer plain.ln.Close()
+	m, _ = Using("smtp", plain.config(TLSStartTLS))
+	if _, err := m.Send(testMessage()); err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Fatal("need starttls error", err)
+	}
+
+	//invalid message
+	msg := testMessage()
+	msg.To, msg.Cc, msg.Bcc = nil, nil, nil
+	if _, err := m.Send(msg); err != ErrorMailNoRecipient {
+		t.Fatal("need recipient error", err)
+	}
+
+	//dial timeout
+	cfg = Config{Host: "127.0.0.1", Port: 1, TLS: TLSNone, DialTimeout: time.Second}
+	m, _ = Using("smtp", cfg)
+	if _, err := m.Send(testMessage()); err == nil {
+		t.Fatal("need dial error")
+	}
+	if _, err := Using("smtp", Config{Host: "localhost", TLS: "ssl"}); err == nil {
+		t.Fatal("need tls mode error")
+	}
+}
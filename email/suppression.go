@@ -0,0 +1,105 @@
+package email
+
+import (
+	"errors"
+	"net/mail"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrorMailSuppressed = errors.New("all recipients are suppressed")
+
+// SuppressionList is checked by mailers before sending, suppressed recipients are skipped.
+// Addresses are lower cased
+type SuppressionList interface {
+	Suppressed(address string) bool
+	Suppress(address string, reason string) error
+}
+
+// Suppression of an address
+type Suppression struct {
+	Reason string
+	Time   time.Time
+}
+
+// MemorySuppressionList is a SuppressionList in memory
+type MemorySuppressionList struct {
+	mu   sync.RWMutex
+	list map[string]Suppression
+}
+
+func NewMemorySuppressionList() *MemorySuppressionList {
+	return &MemorySuppressionList{list: make(map[string]Suppression)}
+}
+
+func (l *MemorySuppressionList) Suppressed(address string) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	_, has := l.list[strings.ToLower(address)]
+	return has
+}
+
+func (l *MemorySuppressionList) Suppress(address string, reason string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.list[strings.ToLower(address)] = Suppression{Reason: reason, Time: time.Now()}
+	return nil
+}
+
+// Remove removes address, e.g. the user fixed the mailbox
+func (l *MemorySuppressionList) Remove(address string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.list, strings.ToLower(address))
+}
+
+// List returns a copy of suppressions
+func (l *MemorySuppressionList) List() map[string]Suppression {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	list := make(map[string]Suppression, len(l.list))
+	for k, v := range l.list {
+		list[k] = v
+	}
+	return list
+}
+
+// SuppressReports adds recipients of hard bounces and complaints to list, returns the added addresses
+func SuppressReports(list SuppressionList, reports []Report) (added []string, err error) {
+	for _, r := range reports {
+		if !r.Hard() || r.Recipient == "" {
+			continue
+		}
+		reason := string(r.Type) + ": " + string(r.Category)
+		if r.Status != "" {
+			reason += " " + r.Status
+		}
+		if err = list.Suppress(r.Recipient, reason); err != nil {
+			return
+		}
+		added = append(added, strings.ToLower(r.Recipient))
+	}
+	return
+}
+
+// suppress returns a copy of message without suppressed recipients
+func suppress(m *Message, list SuppressionList) (*Message, error) {
+	if list == nil {
+		return m, nil
+	}
+	filter := func(in []mail.Address) (out []mail.Address) {
+		for _, a := range in {
+			if !list.Suppressed(strings.ToLower(a.Address)) {
+				out = append(out, a)
+			}
+		}
+		return
+	}
+	c := *m
+	c.To, c.Cc, c.Bcc = filter(m.To), filter(m.Cc), filter(m.Bcc)
+	if len(c.To)+len(c.Cc)+len(c.Bcc) == 0 {
+		return nil, ErrorMailSuppressed
+	}
+	return &c, nil
+}
@@ -0,0 +1,61 @@
+package email
+
+import (
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+func TestSuppressReports(t *testing.T) {
+	list := NewMemorySuppressionList()
+	reports, _ := ParseReports(parseFile(t, "testdata/inbound/bounce.eml"))
+	complaints, _ := ParseReports(parseFile(t, "testdata/inbound/complaint.eml"))
+	added, err := SuppressReports(list, append(reports, complaints...))
+	if err != nil || len(added) != 2 || added[0] != "bob@example.com" || added[1] != "eve@isp.example" {
+		t.Fatal(added, err)
+	}
+	if !list.Suppressed("BOB@example.com") || list.Suppressed("dan@example.org") || list.Suppressed("cora@example.org") {
+		t.Fatal(list.List())
+	}
+	if s := list.List()["bob@example.com"]; s.Reason != "bounce: unknown_user 5.1.1" || s.Time.IsZero() {
+		t.Fatalf("%+v", s)
+	}
+	list.Remove("bob@example.com")
+	if list.Suppressed("bob@example.com") {
+		t.Fatal("need removed")
+	}
+}
+
+func TestSuppressedRecipients(t *testing.T) {
+	f := newFakeSMTP(t, &fakeSMTP{})
+	defer f.ln.Close()
+	list := NewMemorySuppressionList()
+	list.Suppress("Cora@example.com", "test")
+	list.Suppress("dan@example.com", "test")
+	cfg := f.config(TLSNone)
+	cfg.Suppression = list
+	m, err := Using("smtp", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := testMessage()
+	id, err := m.Send(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mails := f.received()
+	if len(mails) != 1 || len(mails[0].To) != 1 || mails[0].To[0] != "bob@example.com" {
+		t.Fatalf("%+v", mails)
+	}
+	if len(msg.Cc) != 1 {
+		t.Fatal("message should not be changed")
+	}
+	if id == "" || msg.MessageId != id || !strings.Contains(string(mails[0].Data), "Message-ID: "+id) {
+		t.Fatal("sent id should be kept by the message", id, msg.MessageId)
+	}
+	msg.To = []mail.Address{{Address: "dan@example.com"}}
+	msg.Cc, msg.Bcc = nil, nil
+	if _, err = m.Send(msg); err != ErrorMailSuppressed {
+		t.Fatal("need suppressed error", err)
+	}
+}
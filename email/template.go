@@ -0,0 +1,182 @@
+package email
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"html/template"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var ErrorMailNoTemplate = errors.New("template is not found")
+
+// Templates renders named html templates with shared layouts and locale variants.
+//
+// A layout defines named templates, e.g. {{define "base"}}<html>{{template "content" .}}</html>{{end}},
+// a page calls the layout and defines blocks, e.g. {{template "base" .}}{{define "content"}}Hi {{.Name}}{{end}},
+// and the optional "subject" block is used as subject of message
+type Templates struct {
+	DefaultLocale string //fallback locale, "" for pages without locale
+	InlineCSS     bool   //inline <style> rules into elements, default true
+
+	mu      sync.RWMutex
+	funcs   template.FuncMap
+	layouts []string
+	sources map[string]string //name.locale: source
+	pages   map[string]*template.Template
+}
+
+// Rendered content of a page
+type Rendered struct {
+	Subject string
+	HTML    string
+	Text    string //generated from HTML
+}
+
+func NewTemplates(funcs template.FuncMap) *Templates {
+	return &Templates{
+		InlineCSS: true,
+		funcs:     funcs,
+		sources:   make(map[string]string),
+		pages:     make(map[string]*template.Template),
+	}
+}
+
+// LoadTemplates loads layouts from dir/layouts/*.html, and pages from dir/name.html or dir/name.locale.html
+func LoadTemplates(dir string, funcs template.FuncMap) (t *Templates, err error) {
+	t = NewTemplates(funcs)
+	layouts, err := filepath.Glob(filepath.Join(dir, "layouts", "*.html"))
+	if err != nil {
+		return
+	}
+	for _, f := range layouts {
+		var src []byte
+		if src, err = ioutil.ReadFile(f); err != nil {
+			return
+		}
+		if err = t.AddLayout(string(src)); err != nil {
+			return nil, fmt.Errorf("%s: %v", f, err)
+		}
+	}
+	pages, err := filepath.Glob(filepath.Join(dir, "*.html"))
+	if err != nil {
+		return
+	}
+	for _, f := range pages {
+		var src []byte
+		if src, err = ioutil.ReadFile(f); err != nil {
+			return
+		}
+		name, locale := strings.TrimSuffix(filepath.Base(f), ".html"), ""
+		if i := strings.IndexByte(name, '.'); i > 0 {
+			name, locale = name[:i], name[i+1:]
+		}
+		if err = t.Add(name, locale, string(src)); err != nil {
+			return nil, fmt.Errorf("%s: %v", f, err)
+		}
+	}
+	return
+}
+
+// AddLayout adds shared templates, pages are parsed again
+func (t *Templates) AddLayout(src string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, err := template.New("").Funcs(t.funcs).Parse(src); err != nil {
+		return err
+	}
+	t.layouts = append(t.layouts, src)
+	for key, src := range t.sources {
+		page, err := t.parse(src)
+		if err != nil {
+			t.layouts = t.layouts[:len(t.layouts)-1]
+			return fmt.Errorf("%s: %v", key, err)
+		}
+		t.pages[key] = page
+	}
+	return nil
+}
+
+// Add adds or replaces page of locale, "" for default
+func (t *Templates) Add(name, locale, src string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	page, err := t.parse(src)
+	if err != nil {
+		return err
+	}
+	key := name + "." + strings.ToLower(locale)
+	t.sources[key], t.pages[key] = src, page
+	return nil
+}
+
+func (t *Templates) parse(src string) (page *template.Template, err error) {
+	page = template.New("page").Funcs(t.funcs)
+	for _, l := range t.layouts {
+		if _, err = page.Parse(l); err != nil {
+			return
+		}
+	}
+	//the page body replaces the empty body of layouts
+	_, err = page.Parse(src)
+	return
+}
+
+// lookup tries locale "zh-cn", language "zh", DefaultLocale then ""
+func (t *Templates) lookup(name, locale string) *template.Template {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	locale = strings.ToLower(strings.Replace(locale, "_", "-", -1))
+	candidates := []string{locale}
+	if i := strings.IndexByte(locale, '-'); i > 0 {
+		candidates = append(candidates, locale[:i])
+	}
+	candidates = append(candidates, strings.ToLower(t.DefaultLocale), "")
+	for _, l := range candidates {
+		if page, has := t.pages[name+"."+l]; has {
+			return page
+		}
+	}
+	return nil
+}
+
+// Render executes page of locale with data
+func (t *Templates) Render(name, locale string, data interface{}) (r *Rendered, err error) {
+	page := t.lookup(name, locale)
+	if page == nil {
+		err = fmt.Errorf("%w: %s", ErrorMailNoTemplate, name)
+		return
+	}
+	r = &Rendered{}
+	var b bytes.Buffer
+	if sub := page.Lookup("subject"); sub != nil {
+		if err = sub.Execute(&b, data); err != nil {
+			return nil, err
+		}
+		// subject is escaped as html, unescape it for header
+		r.Subject = strings.TrimSpace(textSpaces.ReplaceAllString(html.UnescapeString(b.String()), " "))
+		b.Reset()
+	}
+	if err = page.Execute(&b, data); err != nil {
+		return nil, err
+	}
+	r.HTML = b.String()
+	if t.InlineCSS {
+		if r.HTML, err = InlineCSS(r.HTML); err != nil {
+			return nil, err
+		}
+	}
+	if r.Text, err = HTMLToText(r.HTML); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// Apply sets subject and bodies of message
+func (r *Rendered) Apply(m *Message) {
+	m.Subject, m.HTML, m.Text = r.Subject, r.HTML, r.Text
+}
@@ -0,0 +1,127 @@
+package email
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+type welcomeData struct {
+	Name string
+	Link string
+}
+
+func TestTemplates(t *testing.T) {
+	tpl, err := LoadTemplates("testdata/templates", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := welcomeData{Name: "Bob & <Cora>", Link: "https://example.com/confirm?id=1"}
+	r, err := tpl.Render("welcome", "en-US", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Subject != "Welcome, Bob & <Cora>!" {
+		t.Fatal(r.Subject)
+	}
+	for _, want := range []string{
+		"Hi Bob &amp; &lt;Cora&gt;,",
+		`<body style="font-family: Arial; color: #333">`,
+		`style="color: #eee; background: #07c"`, //inline style wins
+		`<p class="note" style="font-size: 12px">`,
+		"a:hover { color: red }",
+		"@media (max-width: 600px)",
+	} {
+		if !strings.Contains(r.HTML, want) {
+			t.Fatalf("lost %q in\n%s", want, r.HTML)
+		}
+	}
+	if strings.Contains(r.HTML, ".btn { color") {
+		t.Fatal("inlined rule is kept", r.HTML)
+	}
+	wantText := "gutil\n\nHi Bob & <Cora>,\n\nPlease confirm your email (https://example.com/confirm?id=1).\n\n- fast\n- simple\n\nYou received this email because you signed up."
+	if r.Text != wantText {
+		t.Fatalf("%q", r.Text)
+	}
+
+	//locale variants
+	r, err = tpl.Render("welcome", "zh_CN", data)
+	if err != nil || r.Subject != "欢迎，Bob & <Cora>" || !strings.Contains(r.Text, "请验证邮箱 (https://example.com/confirm?id=1)。") {
+		t.Fatalf("%+v %v", r, err)
+	}
+	if _, err = tpl.Render("reset", "en", data); !errors.Is(err, ErrorMailNoTemplate) {
+		t.Fatal("need no template error", err)
+	}
+	tpl.DefaultLocale = "zh"
+	if r, _ = tpl.Render("welcome", "fr", data); !strings.HasPrefix(r.Subject, "欢迎") {
+		t.Fatal("need default locale", r.Subject)
+	}
+}
+
+func TestTemplatesAdd(t *testing.T) {
+	tpl := NewTemplates(nil)
+	tpl.InlineCSS = false
+	if err := tpl.Add("reset", "", `{{template "base" .}}{{define "content"}}code {{.}}{{end}}`); err != nil {
+		t.Fatal(err)
+	}
+	//layout is added after page
+	if err := tpl.AddLayout(`{{define "base"}}<div>{{template "content" .}}</div>{{end}}`); err != nil {
+		t.Fatal(err)
+	}
+	r, err := tpl.Render("reset", "", "1234")
+	if err != nil || r.HTML != "<div>code 1234</div>" || r.Text != "code 1234" || r.Subject != "" {
+		t.Fatalf("%+v %v", r, err)
+	}
+	if err = tpl.Add("bad", "", `{{template "base" .}`); err == nil {
+		t.Fatal("need parse error")
+	}
+}
+
+func TestTemplateMessage(t *testing.T) {
+	tpl, _ := LoadTemplates("testdata/templates", nil)
+	r, err := tpl.Render("welcome", "", welcomeData{Name: "Bob", Link: "https://example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := testMessage()
+	r.Apply(m)
+	data, err := m.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Header.Get("Subject") != "Welcome, Bob!" {
+		t.Fatal(parsed.Header.Get("Subject"))
+	}
+	mt, params, _ := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if mt != "multipart/alternative" {
+		t.Fatal(mt)
+	}
+	mr := multipart.NewReader(parsed.Body, params["boundary"])
+	var parts []string
+	for {
+		p, err := mr.NextPart()
+		if err != nil {
+			break
+		}
+		body, _ := ioutil.ReadAll(p)
+		body = bytes.Replace(body, []byte("\r\n"), []byte("\n"), -1)
+		ct, _, _ := mime.ParseMediaType(p.Header.Get("Content-Type"))
+		parts = append(parts, ct)
+		if ct == "text/plain" && string(body) != r.Text || ct == "text/html" && string(body) != r.HTML {
+			t.Fatalf("%s: %q", ct, body)
+		}
+	}
+	//the preferred part is the last
+	if strings.Join(parts, ",") != "text/plain,text/html" {
+		t.Fatal(parts)
+	}
+}
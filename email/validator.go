@@ -0,0 +1,312 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"golang.org/x/net/idna"
+	"net"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	ErrorAddressSyntax     = errors.New("invalid email address")
+	ErrorAddressDisposable = errors.New("disposable email domain")
+	ErrorAddressNoMX       = errors.New("email domain doesn't accept mail")
+)
+
+// MXResolver looks up mail servers, implemented by *net.Resolver
+type MXResolver interface {
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// NormalizeRule of local part for domains of a mail provider
+type NormalizeRule struct {
+	Domains      []string
+	Canonical    string //domain after normalizing, "" for unchanged, e.g. googlemail.com to gmail.com
+	TagSeparator string //"+": bob+news to bob, "" for keeping tags
+	RemoveDots   bool   //b.o.b to bob
+	Lowercase    bool
+}
+
+var (
+	GmailRule   = NormalizeRule{Domains: []string{"gmail.com", "googlemail.com"}, Canonical: "gmail.com", TagSeparator: "+", RemoveDots: true, Lowercase: true}
+	OutlookRule = NormalizeRule{Domains: []string{"outlook.com", "hotmail.com", "live.com", "msn.com"}, TagSeparator: "+", Lowercase: true}
+	YahooRule   = NormalizeRule{Domains: []string{"yahoo.com", "ymail.com"}, TagSeparator: "-", Lowercase: true}
+	// DefaultNormalizeRules are used by NewValidator
+	DefaultNormalizeRules = []NormalizeRule{GmailRule, OutlookRule, YahooRule}
+)
+
+// Validator checks syntax(RFC 5322 addr-spec), disposable domains and optionally mail servers of address,
+// internationalized domains are converted to punycode
+type Validator struct {
+	AllowUTF8Local  bool //allow non-ascii local part of SMTPUTF8(RFC 6531)
+	AllowIPDomain   bool //allow domain literal, e.g. bob@[192.0.2.1]
+	CheckDisposable bool //default true
+	CheckMX         bool //default false
+	Resolver        MXResolver
+	Timeout         time.Duration //of mx lookup, default 5 seconds
+	// Rules normalize local part by domain, nil for lower casing domain only
+	Rules []NormalizeRule
+	// DefaultRule is used for domains without rule, nil for keeping local part
+	DefaultRule *NormalizeRule
+
+	mu         sync.RWMutex
+	disposable map[string]bool
+}
+
+func NewValidator() *Validator {
+	v := &Validator{
+		CheckDisposable: true,
+		Resolver:        net.DefaultResolver,
+		Timeout:         5 * time.Second,
+		Rules:           DefaultNormalizeRules,
+		disposable:      make(map[string]bool, len(disposableDomains)),
+	}
+	v.AddDisposable(disposableDomains...)
+	return v
+}
+
+// AddDisposable adds domains to disposable list
+func (v *Validator) AddDisposable(domains ...string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.disposable == nil {
+		v.disposable = make(map[string]bool)
+	}
+	for _, d := range domains {
+		if d, err := idna.Lookup.ToASCII(strings.TrimSpace(d)); err == nil && d != "" {
+			v.disposable[d] = true
+		}
+	}
+}
+
+// IsDisposable checks domain and its parent domains
+func (v *Validator) IsDisposable(domain string) bool {
+	domain, err := idna.Lookup.ToASCII(domain)
+	if err != nil {
+		return false
+	}
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	for {
+		if v.disposable[domain] {
+			return true
+		}
+		i := strings.IndexByte(domain, '.')
+		if i < 0 {
+			return false
+		}
+		domain = domain[i+1:]
+	}
+}
+
+// Validate returns normalized address, errors are ErrorAddressSyntax, ErrorAddressDisposable,
+// ErrorAddressNoMX, or error of resolver which means the check is unknown
+func (v *Validator) Validate(addr string) (normalized string, err error) {
+	local, domain, err := v.split(addr)
+	if err != nil {
+		return
+	}
+	if v.CheckDisposable && v.IsDisposable(domain) {
+		err = fmt.Errorf("%w: %s", ErrorAddressDisposable, domain)
+		return
+	}
+	if v.CheckMX && !strings.HasPrefix(domain, "[") {
+		if err = v.checkMX(domain); err != nil {
+			return
+		}
+	}
+	return v.normalize(local, domain), nil
+}
+
+// Normalize returns normalized address by rules without checking disposable domains and mail servers
+func (v *Validator) Normalize(addr string) (normalized string, err error) {
+	local, domain, err := v.split(addr)
+	if err != nil {
+		return
+	}
+	return v.normalize(local, domain), nil
+}
+
+func (v *Validator) normalize(local, domain string) string {
+	rule := v.DefaultRule
+	for i := range v.Rules {
+		for _, d := range v.Rules[i].Domains {
+			if strings.EqualFold(d, domain) {
+				rule = &v.Rules[i]
+			}
+		}
+	}
+	if rule == nil || strings.HasPrefix(local, `"`) {
+		return local + "@" + domain
+	}
+	if rule.TagSeparator != "" {
+		if i := strings.Index(local, rule.TagSeparator); i > 0 {
+			local = local[:i]
+		}
+	}
+	if rule.RemoveDots {
+		local = strings.Replace(local, ".", "", -1)
+	}
+	if rule.Lowercase {
+		local = strings.ToLower(local)
+	}
+	if rule.Canonical != "" {
+		domain = rule.Canonical
+	}
+	return local + "@" + domain
+}
+
+// split checks syntax, returns local part and lower cased ascii domain
+func (v *Validator) split(addr string) (local, domain string, err error) {
+	syntax := func(reason string) error {
+		return fmt.Errorf("%w: %s", ErrorAddressSyntax, reason)
+	}
+	if !utf8.ValidString(addr) {
+		err = syntax("invalid utf-8")
+		return
+	}
+	i := strings.LastIndexByte(addr, '@')
+	if i <= 0 || i == len(addr)-1 {
+		err = syntax("lost local part or domain")
+		return
+	}
+	local, domain = addr[:i], addr[i+1:]
+	if len(local) > 64 {
+		err = syntax("local part is longer than 64")
+		return
+	}
+	if err = v.checkLocal(local); err != nil {
+		err = syntax(err.Error())
+		return
+	}
+
+	if strings.HasPrefix(domain, "[") {
+		if !v.AllowIPDomain || !strings.HasSuffix(domain, "]") {
+			err = syntax("domain literal is not allowed")
+			return
+		}
+		ip := strings.TrimSuffix(domain[1:], "]")
+		if len(ip) > 5 && strings.EqualFold(ip[:5], "IPv6:") {
+			ip = ip[5:]
+			if net.ParseIP(ip) == nil || !strings.Contains(ip, ":") {
+				err = syntax("invalid ipv6 literal")
+			}
+		} else if p := net.ParseIP(ip); p == nil || p.To4() == nil {
+			err = syntax("invalid ipv4 literal")
+		}
+		return local, strings.ToLower(domain), err
+	}
+	if domain, err = idna.Lookup.ToASCII(domain); err != nil {
+		err = syntax("invalid domain: " + err.Error())
+		return
+	}
+	if len(domain) > 253 || len(local)+1+len(domain) > 254 {
+		err = syntax("address is too long")
+		return
+	}
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		err = syntax("domain needs a top level domain")
+		return
+	}
+	for _, l := range labels {
+		if l == "" || len(l) > 63 || l[0] == '-' || l[len(l)-1] == '-' {
+			err = syntax("invalid domain label " + l)
+			return
+		}
+		for _, c := range l {
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+				err = syntax("invalid domain label " + l)
+				return
+			}
+		}
+	}
+	if strings.Trim(labels[len(labels)-1], "0123456789") == "" {
+		err = syntax("numeric top level domain")
+	}
+	return
+}
+
+const atext = "!#$%&'*+-/=?^_`{|}~"
+
+// checkLocal checks dot-atom or quoted-string
+func (v *Validator) checkLocal(local string) error {
+	if strings.HasPrefix(local, `"`) {
+		if len(local) < 2 || !strings.HasSuffix(local, `"`) {
+			return errors.New("unterminated quoted local part")
+		}
+		q := local[1 : len(local)-1]
+		for i := 0; i < len(q); i++ {
+			c := q[i]
+			switch {
+			case c == '\\':
+				if i++; i == len(q) || q[i] < 32 && q[i] != '\t' || q[i] == 127 {
+					return errors.New("invalid quoted pair")
+				}
+			case c == '"' || c < 32 && c != '\t' || c == 127:
+				return errors.New("invalid character in quoted local part")
+			case c >= 128 && !v.AllowUTF8Local:
+				return errors.New("non-ascii local part")
+			}
+		}
+		return nil
+	}
+	for _, atom := range strings.Split(local, ".") {
+		if atom == "" {
+			return errors.New("empty atom in local part")
+		}
+		for _, c := range atom {
+			switch {
+			case c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune(atext, c):
+			case c >= 128 && v.AllowUTF8Local:
+			default:
+				return fmt.Errorf("invalid character %q in local part", c)
+			}
+		}
+	}
+	return nil
+}
+
+// checkMX checks MX records, or address records as implicit MX(RFC 5321), null MX(RFC 7505) is rejected
+func (v *Validator) checkMX(domain string) error {
+	resolver := v.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	timeout := v.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	mxs, err := resolver.LookupMX(ctx, domain)
+	if err != nil && !isNotFound(err) {
+		return err
+	}
+	if len(mxs) == 1 && (mxs[0].Host == "." || mxs[0].Host == "") {
+		return fmt.Errorf("%w: null mx of %s", ErrorAddressNoMX, domain)
+	}
+	if len(mxs) != 0 {
+		return nil
+	}
+	hosts, err := resolver.LookupHost(ctx, domain)
+	if err != nil && !isNotFound(err) {
+		return err
+	}
+	if len(hosts) == 0 {
+		return fmt.Errorf("%w: %s", ErrorAddressNoMX, domain)
+	}
+	return nil
+}
+
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
@@ -0,0 +1,140 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+)
+
+// fakeResolver answers from maps, other names are not found
+type fakeResolver struct {
+	mx    map[string][]*net.MX
+	hosts map[string][]string
+	err   error
+}
+
+func (r *fakeResolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	if mx, has := r.mx[name]; has {
+		return mx, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+func (r *fakeResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if hosts, has := r.hosts[host]; has {
+		return hosts, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+func TestValidatorSyntax(t *testing.T) {
+	v := NewValidator()
+	for _, addr := range []string{
+		"bob@example.com",
+		"Bob.Smith+news@example.co.uk",
+		"!#$%&'*+-/=?^_`{|}~@example.com",
+		`"bob smith"@example.com`,
+		`"a\"b@c"@example.com`,
+		"bob@xn--bcher-kva.example",
+		"bob@Bücher.example",
+	} {
+		if _, err := v.Validate(addr); err != nil {
+			t.Fatal(addr, err)
+		}
+	}
+	for _, addr := range []string{
+		"", "bob", "@example.com", "bob@", "bob@@example.com",
+		".bob@example.com", "bob.@example.com", "b..ob@example.com",
+		"bob smith@example.com", `"bob@example.com`, "bob@localhost",
+		"bob@-example.com", "bob@example-.com", "bob@exa_mple.com", "bob@example..com",
+		"bob@example.123", "bob@[192.0.2.1]", "böb@example.com",
+		"Bob <bob@example.com>",
+		"aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa@example.com",
+	} {
+		if _, err := v.Validate(addr); !errors.Is(err, ErrorAddressSyntax) {
+			t.Fatal(addr, err)
+		}
+	}
+
+	v.AllowIPDomain, v.AllowUTF8Local = true, true
+	for _, addr := range []string{"bob@[192.0.2.1]", "bob@[IPv6:2001:db8::1]", "böb@example.com"} {
+		if _, err := v.Validate(addr); err != nil {
+			t.Fatal(addr, err)
+		}
+	}
+	for _, addr := range []string{"bob@[IPv6:192.0.2.1]", "bob@[2001:db8::1]", "bob@[300.0.0.1]"} {
+		if _, err := v.Validate(addr); !errors.Is(err, ErrorAddressSyntax) {
+			t.Fatal(addr, err)
+		}
+	}
+}
+
+func TestValidatorNormalize(t *testing.T) {
+	v := NewValidator()
+	for addr, want := range map[string]string{
+		"B.o.b+news@GoogleMail.com": "bob@gmail.com",
+		"Bob.Smith+x@Hotmail.com":   "bob.smith@hotmail.com",
+		"bob-shop@yahoo.com":        "bob@yahoo.com",
+		"Bob+news@Example.com":      "Bob+news@example.com",
+		`"B.o.b+x"@gmail.com`:       `"B.o.b+x"@gmail.com`,
+		"bob@Bücher.example":        "bob@xn--bcher-kva.example",
+		"+news@gmail.com":           "+news@gmail.com",
+	} {
+		if got, err := v.Normalize(addr); err != nil || got != want {
+			t.Fatal(addr, got, err)
+		}
+	}
+	v.Rules = nil
+	v.DefaultRule = &NormalizeRule{TagSeparator: "+", Lowercase: true}
+	if got, _ := v.Normalize("B.o.b+news@GMAIL.com"); got != "b.o.b@gmail.com" {
+		t.Fatal(got)
+	}
+}
+
+func TestValidatorDisposable(t *testing.T) {
+	v := NewValidator()
+	for _, addr := range []string{"bob@mailinator.com", "bob@x.Mailinator.com", "bob@yopmail.fr"} {
+		if _, err := v.Validate(addr); !errors.Is(err, ErrorAddressDisposable) {
+			t.Fatal(addr, err)
+		}
+	}
+	v.AddDisposable("throwaway.example")
+	if !v.IsDisposable("a.throwaway.example") || v.IsDisposable("example.com") || v.IsDisposable("notmailinator.com") {
+		t.Fatal("wrong disposable check")
+	}
+	v.CheckDisposable = false
+	if _, err := v.Validate("bob@mailinator.com"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidatorMX(t *testing.T) {
+	r := &fakeResolver{
+		mx: map[string][]*net.MX{
+			"example.com":           {{Host: "mx.example.com.", Pref: 10}},
+			"null.example":          {{Host: ".", Pref: 0}},
+			"xn--bcher-kva.example": {{Host: "mx.example.com.", Pref: 10}},
+		},
+		hosts: map[string][]string{"implicit.example": {"192.0.2.1"}},
+	}
+	v := NewValidator()
+	v.CheckMX, v.Resolver = true, r
+	for _, addr := range []string{"bob@example.com", "bob@implicit.example", "bob@bücher.example"} {
+		if _, err := v.Validate(addr); err != nil {
+			t.Fatal(addr, err)
+		}
+	}
+	for _, addr := range []string{"bob@null.example", "bob@nowhere.example"} {
+		if _, err := v.Validate(addr); !errors.Is(err, ErrorAddressNoMX) {
+			t.Fatal(addr, err)
+		}
+	}
+	r.err = &net.DNSError{Err: "i/o timeout", Name: "example.com", IsTimeout: true}
+	if _, err := v.Validate("bob@example.com"); err == nil || errors.Is(err, ErrorAddressNoMX) {
+		t.Fatal("need resolver error", err)
+	}
+}
@@ -10,6 +10,7 @@ require (
 	github.com/casbin/casbin/v2 v2.1.2
 	github.com/dchest/captcha v0.0.0-20170622155422-6a29415a8364
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible
+	github.com/emersion/go-msgauth v0.5.0
 	github.com/ethereum/go-ethereum v1.9.11
 	github.com/globalsign/mgo v0.0.0-20181015135952-eeefdecb41b8
 	github.com/go-redis/redis v6.15.6+incompatible
@@ -18,6 +19,7 @@ require (
 	github.com/shopspring/decimal v0.0.0-20200105231215-408a2507e114
 	github.com/streadway/amqp v1.0.0
 	go.uber.org/zap v1.15.0
+	golang.org/x/net v0.0.0-20190628185345-da137c7871d7
 	gopkg.in/alexcesaro/quotedprintable.v3 v3.0.0-20150716171945-2caba252f4dc // indirect
 	gopkg.in/gomail.v2 v2.0.0-20160411212932-81ebce5c23df
 	xorm.io/xorm v0.8.0
@@ -6,11 +6,12 @@ import (
 	"fmt"
 	"github.com/globalsign/mgo"
 	"github.com/go-redis/redis"
-	"github.com/streadway/amqp"
 	"go.uber.org/zap"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 type ZapSinkRedisQueue struct {
@@ -45,6 +46,21 @@ func (s ZapSinkRedisQueue) Write(p []byte) (n int, err error) {
 	return
 }
 
+// WriteBatch pushes entries by a pipeline
+func (s ZapSinkRedisQueue) WriteBatch(entries [][]byte) error {
+	_, err := s.cli.Pipelined(func(pipe redis.Pipeliner) error {
+		for _, p := range entries {
+			if s.fromLeft {
+				pipe.LPush(s.queue, string(p))
+			} else {
+				pipe.RPush(s.queue, string(p))
+			}
+		}
+		return nil
+	})
+	return err
+}
+
 func NewZapSinkRedisQueue(url *url.URL) (sink zap.Sink, err error) {
 	if url.Host == "" {
 		err = errors.New("lost redis host")
@@ -82,137 +98,122 @@ func NewZapSinkRedisQueue(url *url.URL) (sink zap.Sink, err error) {
 		Password: query.Get("password"),
 		DB:       db,
 	})
-	if _, err = s.cli.Ping().Result(); err != nil {
-		return
-	}
-	if err == redis.Nil {
-		err = errors.New("redis error")
+	if err = s.cli.Ping().Err(); err != nil {
+		//the client connects again when writing, failed entries could be spooled by SpoolZapSink
+		sinkError(nil, fmt.Errorf("log sink of redis is unreachable: %v", err))
 	}
-	return s, err
-}
-
-type ZapSinkRabbitMQ struct {
-	con       *amqp.Connection
-	ch        *amqp.Channel
-	errorChan chan *amqp.Error
-
-	levelKey     string
-	exchangeName string
+	return s, nil
 }
 
-func (s ZapSinkRabbitMQ) Sync() error {
-	return nil
-}
+// ZapSinkMongo dials mongodb on the first write, so it can be created while mongodb is unreachable.
+// Concurrent writes share one dial, and writes fail with the last error until the backoff passes,
+// so a writer is blocked by at most one dial
+type ZapSinkMongo struct {
+	DialTimeout time.Duration //default 10 seconds, option dial_timeout in url
+	Backoff     time.Duration //delay of dialing again after a failure, doubled each time, default 1 second, option backoff
+	MaxBackoff  time.Duration //default 30 seconds, option max_backoff
 
-func (s ZapSinkRabbitMQ) Close() error {
-	return s.closePublisher()
-}
+	collection string
+	db         string
+	dsn        string
 
-func (s ZapSinkRabbitMQ) closePublisher() error {
-	if s.con == nil || s.con.IsClosed() {
-		return nil
-	}
-	return s.con.Close()
+	mu      sync.Mutex
+	eng     *mgo.Session
+	dialing chan struct{} //closed when the dial is done
+	dialErr error
+	delay   time.Duration
+	redial  time.Time
+	closed  bool
 }
 
-func (s ZapSinkRabbitMQ) Write(p []byte) (n int, err error) {
-	//不科学
-	var m map[string]interface{}
-	if err = json.Unmarshal(p, &m); err != nil {
-		n = 0
-		return
-	}
-	key, has := m[s.levelKey]
-	if !has {
-		n, err = 0, errors.New("log lost level key")
-		return
-	}
-	if key == nil || key.(string) == "" {
-		n, err = 0, errors.New("invalid log level key")
+func (s *ZapSinkMongo) session() (eng *mgo.Session, err error) {
+	s.mu.Lock()
+	if s.eng != nil || s.closed {
+		eng, err = s.eng, s.sessionErr()
+		s.mu.Unlock()
 		return
 	}
-	err = s.ch.Publish(
-		s.exchangeName, // exchange
-		key.(string),   // routing key
-		false,          // mandatory
-		false,          // immediate
-		amqp.Publishing{
-			ContentEncoding: "utf8",
-			ContentType:     "application/json",
-			Body:            p,
-		})
-	if err != nil {
-		n = 0
-	} else {
-		n = len(p)
+	if s.dialing == nil {
+		if time.Now().Before(s.redial) {
+			err = s.dialErr
+			s.mu.Unlock()
+			return
+		}
+		s.dialing = make(chan struct{})
+		go s.dial(s.dialing)
 	}
-	return
-}
+	dialing := s.dialing
+	s.mu.Unlock()
 
-func NewZapSinkRabbitMQ(url *url.URL) (Sink zap.Sink, err error) {
-	s := &ZapSinkRabbitMQ{}
-	s.exchangeName = url.Query().Get("exchange")
-	if s.exchangeName == "" {
-		err = errors.New("lost exchange name")
-		return
-	}
-	s.levelKey = url.Query().Get("key")
-	if s.levelKey == "" {
-		err = errors.New("lost log level key name")
-		return
-	}
+	<-dialing
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.eng, s.sessionErr()
+}
 
-	s.errorChan = make(chan *amqp.Error, 1)
-	if s.con, err = amqp.Dial(url.String()); err != nil {
-		return
-	}
-	s.con.NotifyClose(s.errorChan)
-	if s.ch, err = s.con.Channel(); err != nil {
-		s.closePublisher()
-		return
-	}
-	err = s.ch.ExchangeDeclare(
-		s.exchangeName,      // name
-		amqp.ExchangeDirect, // type
-		true,                // durable
-		false,               // auto-deleted
-		false,               // internal
-		false,               // no-wait
-		nil,                 // arguments
-	)
-	if err != nil {
-		s.closePublisher()
-		return
+// sessionErr returns error if there is no session, mu must be held
+func (s *ZapSinkMongo) sessionErr() error {
+	switch {
+	case s.closed:
+		return ErrorSinkClosed
+	case s.eng == nil:
+		return s.dialErr
 	}
-	return s, nil
+	return nil
 }
 
-type ZapSinkMongo struct {
-	collection string
-	db         string
-	eng        *mgo.Session
-	clc        *mgo.Collection
+// dial runs without mu, so Sync and Close are not blocked
+func (s *ZapSinkMongo) dial(done chan struct{}) {
+	eng, err := mgo.DialWithTimeout(s.dsn, s.DialTimeout)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer close(done)
+	s.dialing = nil
+	switch {
+	case err != nil:
+		if s.delay == 0 {
+			s.delay = s.Backoff
+		} else if s.delay *= 2; s.MaxBackoff > 0 && s.delay > s.MaxBackoff {
+			s.delay = s.MaxBackoff
+		}
+		s.dialErr, s.redial = err, time.Now().Add(s.delay)
+	case s.closed:
+		eng.Close()
+	default:
+		s.eng, s.dialErr, s.delay = eng, nil, 0
+	}
 }
 
-func (s ZapSinkMongo) Sync() error {
-	return s.eng.Fsync(true)
+// Sync does nothing before connected, there is no entry written
+func (s *ZapSinkMongo) Sync() error {
+	s.mu.Lock()
+	eng := s.eng
+	s.mu.Unlock()
+	if eng == nil {
+		return nil
+	}
+	return eng.Fsync(true)
 }
 
-func (s ZapSinkMongo) Close() error {
+func (s *ZapSinkMongo) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
 	if s.eng == nil {
 		return nil
 	}
 	s.eng.Close()
+	s.eng = nil
 	return nil
 }
 
-func (s ZapSinkMongo) Write(p []byte) (n int, err error) {
+func (s *ZapSinkMongo) Write(p []byte) (n int, err error) {
 	var m map[string]interface{}
 	if err = json.Unmarshal(p, &m); err != nil {
 		n = 0
 		return
 	}
-	if err = s.clc.Insert(m); err != nil {
+	if err = s.insert(m); err != nil {
 		n = 0
 	} else {
 		n = len(p)
@@ -220,14 +221,39 @@ func (s ZapSinkMongo) Write(p []byte) (n int, err error) {
 	return
 }
 
+// WriteBatch inserts entries by one bulk insert, invalid entries are skipped
+func (s *ZapSinkMongo) WriteBatch(entries [][]byte) error {
+	docs := make([]interface{}, 0, len(entries))
+	for _, p := range entries {
+		var m map[string]interface{}
+		if json.Unmarshal(p, &m) == nil {
+			docs = append(docs, m)
+		}
+	}
+	if len(docs) == 0 {
+		return nil
+	}
+	return s.insert(docs...)
+}
+
+func (s *ZapSinkMongo) insert(docs ...interface{}) error {
+	eng, err := s.session()
+	if err != nil {
+		return err
+	}
+	if err = eng.DB(s.db).C(s.collection).Insert(docs...); err != nil {
+		eng.Refresh() //use a new socket next time, or the session keeps failing after mongodb recovers
+	}
+	return err
+}
+
 func NewZapSinkMongo(url *url.URL) (sink zap.Sink, err error) {
 	tmp := strings.Split(url.String(), "?")
 	if len(tmp) != 2 {
 		err = errors.New("invalid mongodb link")
 		return
 	}
-	dsn := tmp[0]
-	s := &ZapSinkMongo{}
+	s := &ZapSinkMongo{DialTimeout: 10 * time.Second, Backoff: time.Second, MaxBackoff: 30 * time.Second, dsn: tmp[0]}
 	//[mongodb://][user:pass@]host1[:port1][,host2[:port2],...][/database][?options]
 	s.collection = url.Query().Get("collection")
 	if s.collection == "" {
@@ -240,10 +266,13 @@ func NewZapSinkMongo(url *url.URL) (sink zap.Sink, err error) {
 		return
 	}
 
-	if s.eng, err = mgo.Dial(dsn); err != nil {
-		return
+	for key, dst := range map[string]*time.Duration{"dial_timeout": &s.DialTimeout, "backoff": &s.Backoff, "max_backoff": &s.MaxBackoff} {
+		if v := url.Query().Get(key); v != "" {
+			if *dst, err = time.ParseDuration(v); err != nil || *dst <= 0 {
+				err = fmt.Errorf("invalid %s: %s", key, v)
+				return
+			}
+		}
 	}
-	s.clc = s.eng.DB(s.db).C(s.collection)
-
 	return s, nil
 }
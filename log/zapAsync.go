@@ -0,0 +1,289 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrorSinkClosed = errors.New("log sink is closed")
+
+// SinkErrorHandler handles errors of sinks without OnError, e.g. sinks opened by zap with url.
+// Errors are printed to stderr by default, set it to nil to ignore them
+var SinkErrorHandler = func(err error) {
+	fmt.Fprintf(os.Stderr, "%v %v\n", time.Now(), err)
+}
+
+// sinkError calls onError, or SinkErrorHandler if onError is nil
+func sinkError(onError func(error), err error) {
+	if onError != nil {
+		onError(err)
+	} else if h := SinkErrorHandler; h != nil {
+		h(err)
+	}
+}
+
+// BatchWriter writes entries by one round-trip, implemented by network sinks
+type BatchWriter interface {
+	WriteBatch(entries [][]byte) error
+}
+
+// OverflowPolicy of a full queue
+type OverflowPolicy string
+
+const (
+	OverflowDropOldest OverflowPolicy = "drop_oldest"
+	OverflowDropNewest OverflowPolicy = "drop_newest"
+	OverflowBlock      OverflowPolicy = "block" //Write waits for space
+)
+
+// AsyncSink buffers entries in a bounded queue, and writes them in batches by size or interval
+type AsyncSink struct {
+	BatchSize     int            //default 100
+	FlushInterval time.Duration  //default 1 second
+	QueueSize     int            //default 10000
+	Overflow      OverflowPolicy //default drop_oldest
+	// OnError is called with failed entries by the flusher, nil for SinkErrorHandler
+	OnError func(err error, entries [][]byte)
+
+	sink zap.Sink
+	w    BatchWriter
+
+	mu      sync.Mutex
+	space   *sync.Cond
+	queue   [][]byte
+	dropped uint64
+	closed  bool
+
+	start sync.Once
+	kick  chan struct{}
+	syncs chan chan error
+	done  chan struct{}
+	exit  chan struct{}
+}
+
+// NewAsyncSink wraps sink, sink must implement BatchWriter
+func NewAsyncSink(sink zap.Sink) (s *AsyncSink, err error) {
+	w, ok := sink.(BatchWriter)
+	if !ok {
+		err = fmt.Errorf("sink %T doesn't support batch writing", sink)
+		return
+	}
+	s = &AsyncSink{
+		BatchSize:     100,
+		FlushInterval: time.Second,
+		QueueSize:     10000,
+		Overflow:      OverflowDropOldest,
+		sink:          sink,
+		w:             w,
+		kick:          make(chan struct{}, 1),
+		syncs:         make(chan chan error),
+		done:          make(chan struct{}),
+		exit:          make(chan struct{}),
+	}
+	s.space = sync.NewCond(&s.mu)
+	return
+}
+
+// AsyncZapSink wraps a sink factory for zap.RegisterSink, the sink is async if url has "async=true".
+// Options in url: async_batch, async_interval(e.g. 500ms), async_queue, async_overflow
+func AsyncZapSink(factory func(*url.URL) (zap.Sink, error)) func(*url.URL) (zap.Sink, error) {
+	return func(u *url.URL) (sink zap.Sink, err error) {
+		if sink, err = factory(u); err != nil {
+			return
+		}
+		query := u.Query()
+		if async, _ := strconv.ParseBool(query.Get("async")); !async {
+			return
+		}
+		s, err := NewAsyncSink(sink)
+		if err != nil {
+			sink.Close()
+			return nil, err
+		}
+		if err = s.parseOptions(query); err != nil {
+			sink.Close()
+			return nil, err
+		}
+		return s, nil
+	}
+}
+
+func (s *AsyncSink) parseOptions(query url.Values) (err error) {
+	for key, dst := range map[string]*int{"async_batch": &s.BatchSize, "async_queue": &s.QueueSize} {
+		if v := query.Get(key); v != "" {
+			if *dst, err = strconv.Atoi(v); err != nil || *dst <= 0 {
+				return fmt.Errorf("invalid %s: %s", key, v)
+			}
+		}
+	}
+	if v := query.Get("async_interval"); v != "" {
+		if s.FlushInterval, err = time.ParseDuration(v); err != nil || s.FlushInterval <= 0 {
+			return fmt.Errorf("invalid async_interval: %s", v)
+		}
+	}
+	if v := query.Get("async_overflow"); v != "" {
+		switch p := OverflowPolicy(strings.ToLower(v)); p {
+		case OverflowDropOldest, OverflowDropNewest, OverflowBlock:
+			s.Overflow = p
+		default:
+			return fmt.Errorf("unsupported async_overflow: %s", v)
+		}
+	}
+	return nil
+}
+
+// Write queues a copy of p, fields can't be changed after the first Write
+func (s *AsyncSink) Write(p []byte) (n int, err error) {
+	s.start.Do(s.run)
+	entry := make([]byte, len(p))
+	copy(entry, p) //zap reuses the buffer
+
+	s.mu.Lock()
+	for !s.closed && len(s.queue) >= s.QueueSize {
+		switch s.Overflow {
+		case OverflowBlock:
+			s.space.Wait()
+			continue
+		case OverflowDropNewest:
+			s.dropped++
+			s.mu.Unlock()
+			return len(p), nil
+		default:
+			s.queue[0] = nil
+			s.queue = s.queue[1:]
+			s.dropped++
+		}
+	}
+	if s.closed {
+		s.mu.Unlock()
+		return 0, ErrorSinkClosed
+	}
+	s.queue = append(s.queue, entry)
+	full := len(s.queue) >= s.BatchSize
+	s.mu.Unlock()
+
+	if full {
+		select {
+		case s.kick <- struct{}{}:
+		default:
+		}
+	}
+	return len(p), nil
+}
+
+// Sync writes all queued entries, then syncs the underlying sink
+func (s *AsyncSink) Sync() error {
+	s.start.Do(s.run)
+	res := make(chan error, 1)
+	select {
+	case s.syncs <- res:
+	case <-s.exit:
+		return ErrorSinkClosed
+	}
+	if err := <-res; err != nil {
+		return err
+	}
+	return s.sink.Sync()
+}
+
+// Close writes queued entries and closes the underlying sink
+func (s *AsyncSink) Close() error {
+	s.start.Do(s.run)
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.space.Broadcast()
+	s.mu.Unlock()
+
+	close(s.done)
+	<-s.exit
+	return s.sink.Close()
+}
+
+// Dropped returns count of entries dropped by overflow
+func (s *AsyncSink) Dropped() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+// Len returns count of queued entries
+func (s *AsyncSink) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.queue)
+}
+
+func (s *AsyncSink) run() {
+	if s.BatchSize <= 0 {
+		s.BatchSize = 100
+	}
+	if s.QueueSize <= 0 {
+		s.QueueSize = 10000
+	}
+	if s.FlushInterval <= 0 {
+		s.FlushInterval = time.Second
+	}
+	go s.flusher()
+}
+
+func (s *AsyncSink) flusher() {
+	defer close(s.exit)
+	ticker := time.NewTicker(s.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.kick:
+			s.flush(false)
+		case <-ticker.C:
+			s.flush(true)
+		case res := <-s.syncs:
+			res <- s.flush(true)
+		case <-s.done:
+			s.flush(true)
+			return
+		}
+	}
+}
+
+// flush writes full batches, and the last partial batch if all is true, returns the last error
+func (s *AsyncSink) flush(all bool) (err error) {
+	for {
+		s.mu.Lock()
+		n := len(s.queue)
+		if n == 0 || (!all && n < s.BatchSize) {
+			s.mu.Unlock()
+			return
+		}
+		if n > s.BatchSize {
+			n = s.BatchSize
+		}
+		batch := make([][]byte, n)
+		copy(batch, s.queue)
+		for i := 0; i < n; i++ {
+			s.queue[i] = nil
+		}
+		s.queue = s.queue[n:]
+		s.space.Broadcast()
+		s.mu.Unlock()
+
+		if e := s.w.WriteBatch(batch); e != nil {
+			err = e
+			if s.OnError != nil {
+				s.OnError(e, batch)
+			} else {
+				sinkError(nil, fmt.Errorf("write %d log entries failed: %v", len(batch), e))
+			}
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// batchSink records batches, fails while err is set, blocks while gate is set
+type batchSink struct {
+	mu      sync.Mutex
+	batches [][]string
+	err     error
+	gate    chan struct{}
+	syncs   int
+	closed  bool
+}
+
+func (s *batchSink) Write(p []byte) (int, error) {
+	return len(p), s.WriteBatch([][]byte{p})
+}
+
+func (s *batchSink) WriteBatch(entries [][]byte) error {
+	s.mu.Lock()
+	gate := s.gate
+	s.mu.Unlock()
+	if gate != nil {
+		<-gate
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	batch := make([]string, len(entries))
+	for i, p := range entries {
+		batch[i] = string(p)
+	}
+	s.batches = append(s.batches, batch)
+	return nil
+}
+
+func (s *batchSink) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.syncs++
+	return nil
+}
+
+func (s *batchSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+func (s *batchSink) entries() (all []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, b := range s.batches {
+		all = append(all, b...)
+	}
+	return
+}
+
+func (s *batchSink) sizes() (sizes []int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, b := range s.batches {
+		sizes = append(sizes, len(b))
+	}
+	return
+}
+
+func TestAsyncSinkBatch(t *testing.T) {
+	w := &batchSink{}
+	s, err := NewAsyncSink(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.BatchSize, s.FlushInterval = 3, time.Hour
+	buf := []byte("0")
+	for i := 0; i < 7; i++ {
+		buf[0] = byte('0' + i) //buffer is reused like zap
+		s.Write(buf)
+	}
+	//full batches are written without waiting for interval
+	for i := 0; i < 100 && len(w.entries()) < 6; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if sizes := w.sizes(); fmt.Sprint(sizes) != "[3 3]" || s.Len() != 1 {
+		t.Fatal(sizes, s.Len())
+	}
+	if err = s.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(w.entries()); got != "[0 1 2 3 4 5 6]" || w.syncs != 1 {
+		t.Fatal(got, w.syncs)
+	}
+
+	s.Write([]byte("7"))
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(w.entries()) != 8 || !w.closed {
+		t.Fatal("close should flush and close sink", w.entries())
+	}
+	if _, err = s.Write([]byte("8")); err != ErrorSinkClosed {
+		t.Fatal("need closed error", err)
+	}
+	if err = s.Sync(); err != ErrorSinkClosed {
+		t.Fatal("need closed error", err)
+	}
+}
+
+func TestAsyncSinkInterval(t *testing.T) {
+	w := &batchSink{}
+	s, _ := NewAsyncSink(w)
+	s.BatchSize, s.FlushInterval = 100, 20*time.Millisecond
+	defer s.Close()
+	s.Write([]byte("a"))
+	time.Sleep(100 * time.Millisecond)
+	if fmt.Sprint(w.entries()) != "[a]" {
+		t.Fatal(w.entries())
+	}
+}
+
+func TestAsyncSinkError(t *testing.T) {
+	w := &batchSink{err: errors.New("down")}
+	s, _ := NewAsyncSink(w)
+	var failed []string
+	s.OnError = func(err error, entries [][]byte) {
+		for _, p := range entries {
+			failed = append(failed, string(p))
+		}
+	}
+	s.Write([]byte("a"))
+	s.Write([]byte("b"))
+	if err := s.Sync(); err == nil || w.syncs != 0 {
+		t.Fatal("need write error", err)
+	}
+	if fmt.Sprint(failed) != "[a b]" {
+		t.Fatal(failed)
+	}
+	w.mu.Lock()
+	w.err = nil
+	w.mu.Unlock()
+	if err := s.Sync(); err != nil {
+		t.Fatal("error of last sync should not be kept", err)
+	}
+	s.Close()
+
+	//errors are handled by SinkErrorHandler without OnError
+	var handled []error
+	defer func(h func(error)) { SinkErrorHandler = h }(SinkErrorHandler)
+	SinkErrorHandler = func(err error) { handled = append(handled, err) }
+	w.mu.Lock()
+	w.err = errors.New("down")
+	w.mu.Unlock()
+	s, _ = NewAsyncSink(w)
+	defer s.Close()
+	s.Write([]byte("c"))
+	if err := s.Sync(); err == nil || len(handled) != 1 || !strings.Contains(handled[0].Error(), "write 1 log entries failed: down") {
+		t.Fatal(handled, err)
+	}
+}
+
+func TestAsyncSinkOverflow(t *testing.T) {
+	for _, c := range []struct {
+		policy OverflowPolicy
+		want   string
+	}{
+		{OverflowDropOldest, "[0 3 4]"},
+		{OverflowDropNewest, "[0 1 2]"},
+		{OverflowBlock, "[0 1 2 3 4]"},
+	} {
+		gate := make(chan struct{})
+		w := &batchSink{gate: gate}
+		s, _ := NewAsyncSink(w)
+		s.BatchSize, s.QueueSize, s.FlushInterval, s.Overflow = 1, 2, time.Hour, c.policy
+
+		//"0" is taken by the flusher which waits for the gate, then the queue is filled
+		s.Write([]byte("0"))
+		for s.Len() != 0 {
+			time.Sleep(time.Millisecond)
+		}
+		done := make(chan struct{})
+		go func() {
+			for i := 1; i < 5; i++ {
+				s.Write([]byte{byte('0' + i)})
+			}
+			close(done)
+		}()
+		select {
+		case <-done:
+			if c.policy == OverflowBlock {
+				t.Fatal("write should be blocked")
+			}
+		case <-time.After(50 * time.Millisecond):
+			if c.policy != OverflowBlock {
+				t.Fatal(c.policy, "write should not be blocked")
+			}
+		}
+		w.mu.Lock()
+		w.gate = nil
+		w.mu.Unlock()
+		close(gate)
+		<-done
+		s.Sync()
+		if got := fmt.Sprint(w.entries()); got != c.want {
+			t.Fatal(c.policy, got)
+		}
+		if dropped := s.Dropped(); (c.policy == OverflowBlock) != (dropped == 0) {
+			t.Fatal(c.policy, dropped)
+		}
+		s.Close()
+	}
+}
+
+func TestAsyncZapSink(t *testing.T) {
+	w := &batchSink{}
+	factory := AsyncZapSink(func(*url.URL) (zap.Sink, error) { return w, nil })
+	scheme := fmt.Sprintf("batchtest%d", time.Now().UnixNano()) //registered once per process
+	if err := zap.RegisterSink(scheme, factory); err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse("batchtest://local?async=true&async_batch=10&async_interval=1h&async_queue=50&async_overflow=block")
+	sink, err := factory(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := sink.(*AsyncSink)
+	if s.BatchSize != 10 || s.FlushInterval != time.Hour || s.QueueSize != 50 || s.Overflow != OverflowBlock {
+		t.Fatalf("%+v", s)
+	}
+	if sink, _ = factory(&url.URL{Scheme: "batchtest"}); sink != w {
+		t.Fatal("sink should not be wrapped")
+	}
+	u, _ = url.Parse("batchtest://local?async=1&async_overflow=wait")
+	if _, err = factory(u); err == nil {
+		t.Fatal("need overflow error")
+	}
+
+	cfg := zap.NewProductionConfig()
+	cfg.OutputPaths = []string{scheme + "://local?async=true&async_interval=1h"}
+	cfg.EncoderConfig = zapcore.EncoderConfig{MessageKey: "M", LineEnding: "\n"}
+	logger, err := cfg.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("one")
+	logger.Info("two")
+	if len(w.entries()) != 0 {
+		t.Fatal("should be buffered")
+	}
+	logger.Sync()
+	if got := fmt.Sprint(w.entries()); got != "[{\"M\":\"one\"}\n {\"M\":\"two\"}\n]" {
+		t.Fatal(got)
+	}
+}
@@ -0,0 +1,453 @@
+package log
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/streadway/amqp"
+	"go.uber.org/zap"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrorSinkFull = errors.New("log sink buffer is full")
+
+// ZapSinkRabbitMQ publishes entries with publisher confirms, and reconnects with backoff after the connection is lost.
+// Unconfirmed entries and entries written while disconnected are kept in a local buffer and published again,
+// so an entry could be delivered more than once. Writes fail with ErrorSinkFull if the buffer is full,
+// the failed entries could be spooled by SpoolZapSink. It connects in background after the first write,
+// so fields can be changed before writing.
+//
+// Options in url:
+//
+//	exchange: exchange name, required
+//	type: exchange type, direct(default), topic or fanout
+//	key: level key of json entry, its value is used as routing key
+//	routing_key: fixed routing key instead of level
+//	routing_prefix: prefix of level routing key, e.g. "app." for topic "app.error"
+//	buffer: max buffered entries, default 10000
+//	backoff, max_backoff: reconnecting delay, doubled each time, default 1s and 30s
+type ZapSinkRabbitMQ struct {
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+	BufferSize  int
+	SyncTimeout time.Duration //Sync waits for confirms, default 5 seconds
+	// OnError is called when the connection is failed or lost, nil for SinkErrorHandler
+	OnError func(err error)
+
+	uri           string
+	levelKey      string
+	exchangeName  string
+	exchangeType  string
+	routingKey    string
+	routingPrefix string
+
+	mu          sync.Mutex
+	changed     *sync.Cond //connected, confirmed or closed
+	con         *amqp.Connection
+	ch          *amqp.Channel
+	errorChan   chan *amqp.Error
+	nextTag     uint64
+	unconfirmed []rabbitEntry //ordered by tag
+	buffer      []rabbitEntry //waiting for connection
+	dropped     uint64
+	closed      bool
+	start       sync.Once
+	done        chan struct{}
+}
+
+type rabbitEntry struct {
+	tag  uint64
+	key  string
+	body []byte
+}
+
+func NewZapSinkRabbitMQ(url *url.URL) (Sink zap.Sink, err error) {
+	s := &ZapSinkRabbitMQ{
+		Backoff:     time.Second,
+		MaxBackoff:  30 * time.Second,
+		BufferSize:  10000,
+		SyncTimeout: 5 * time.Second,
+		uri:         url.String(),
+		done:        make(chan struct{}),
+	}
+	s.changed = sync.NewCond(&s.mu)
+	query := url.Query()
+	s.exchangeName = query.Get("exchange")
+	if s.exchangeName == "" {
+		err = errors.New("lost exchange name")
+		return
+	}
+	switch s.exchangeType = strings.ToLower(query.Get("type")); s.exchangeType {
+	case "":
+		s.exchangeType = amqp.ExchangeDirect
+	case amqp.ExchangeDirect, amqp.ExchangeTopic, amqp.ExchangeFanout:
+	default:
+		err = fmt.Errorf("unsupported exchange type: %s", s.exchangeType)
+		return
+	}
+	s.levelKey = query.Get("key")
+	s.routingKey = query.Get("routing_key")
+	s.routingPrefix = query.Get("routing_prefix")
+	if s.levelKey == "" && s.routingKey == "" && s.exchangeType != amqp.ExchangeFanout {
+		err = errors.New("lost log level key name")
+		return
+	}
+	if v := query.Get("buffer"); v != "" {
+		if s.BufferSize, err = strconv.Atoi(v); err != nil || s.BufferSize <= 0 {
+			err = fmt.Errorf("invalid buffer size: %s", v)
+			return
+		}
+	}
+	for key, dst := range map[string]*time.Duration{"backoff": &s.Backoff, "max_backoff": &s.MaxBackoff} {
+		if v := query.Get(key); v != "" {
+			if *dst, err = time.ParseDuration(v); err != nil || *dst <= 0 {
+				err = fmt.Errorf("invalid %s: %s", key, v)
+				return
+			}
+		}
+	}
+	return s, nil
+}
+
+// run connects in background, entries are buffered until connected
+func (s *ZapSinkRabbitMQ) run() {
+	go func() {
+		select {
+		case <-s.done:
+			return
+		default:
+		}
+		if err := s.connect(); err != nil {
+			s.onError(fmt.Errorf("unreachable: %v", err))
+			s.reconnect()
+		}
+	}()
+}
+
+func (s *ZapSinkRabbitMQ) onError(err error) {
+	sinkError(s.OnError, fmt.Errorf("log sink of rabbitmq is %v", err))
+}
+
+// connect dials, declares exchange, enables confirms, then publishes buffered entries
+func (s *ZapSinkRabbitMQ) connect() (err error) {
+	con, err := amqp.Dial(s.uri)
+	if err != nil {
+		return
+	}
+	ch, err := con.Channel()
+	if err != nil {
+		con.Close()
+		return
+	}
+	err = ch.ExchangeDeclare(
+		s.exchangeName, // name
+		s.exchangeType, // type
+		true,           // durable
+		false,          // auto-deleted
+		false,          // internal
+		false,          // no-wait
+		nil,            // arguments
+	)
+	if err == nil {
+		err = ch.Confirm(false)
+	}
+	if err != nil {
+		con.Close()
+		return
+	}
+	confirms := ch.NotifyPublish(make(chan amqp.Confirmation, s.BufferSize+1))
+	errorChan := con.NotifyClose(make(chan *amqp.Error, 1))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		con.Close()
+		return errors.New("sink is closed")
+	}
+	s.con, s.ch, s.errorChan, s.nextTag = con, ch, errorChan, 0
+	s.drain()
+	s.changed.Broadcast()
+	go s.watch(ch, confirms)
+	return
+}
+
+// watch handles confirms until the channel is closed, then reconnects
+func (s *ZapSinkRabbitMQ) watch(ch *amqp.Channel, confirms chan amqp.Confirmation) {
+	for c := range confirms {
+		s.confirm(ch, c)
+	}
+
+	s.mu.Lock()
+	if s.ch != ch {
+		s.mu.Unlock()
+		return
+	}
+	var reason error = amqp.ErrClosed
+	select {
+	case e := <-s.errorChan:
+		if e != nil {
+			reason = e
+		}
+	default:
+	}
+	//unconfirmed entries are published again before the buffered ones
+	entries, con := s.unconfirmed, s.con
+	s.unconfirmed = nil
+	s.con, s.ch = nil, nil
+	for _, e := range s.buffer {
+		entries = append(entries, e)
+	}
+	s.buffer = nil
+	for _, e := range entries {
+		s.bufferEntry(e)
+	}
+	closed := s.closed
+	s.changed.Broadcast()
+	s.mu.Unlock()
+
+	if !con.IsClosed() {
+		//only the channel is closed
+		con.Close()
+	}
+	if !closed {
+		s.onError(fmt.Errorf("disconnected: %v", reason))
+		s.reconnect()
+	}
+}
+
+func (s *ZapSinkRabbitMQ) reconnect() {
+	delay := s.Backoff
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-time.After(delay):
+		}
+		if err := s.connect(); err == nil {
+			return
+		}
+		if delay *= 2; s.MaxBackoff > 0 && delay > s.MaxBackoff {
+			delay = s.MaxBackoff
+		}
+	}
+}
+
+func (s *ZapSinkRabbitMQ) confirm(ch *amqp.Channel, c amqp.Confirmation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ch != ch {
+		return
+	}
+	//tags are increasing, and confirms arrive in order, so the entry is found at the head mostly
+	i := sort.Search(len(s.unconfirmed), func(i int) bool {
+		return s.unconfirmed[i].tag >= c.DeliveryTag
+	})
+	if i < len(s.unconfirmed) && s.unconfirmed[i].tag == c.DeliveryTag {
+		e := s.unconfirmed[i]
+		if i == 0 {
+			s.unconfirmed[0] = rabbitEntry{}
+			s.unconfirmed = s.unconfirmed[1:]
+		} else {
+			s.unconfirmed = append(s.unconfirmed[:i], s.unconfirmed[i+1:]...)
+		}
+		if !c.Ack {
+			//nacked by broker, publish again
+			e.tag = 0
+			s.buffer = append([]rabbitEntry{e}, s.buffer...)
+		}
+	}
+	s.drain()
+	s.changed.Broadcast()
+}
+
+// publish publishes entry, or buffers it if disconnected or too many entries are unconfirmed,
+// mu must be held
+func (s *ZapSinkRabbitMQ) publish(e rabbitEntry) {
+	if s.ch == nil || len(s.buffer) != 0 || len(s.unconfirmed) >= s.BufferSize || !s.publishNow(e) {
+		s.bufferEntry(e)
+	}
+}
+
+// drain publishes buffered entries in order, mu must be held
+func (s *ZapSinkRabbitMQ) drain() {
+	for s.ch != nil && len(s.buffer) != 0 && len(s.unconfirmed) < s.BufferSize {
+		if !s.publishNow(s.buffer[0]) {
+			return
+		}
+		s.buffer[0] = rabbitEntry{}
+		s.buffer = s.buffer[1:]
+	}
+}
+
+// publishNow returns false if the channel is closing, watch will reconnect.
+// Unconfirmed entries are limited, or the confirm listener could block the reader of connection
+func (s *ZapSinkRabbitMQ) publishNow(e rabbitEntry) bool {
+	err := s.ch.Publish(
+		s.exchangeName, // exchange
+		e.key,          // routing key
+		false,          // mandatory
+		false,          // immediate
+		amqp.Publishing{
+			ContentEncoding: "utf8",
+			ContentType:     "application/json",
+			Body:            e.body,
+		})
+	if err != nil {
+		return false
+	}
+	s.nextTag++
+	e.tag = s.nextTag
+	s.unconfirmed = append(s.unconfirmed, e)
+	return true
+}
+
+// bufferEntry appends entry to buffer, mu must be held.
+// Accepted entries are never dropped, the buffer could exceed BufferSize after unconfirmed entries are moved back
+func (s *ZapSinkRabbitMQ) bufferEntry(e rabbitEntry) {
+	e.tag = 0
+	s.buffer = append(s.buffer, e)
+}
+
+// full reports whether n entries can't be published or buffered, mu must be held
+func (s *ZapSinkRabbitMQ) full(n int) bool {
+	if s.ch != nil && len(s.buffer) == 0 {
+		n -= s.BufferSize - len(s.unconfirmed)
+	}
+	return n > 0 && len(s.buffer)+n > s.BufferSize
+}
+
+func (s *ZapSinkRabbitMQ) entry(p []byte) (e rabbitEntry, err error) {
+	e.key = s.routingKey
+	if e.key == "" && s.exchangeType != amqp.ExchangeFanout {
+		//不科学
+		var m map[string]interface{}
+		if err = json.Unmarshal(p, &m); err != nil {
+			return
+		}
+		v, has := m[s.levelKey]
+		if !has {
+			err = errors.New("log lost level key")
+			return
+		}
+		level, _ := v.(string)
+		if level == "" {
+			err = errors.New("invalid log level key")
+			return
+		}
+		e.key = s.routingPrefix + level
+	}
+	e.body = make([]byte, len(p))
+	copy(e.body, p)
+	return
+}
+
+// Write publishes p, p is buffered while disconnected, ErrorSinkFull is returned if the buffer is full
+func (s *ZapSinkRabbitMQ) Write(p []byte) (n int, err error) {
+	e, err := s.entry(p)
+	if err != nil {
+		return
+	}
+	s.start.Do(s.run)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return 0, errors.New("sink is closed")
+	}
+	if s.full(1) {
+		s.dropped++
+		return 0, ErrorSinkFull
+	}
+	s.publish(e)
+	return len(p), nil
+}
+
+// WriteBatch publishes entries in order, invalid entries are skipped.
+// No entry is accepted if the buffer can't hold all of them
+func (s *ZapSinkRabbitMQ) WriteBatch(entries [][]byte) error {
+	batch := make([]rabbitEntry, 0, len(entries))
+	for _, p := range entries {
+		if e, err := s.entry(p); err == nil {
+			batch = append(batch, e)
+		}
+	}
+	s.start.Do(s.run)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errors.New("sink is closed")
+	}
+	if s.full(len(batch)) {
+		s.dropped += uint64(len(batch))
+		return ErrorSinkFull
+	}
+	for _, e := range batch {
+		s.publish(e)
+	}
+	return nil
+}
+
+// Sync waits until all entries are confirmed, or SyncTimeout
+func (s *ZapSinkRabbitMQ) Sync() error {
+	timeout := s.SyncTimeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	expired := false
+	timer := time.AfterFunc(timeout, func() {
+		s.mu.Lock()
+		expired = true
+		s.changed.Broadcast()
+		s.mu.Unlock()
+	})
+	defer timer.Stop()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for len(s.unconfirmed)+len(s.buffer) != 0 {
+		if expired || s.closed {
+			return fmt.Errorf("%d log entries are not confirmed", len(s.unconfirmed)+len(s.buffer))
+		}
+		s.changed.Wait()
+	}
+	return nil
+}
+
+// Pending returns count of unconfirmed and buffered entries
+func (s *ZapSinkRabbitMQ) Pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.unconfirmed) + len(s.buffer)
+}
+
+// Dropped returns count of entries rejected by full buffer
+func (s *ZapSinkRabbitMQ) Dropped() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+// Close waits for confirms by Sync, then closes the connection
+func (s *ZapSinkRabbitMQ) Close() error {
+	err := s.Sync()
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+	con := s.con
+	s.changed.Broadcast()
+	s.mu.Unlock()
+	if con != nil && !con.IsClosed() {
+		if e := con.Close(); e != nil {
+			err = e
+		}
+	}
+	return err
+}
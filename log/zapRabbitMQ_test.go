@@ -0,0 +1,472 @@
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeAMQPMessage struct {
+	Exchange string
+	Key      string
+	Body     string
+}
+
+// fakeAMQP is an in-process AMQP 0-9-1 broker, supporting what the sink uses:
+// handshake, channels, exchange declaring, confirm mode and publishing
+type fakeAMQP struct {
+	addr string
+
+	mu        sync.Mutex
+	ln        net.Listener
+	conns     []net.Conn
+	dials     int
+	exchanges map[string]string //name: type
+	declares  int
+	published []fakeAMQPMessage //all received
+	acked     []fakeAMQPMessage //confirmed, as stored by broker
+	holdAcks  bool              //don't confirm, e.g. broker is slow
+	nackNext  int               //nack next publishes
+}
+
+func newFakeAMQP(t *testing.T) *fakeAMQP {
+	f := &fakeAMQP{addr: "127.0.0.1:0", exchanges: make(map[string]string)}
+	f.start(t)
+	return f
+}
+
+func (f *fakeAMQP) url(query string) *url.URL {
+	u, _ := url.Parse("amqp://guest:guest@" + f.addr + "/?" + query)
+	return u
+}
+
+// start listens on the same address after stop
+func (f *fakeAMQP) start(t *testing.T) {
+	ln, err := net.Listen("tcp", f.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.mu.Lock()
+	f.ln, f.addr = ln, ln.Addr().String()
+	f.mu.Unlock()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			f.mu.Lock()
+			f.dials++
+			f.conns = append(f.conns, conn)
+			f.mu.Unlock()
+			go f.serve(conn)
+		}
+	}()
+}
+
+// stop drops all connections like a crashed broker
+func (f *fakeAMQP) stop() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ln.Close()
+	for _, c := range f.conns {
+		c.Close()
+	}
+	f.conns = nil
+}
+
+func (f *fakeAMQP) set(fn func(f *fakeAMQP)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fn(f)
+}
+
+func (f *fakeAMQP) bodies(list *[]fakeAMQPMessage) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	bodies := make([]string, len(*list))
+	for i, m := range *list {
+		bodies[i] = m.Body
+	}
+	return strings.Join(bodies, ",")
+}
+
+type amqpArgs struct {
+	bytes.Buffer
+}
+
+func (a *amqpArgs) octet(v byte) *amqpArgs {
+	a.WriteByte(v)
+	return a
+}
+
+func (a *amqpArgs) short(v uint16) *amqpArgs {
+	binary.Write(a, binary.BigEndian, v)
+	return a
+}
+
+func (a *amqpArgs) long(v uint32) *amqpArgs {
+	binary.Write(a, binary.BigEndian, v)
+	return a
+}
+
+func (a *amqpArgs) longlong(v uint64) *amqpArgs {
+	binary.Write(a, binary.BigEndian, v)
+	return a
+}
+
+func (a *amqpArgs) shortstr(s string) *amqpArgs {
+	a.WriteByte(byte(len(s)))
+	a.WriteString(s)
+	return a
+}
+
+func (a *amqpArgs) longstr(s string) *amqpArgs {
+	a.long(uint32(len(s)))
+	a.WriteString(s)
+	return a
+}
+
+type amqpReader struct {
+	b []byte
+}
+
+func (r *amqpReader) short() uint16 {
+	v := binary.BigEndian.Uint16(r.b)
+	r.b = r.b[2:]
+	return v
+}
+
+func (r *amqpReader) octet() byte {
+	v := r.b[0]
+	r.b = r.b[1:]
+	return v
+}
+
+func (r *amqpReader) shortstr() string {
+	n := int(r.octet())
+	v := string(r.b[:n])
+	r.b = r.b[n:]
+	return v
+}
+
+func writeAMQPFrame(w io.Writer, typ byte, channel uint16, payload []byte) error {
+	var b bytes.Buffer
+	b.WriteByte(typ)
+	binary.Write(&b, binary.BigEndian, channel)
+	binary.Write(&b, binary.BigEndian, uint32(len(payload)))
+	b.Write(payload)
+	b.WriteByte(0xCE)
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+func writeAMQPMethod(w io.Writer, channel, class, method uint16, args *amqpArgs) error {
+	payload := (&amqpArgs{}).short(class).short(method)
+	if args != nil {
+		payload.Write(args.Bytes())
+	}
+	return writeAMQPFrame(w, 1, channel, payload.Bytes())
+}
+
+func (f *fakeAMQP) serve(conn net.Conn) {
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(br, header); err != nil || string(header) != "AMQP\x00\x00\x09\x01" {
+		return
+	}
+	writeAMQPMethod(conn, 0, 10, 10, (&amqpArgs{}).octet(0).octet(9).long(0).longstr("PLAIN").longstr("en_US"))
+
+	type publishing struct {
+		msg  fakeAMQPMessage
+		size uint64
+	}
+	var (
+		confirming = make(map[uint16]bool)
+		tags       = make(map[uint16]uint64)
+		pending    = make(map[uint16]*publishing)
+	)
+	for {
+		hdr := make([]byte, 7)
+		if _, err := io.ReadFull(br, hdr); err != nil {
+			return
+		}
+		channel := binary.BigEndian.Uint16(hdr[1:3])
+		payload := make([]byte, binary.BigEndian.Uint32(hdr[3:7])+1)
+		if _, err := io.ReadFull(br, payload); err != nil || payload[len(payload)-1] != 0xCE {
+			return
+		}
+		payload = payload[:len(payload)-1]
+
+		var complete *publishing
+		switch hdr[0] {
+		case 1: //method
+			r := &amqpReader{b: payload}
+			class, method := r.short(), r.short()
+			switch class<<8 | method {
+			case 10<<8 | 11: //connection.start-ok
+				writeAMQPMethod(conn, 0, 10, 30, (&amqpArgs{}).short(0).long(131072).short(0))
+			case 10<<8 | 40: //connection.open
+				writeAMQPMethod(conn, 0, 10, 41, (&amqpArgs{}).shortstr(""))
+			case 10<<8 | 50: //connection.close
+				writeAMQPMethod(conn, 0, 10, 51, nil)
+				return
+			case 20<<8 | 10: //channel.open
+				writeAMQPMethod(conn, channel, 20, 11, (&amqpArgs{}).longstr(""))
+			case 20<<8 | 40: //channel.close
+				writeAMQPMethod(conn, channel, 20, 41, nil)
+			case 40<<8 | 10: //exchange.declare
+				r.short()
+				name, typ := r.shortstr(), r.shortstr()
+				f.set(func(f *fakeAMQP) {
+					f.exchanges[name] = typ
+					f.declares++
+				})
+				if r.octet()&16 == 0 {
+					writeAMQPMethod(conn, channel, 40, 11, nil)
+				}
+			case 85<<8 | 10: //confirm.select
+				confirming[channel] = true
+				if r.octet()&1 == 0 {
+					writeAMQPMethod(conn, channel, 85, 11, nil)
+				}
+			case 60<<8 | 40: //basic.publish
+				r.short()
+				pending[channel] = &publishing{msg: fakeAMQPMessage{Exchange: r.shortstr(), Key: r.shortstr()}}
+			}
+		case 2: //content header
+			if p := pending[channel]; p != nil {
+				if p.size = binary.BigEndian.Uint64(payload[4:12]); p.size == 0 {
+					complete = p
+				}
+			}
+		case 3: //content body
+			if p := pending[channel]; p != nil {
+				p.msg.Body += string(payload)
+				if uint64(len(p.msg.Body)) >= p.size {
+					complete = p
+				}
+			}
+		}
+		if complete == nil {
+			continue
+		}
+		delete(pending, channel)
+		tags[channel]++
+		ack, hold := true, false
+		f.set(func(f *fakeAMQP) {
+			f.published = append(f.published, complete.msg)
+			if hold = f.holdAcks; hold {
+				return
+			}
+			if f.nackNext > 0 {
+				f.nackNext--
+				ack = false
+				return
+			}
+			f.acked = append(f.acked, complete.msg)
+		})
+		if !confirming[channel] || hold {
+			continue
+		}
+		if ack {
+			writeAMQPMethod(conn, channel, 60, 80, (&amqpArgs{}).longlong(tags[channel]).octet(0))
+		} else {
+			writeAMQPMethod(conn, channel, 60, 120, (&amqpArgs{}).longlong(tags[channel]).octet(0))
+		}
+	}
+}
+
+func logLine(level, msg string) []byte {
+	return []byte(fmt.Sprintf(`{"L":%q,"M":%q}`+"\n", level, msg))
+}
+
+func TestZapSinkRabbitMQConfirms(t *testing.T) {
+	f := newFakeAMQP(t)
+	defer f.stop()
+	sink, err := NewZapSinkRabbitMQ(f.url("exchange=zap&key=L&type=topic&routing_prefix=app."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	s := sink.(*ZapSinkRabbitMQ)
+	if _, err = s.Write(logLine("info", "a")); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.WriteBatch([][]byte{logLine("error", "b"), []byte("invalid"), logLine("info", "c")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Write([]byte(`{"M":"no level"}`)); err == nil {
+		t.Fatal("need level key error")
+	}
+	if err = s.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.exchanges["zap"] != "topic" || len(f.acked) != 3 {
+		t.Fatal(f.exchanges, f.acked)
+	}
+	for i, key := range []string{"app.info", "app.error", "app.info"} {
+		if m := f.acked[i]; m.Exchange != "zap" || m.Key != key {
+			t.Fatalf("%d: %+v", i, m)
+		}
+	}
+}
+
+func TestZapSinkRabbitMQReconnect(t *testing.T) {
+	f := newFakeAMQP(t)
+	defer f.stop()
+	sink, err := NewZapSinkRabbitMQ(f.url("exchange=zap&key=L&backoff=10ms&max_backoff=50ms"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	s := sink.(*ZapSinkRabbitMQ)
+	s.SyncTimeout = 100 * time.Millisecond
+
+	//a and b are received but not confirmed before the broker crashes
+	f.set(func(f *fakeAMQP) { f.holdAcks = true })
+	s.Write(logLine("info", "a"))
+	s.Write(logLine("info", "b"))
+	if err = s.Sync(); err == nil || s.Pending() != 2 {
+		t.Fatal("need unconfirmed error", err, s.Pending())
+	}
+	f.stop()
+	time.Sleep(50 * time.Millisecond)
+	if _, err = s.Write(logLine("info", "c")); err != nil {
+		t.Fatal("write should be buffered while disconnected", err)
+	}
+
+	f.set(func(f *fakeAMQP) { f.holdAcks = false })
+	f.start(t)
+	s.SyncTimeout = 5 * time.Second
+	if err = s.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	//unconfirmed entries are published again in order, before entries written while disconnected
+	if got := f.bodies(&f.acked); got != logBodies("a", "b", "c") {
+		t.Fatal(got)
+	}
+	f.mu.Lock()
+	dials, declares := f.dials, f.declares
+	f.mu.Unlock()
+	if dials != 2 || declares != 2 {
+		t.Fatal("exchange should be declared again after reconnecting", dials, declares)
+	}
+	s.Write(logLine("info", "d"))
+	if err = s.Sync(); err != nil || f.bodies(&f.acked) != logBodies("a", "b", "c", "d") {
+		t.Fatal(f.bodies(&f.acked), err)
+	}
+}
+
+func logBodies(msgs ...string) string {
+	bodies := make([]string, len(msgs))
+	for i, m := range msgs {
+		bodies[i] = string(logLine("info", m))
+	}
+	return strings.Join(bodies, ",")
+}
+
+func TestZapSinkRabbitMQNack(t *testing.T) {
+	f := newFakeAMQP(t)
+	defer f.stop()
+	sink, err := NewZapSinkRabbitMQ(f.url("exchange=zap&key=L"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	f.set(func(f *fakeAMQP) { f.nackNext = 1 })
+	sink.Write(logLine("info", "a"))
+	sink.Write(logLine("info", "b"))
+	if err = sink.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if got := f.bodies(&f.published); got != logBodies("a", "b", "a") {
+		t.Fatal(got)
+	}
+	if got := f.bodies(&f.acked); got != logBodies("b", "a") {
+		t.Fatal(got)
+	}
+}
+
+func TestZapSinkRabbitMQBuffer(t *testing.T) {
+	f := newFakeAMQP(t)
+	defer f.stop()
+	sink, err := NewZapSinkRabbitMQ(f.url("exchange=logs&type=fanout&buffer=2&backoff=10ms"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := sink.(*ZapSinkRabbitMQ)
+	var (
+		mu     sync.Mutex
+		errs   []string
+		hasErr = func(msg string) bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(errs) != 0 && strings.Contains(errs[len(errs)-1], msg)
+		}
+	)
+	s.OnError = func(err error) {
+		mu.Lock()
+		errs = append(errs, err.Error())
+		mu.Unlock()
+	}
+	//connects after the first write
+	f.stop()
+	s.Write(logLine("info", "a"))
+	waitFor(t, func() bool { return hasErr("rabbitmq is unreachable") })
+	s.Write(logLine("info", "b"))
+	if _, err = s.Write(logLine("info", "c")); err != ErrorSinkFull {
+		t.Fatal("need full error", err)
+	}
+	if err = s.WriteBatch([][]byte{logLine("info", "d")}); err != ErrorSinkFull {
+		t.Fatal("need full error", err)
+	}
+	if s.Dropped() != 2 || s.Pending() != 2 {
+		t.Fatal(s.Dropped(), s.Pending())
+	}
+	f.start(t)
+	if err = s.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if got := f.bodies(&f.acked); got != logBodies("a", "b") {
+		t.Fatal(got)
+	}
+	f.stop()
+	waitFor(t, func() bool { return hasErr("rabbitmq is disconnected") })
+	f.start(t)
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Write(logLine("info", "d")); err == nil {
+		t.Fatal("need closed error")
+	}
+	f.mu.Lock()
+	dials := f.dials
+	f.mu.Unlock()
+	time.Sleep(50 * time.Millisecond)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.dials != dials || f.exchanges["logs"] != "fanout" {
+		t.Fatal("closed sink should not reconnect", f.dials, f.exchanges)
+	}
+}
+
+func TestNewZapSinkRabbitMQOptions(t *testing.T) {
+	for _, query := range []string{"key=L", "exchange=zap", "exchange=zap&key=L&type=headers", "exchange=zap&key=L&buffer=0", "exchange=zap&key=L&backoff=x"} {
+		u, _ := url.Parse("amqp://127.0.0.1:1/?" + query)
+		if _, err := NewZapSinkRabbitMQ(u); err == nil || strings.Contains(err.Error(), "connect") {
+			t.Fatal(query, err)
+		}
+	}
+}
@@ -1,8 +1,16 @@
 package log
 
 import (
+	"bufio"
+	"fmt"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -147,3 +155,112 @@ func TestZapSinkMongo(t *testing.T) {
 	logger.Info("INFO", zap.Int("int-value", 123))
 	logger.Error("ERROR", zap.Int("int-value", 444))
 }
+
+// fakeRedis is a RESP server supporting PING, AUTH, SELECT, LPUSH, RPUSH and LRANGE 0 -1
+type fakeRedis struct {
+	ln    net.Listener
+	mu    sync.Mutex
+	lists map[string][]string
+	cmds  int
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	return listenFakeRedis(t, "127.0.0.1:0")
+}
+
+// listenFakeRedis starts fakeRedis on addr, e.g. after the sink is created
+func listenFakeRedis(t *testing.T, addr string) *fakeRedis {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &fakeRedis{ln: ln, lists: make(map[string][]string)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go r.serve(conn)
+		}
+	}()
+	return r
+}
+
+func (r *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil || !strings.HasPrefix(line, "*") {
+			return
+		}
+		n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		args := make([]string, n)
+		for i := range args {
+			if line, err = br.ReadString('\n'); err != nil {
+				return
+			}
+			size, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+			buf := make([]byte, size+2)
+			if _, err = io.ReadFull(br, buf); err != nil {
+				return
+			}
+			args[i] = string(buf[:size])
+		}
+		r.mu.Lock()
+		r.cmds++
+		var reply string
+		switch strings.ToUpper(args[0]) {
+		case "PING":
+			reply = "+PONG\r\n"
+		case "AUTH", "SELECT":
+			reply = "+OK\r\n"
+		case "LPUSH":
+			for _, v := range args[2:] {
+				r.lists[args[1]] = append([]string{v}, r.lists[args[1]]...)
+			}
+			reply = fmt.Sprintf(":%d\r\n", len(r.lists[args[1]]))
+		case "RPUSH":
+			r.lists[args[1]] = append(r.lists[args[1]], args[2:]...)
+			reply = fmt.Sprintf(":%d\r\n", len(r.lists[args[1]]))
+		case "LRANGE":
+			list := r.lists[args[1]]
+			reply = fmt.Sprintf("*%d\r\n", len(list))
+			for _, v := range list {
+				reply += fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+			}
+		default:
+			reply = "-ERR unknown command\r\n"
+		}
+		r.mu.Unlock()
+		if _, err = conn.Write([]byte(reply)); err != nil {
+			return
+		}
+	}
+}
+
+func (r *fakeRedis) list(key string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.lists[key]...)
+}
+
+func TestZapSinkRedisQueueWriteBatch(t *testing.T) {
+	r := newFakeRedis(t)
+	defer r.ln.Close()
+	for op, want := range map[string]string{"lpush": "[c b a]", "rpush": "[a b c]"} {
+		u, _ := url.Parse("redis://" + r.ln.Addr().String() + "?db=0&queue=" + op + "&op=" + op)
+		sink, err := NewZapSinkRedisQueue(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = sink.(BatchWriter).WriteBatch([][]byte{[]byte("a"), []byte("b"), []byte("c")}); err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprint(r.list(op)); got != want {
+			t.Fatal(op, got)
+		}
+		sink.Close()
+	}
+}
@@ -0,0 +1,507 @@
+package log
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	spoolExt        = ".spool"
+	spoolOffsetFile = "offset"
+)
+
+// SpoolSink writes entries to sink, and appends them to local spool files while sink fails.
+// A replayer writes spooled entries back after sink recovers, spool files are kept after Close and replayed by the next SpoolSink.
+//
+// Ordering: once an entry is spooled, later entries are spooled after it until the spool is drained,
+// so the sink receives entries in the written order.
+// Entries are delivered at least once, a replayed batch is written again if it fails partly, or the process exits before the offset is saved.
+// The oldest spool files are removed if total size exceeds MaxSize, their entries are counted by Dropped.
+// Each SpoolSink needs its own directory.
+type SpoolSink struct {
+	FileSize      int64         //spool file is rotated at this size, default 16MB
+	MaxSize       int64         //max total size of spool files, default 1GB
+	BatchSize     int           //entries replayed by one write, default 100
+	RetryInterval time.Duration //replaying interval while sink fails, default 1 second
+	// OnError is called with errors of sink and spool files, nil for SinkErrorHandler
+	OnError func(err error)
+
+	dir  string
+	sink zap.Sink
+	w    BatchWriter //nil if sink doesn't support batch writing
+
+	mu       sync.Mutex
+	files    []spoolFile //not replayed, the last one is being written
+	total    int64
+	writer   *os.File
+	reader   *os.File
+	readSeq  uint64
+	offset   int64 //replayed bytes of files[0]
+	replayed int   //replayed entries of files[0]
+	nextSeq  uint64
+	dropped  uint64
+	closed   bool
+
+	start sync.Once
+	wake  chan struct{}
+	done  chan struct{}
+	exit  chan struct{}
+}
+
+type spoolFile struct {
+	seq   uint64
+	size  int64
+	count int
+}
+
+// NewSpoolSink wraps sink with spool directory dir, spool files left in dir are replayed after the first Write
+func NewSpoolSink(sink zap.Sink, dir string) (s *SpoolSink, err error) {
+	if dir == "" {
+		err = errors.New("lost spool directory")
+		return
+	}
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return
+	}
+	s = &SpoolSink{
+		FileSize:      16 << 20,
+		MaxSize:       1 << 30,
+		BatchSize:     100,
+		RetryInterval: time.Second,
+		dir:           dir,
+		sink:          sink,
+		wake:          make(chan struct{}, 1),
+		done:          make(chan struct{}),
+		exit:          make(chan struct{}),
+	}
+	s.w, _ = sink.(BatchWriter)
+	if err = s.recover(); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// SpoolZapSink wraps a sink factory for zap.RegisterSink, entries are spooled to directory of "spool" in url while sink fails.
+// Options in url: spool_file_size, spool_max_size(bytes), spool_batch, spool_retry(e.g. 5s).
+// It could be wrapped by AsyncZapSink, e.g. AsyncZapSink(SpoolZapSink(NewZapSinkRedisQueue))
+func SpoolZapSink(factory func(*url.URL) (zap.Sink, error)) func(*url.URL) (zap.Sink, error) {
+	return func(u *url.URL) (sink zap.Sink, err error) {
+		if sink, err = factory(u); err != nil {
+			return
+		}
+		query := u.Query()
+		if query.Get("spool") == "" {
+			return
+		}
+		s, err := NewSpoolSink(sink, query.Get("spool"))
+		if err == nil {
+			err = s.parseOptions(query)
+		}
+		if err != nil {
+			sink.Close()
+			return nil, err
+		}
+		return s, nil
+	}
+}
+
+func (s *SpoolSink) parseOptions(query url.Values) (err error) {
+	for key, dst := range map[string]*int64{"spool_file_size": &s.FileSize, "spool_max_size": &s.MaxSize} {
+		if v := query.Get(key); v != "" {
+			if *dst, err = strconv.ParseInt(v, 10, 64); err != nil || *dst <= 0 {
+				return fmt.Errorf("invalid %s: %s", key, v)
+			}
+		}
+	}
+	if v := query.Get("spool_batch"); v != "" {
+		if s.BatchSize, err = strconv.Atoi(v); err != nil || s.BatchSize <= 0 {
+			return fmt.Errorf("invalid spool_batch: %s", v)
+		}
+	}
+	if v := query.Get("spool_retry"); v != "" {
+		if s.RetryInterval, err = time.ParseDuration(v); err != nil || s.RetryInterval <= 0 {
+			return fmt.Errorf("invalid spool_retry: %s", v)
+		}
+	}
+	return nil
+}
+
+// recover loads spool files and the replayed offset left by the last process
+func (s *SpoolSink) recover() (err error) {
+	names, err := filepath.Glob(filepath.Join(s.dir, "*"+spoolExt))
+	if err != nil {
+		return
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		seq, e := strconv.ParseUint(strings.TrimSuffix(filepath.Base(name), spoolExt), 10, 64)
+		if e != nil {
+			continue
+		}
+		f := spoolFile{seq: seq}
+		if f.size, f.count, err = scanSpoolFile(name); err != nil {
+			return
+		}
+		if f.count == 0 {
+			os.Remove(name)
+			continue
+		}
+		s.files = append(s.files, f)
+		s.total += f.size
+		s.nextSeq = seq
+	}
+	//offset file: seq, offset and entries of replayed
+	data, e := ioutil.ReadFile(filepath.Join(s.dir, spoolOffsetFile))
+	if e != nil || len(s.files) == 0 {
+		return nil
+	}
+	var (
+		seq    uint64
+		offset int64
+		count  int
+	)
+	if _, e = fmt.Sscan(string(data), &seq, &offset, &count); e == nil && seq == s.files[0].seq && offset <= s.files[0].size {
+		s.offset, s.replayed = offset, count
+	}
+	return nil
+}
+
+// scanSpoolFile counts entries, and truncates the partial entry written by a crash
+func scanSpoolFile(name string) (size int64, count int, err error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return
+	}
+	r := bufio.NewReader(f)
+	for {
+		var n uint32
+		if binary.Read(r, binary.BigEndian, &n) != nil {
+			break
+		}
+		if _, e := io.CopyN(ioutil.Discard, r, int64(n)); e != nil {
+			break
+		}
+		size += 4 + int64(n)
+		count++
+	}
+	info, err := f.Stat()
+	f.Close()
+	if err == nil && info.Size() > size {
+		err = os.Truncate(name, size)
+	}
+	return
+}
+
+// Write writes p to sink, or spools it
+func (s *SpoolSink) Write(p []byte) (n int, err error) {
+	if err = s.WriteBatch([][]byte{p}); err != nil {
+		return
+	}
+	return len(p), nil
+}
+
+// WriteBatch writes entries to sink if nothing is spooled, entries failed are spooled in order
+func (s *SpoolSink) WriteBatch(entries [][]byte) (err error) {
+	s.start.Do(s.run)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrorSinkClosed
+	}
+	if len(s.files) == 0 {
+		n, e := s.write(entries)
+		if e == nil {
+			return nil
+		}
+		s.report(fmt.Errorf("write log sink failed, spooling: %v", e))
+		entries = entries[n:]
+	}
+	if err = s.append(entries); err != nil {
+		return
+	}
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// write writes entries to sink, returns count of written entries
+func (s *SpoolSink) write(entries [][]byte) (n int, err error) {
+	if s.w != nil {
+		if err = s.w.WriteBatch(entries); err != nil {
+			return
+		}
+		return len(entries), nil
+	}
+	for _, p := range entries {
+		if _, err = s.sink.Write(p); err != nil {
+			return
+		}
+		n++
+	}
+	return
+}
+
+// append writes entries to spool files, mu must be held
+func (s *SpoolSink) append(entries [][]byte) (err error) {
+	for _, p := range entries {
+		n := int64(4 + len(p))
+		if n > s.MaxSize {
+			s.dropped++
+			continue
+		}
+		if s.writer == nil || (s.files[len(s.files)-1].size != 0 && s.files[len(s.files)-1].size+n > s.FileSize) {
+			if err = s.rotate(); err != nil {
+				return
+			}
+		}
+		for s.total+n > s.MaxSize && len(s.files) > 1 {
+			s.dropped += uint64(s.files[0].count - s.replayed)
+			s.removeFirst()
+		}
+		record := make([]byte, n)
+		binary.BigEndian.PutUint32(record, uint32(len(p)))
+		copy(record[4:], p)
+		last := &s.files[len(s.files)-1]
+		if _, err = s.writer.Write(record); err != nil {
+			s.writer.Truncate(last.size)
+			return
+		}
+		last.size += n
+		last.count++
+		s.total += n
+	}
+	return
+}
+
+// rotate creates a new spool file for writing, mu must be held
+func (s *SpoolSink) rotate() (err error) {
+	f, err := os.OpenFile(s.fileName(s.nextSeq+1), os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return
+	}
+	if s.writer != nil {
+		s.writer.Close()
+	}
+	s.nextSeq++
+	s.writer = f
+	s.files = append(s.files, spoolFile{seq: s.nextSeq})
+	return
+}
+
+// removeFirst removes the oldest spool file, mu must be held
+func (s *SpoolSink) removeFirst() {
+	f := s.files[0]
+	if s.reader != nil && s.readSeq == f.seq {
+		s.reader.Close()
+		s.reader = nil
+	}
+	if len(s.files) == 1 && s.writer != nil {
+		s.writer.Close()
+		s.writer = nil
+	}
+	if err := os.Remove(s.fileName(f.seq)); err != nil {
+		s.report(err)
+	}
+	s.files = s.files[1:]
+	s.total -= f.size
+	s.offset, s.replayed = 0, 0
+}
+
+func (s *SpoolSink) fileName(seq uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", seq, spoolExt))
+}
+
+func (s *SpoolSink) report(err error) {
+	sinkError(s.OnError, fmt.Errorf("log spool: %v", err))
+}
+
+func (s *SpoolSink) run() {
+	if s.FileSize <= 0 {
+		s.FileSize = 16 << 20
+	}
+	if s.MaxSize <= 0 {
+		s.MaxSize = 1 << 30
+	}
+	if s.FileSize > s.MaxSize {
+		s.FileSize = s.MaxSize
+	}
+	if s.BatchSize <= 0 {
+		s.BatchSize = 100
+	}
+	if s.RetryInterval <= 0 {
+		s.RetryInterval = time.Second
+	}
+	go s.replayer()
+}
+
+func (s *SpoolSink) replayer() {
+	defer close(s.exit)
+	for {
+		if s.replay() {
+			select {
+			case <-s.wake:
+			case <-s.done:
+				return
+			}
+			continue
+		}
+		select {
+		case <-time.After(s.RetryInterval):
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// replay writes spooled entries to sink by batches, returns true if the spool is drained
+func (s *SpoolSink) replay() bool {
+	for {
+		select {
+		case <-s.done:
+			return false
+		default:
+		}
+		s.mu.Lock()
+		seq, batch, ends, err := s.readBatch()
+		s.mu.Unlock()
+		if err != nil {
+			s.report(err)
+			return false
+		}
+		if len(batch) == 0 {
+			return true
+		}
+		n, err := s.write(batch)
+		if n != 0 {
+			s.mu.Lock()
+			s.advance(seq, ends[n-1], n)
+			s.mu.Unlock()
+		}
+		if err != nil {
+			return false
+		}
+	}
+}
+
+// readBatch reads entries from the oldest spool file, ends are offsets after each entry.
+// Replayed files are removed, mu must be held
+func (s *SpoolSink) readBatch() (seq uint64, batch [][]byte, ends []int64, err error) {
+	for len(s.files) != 0 && s.offset >= s.files[0].size {
+		s.removeFirst()
+	}
+	if len(s.files) == 0 {
+		//drained, later entries are written to sink directly
+		os.Remove(filepath.Join(s.dir, spoolOffsetFile))
+		return
+	}
+	f := s.files[0]
+	if s.reader == nil || s.readSeq != f.seq {
+		if s.reader != nil {
+			s.reader.Close()
+		}
+		if s.reader, err = os.Open(s.fileName(f.seq)); err != nil {
+			s.reader = nil
+			return
+		}
+		s.readSeq = f.seq
+	}
+	r := bufio.NewReader(io.NewSectionReader(s.reader, s.offset, f.size-s.offset))
+	offset := s.offset
+	for len(batch) < s.BatchSize && offset < f.size {
+		var n uint32
+		if err = binary.Read(r, binary.BigEndian, &n); err != nil {
+			return
+		}
+		p := make([]byte, n)
+		if _, err = io.ReadFull(r, p); err != nil {
+			return
+		}
+		offset += 4 + int64(n)
+		batch = append(batch, p)
+		ends = append(ends, offset)
+	}
+	return f.seq, batch, ends, nil
+}
+
+// advance saves the replayed offset, the file could be removed by MaxSize while replaying, mu must be held
+func (s *SpoolSink) advance(seq uint64, offset int64, count int) {
+	if len(s.files) == 0 || s.files[0].seq != seq {
+		return
+	}
+	s.offset = offset
+	s.replayed += count
+	data := fmt.Sprintf("%d %d %d", seq, s.offset, s.replayed)
+	if err := ioutil.WriteFile(filepath.Join(s.dir, spoolOffsetFile), []byte(data), 0644); err != nil {
+		s.report(err)
+	}
+}
+
+// Sync flushes the spool file to disk, then syncs sink
+func (s *SpoolSink) Sync() (err error) {
+	s.start.Do(s.run)
+	s.mu.Lock()
+	if s.writer != nil {
+		err = s.writer.Sync()
+	}
+	s.mu.Unlock()
+	if e := s.sink.Sync(); err == nil {
+		err = e
+	}
+	return
+}
+
+// Pending returns count of spooled entries
+func (s *SpoolSink) Pending() (n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, f := range s.files {
+		n += f.count
+	}
+	return n - s.replayed
+}
+
+// Dropped returns count of entries dropped by MaxSize
+func (s *SpoolSink) Dropped() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+// Close stops the replayer and closes sink, spooled entries are kept in files
+func (s *SpoolSink) Close() error {
+	s.start.Do(s.run)
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.mu.Unlock()
+
+	close(s.done)
+	<-s.exit
+	s.mu.Lock()
+	for _, f := range []*os.File{s.writer, s.reader} {
+		if f != nil {
+			f.Close()
+		}
+	}
+	s.writer, s.reader = nil, nil
+	s.mu.Unlock()
+	return s.sink.Close()
+}
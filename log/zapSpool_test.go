@@ -0,0 +1,335 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// limitSink fails after limit batches
+type limitSink struct {
+	batchSink
+	limit int
+}
+
+func (s *limitSink) WriteBatch(entries [][]byte) error {
+	s.mu.Lock()
+	if s.limit == 0 {
+		s.mu.Unlock()
+		return errors.New("limit")
+	}
+	s.limit--
+	s.mu.Unlock()
+	return s.batchSink.WriteBatch(entries)
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	for deadline := time.Now().Add(5 * time.Second); !cond(); time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout")
+		}
+	}
+}
+
+func spoolFiles(t *testing.T, dir string) int {
+	names, err := filepath.Glob(filepath.Join(dir, "*.spool"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(names)
+}
+
+func newTestSpool(t *testing.T, sink *batchSink) (s *SpoolSink, dir string) {
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, err = NewSpoolSink(sink, dir); err != nil {
+		t.Fatal(err)
+	}
+	s.RetryInterval = 20 * time.Millisecond
+	s.OnError = func(error) {}
+	return
+}
+
+func TestSpoolSinkReplay(t *testing.T) {
+	w := &batchSink{}
+	s, dir := newTestSpool(t, w)
+	defer os.RemoveAll(dir)
+	s.BatchSize = 2
+
+	s.Write([]byte("a"))
+	w.mu.Lock()
+	w.err = errors.New("unreachable")
+	w.mu.Unlock()
+	s.Write([]byte("b"))
+	s.WriteBatch([][]byte{[]byte("c"), []byte("d")})
+	if s.Pending() != 3 || spoolFiles(t, dir) != 1 {
+		t.Fatal(s.Pending(), spoolFiles(t, dir))
+	}
+
+	//sink recovers, but entries are spooled after the earlier ones until the replayer drains them
+	gate := make(chan struct{})
+	w.mu.Lock()
+	w.err, w.gate = nil, gate
+	w.mu.Unlock()
+	s.Write([]byte("e"))
+	if got := fmt.Sprint(w.entries()); got != "[a]" {
+		t.Fatal(got)
+	}
+	close(gate)
+	waitFor(t, func() bool { return s.Pending() == 0 })
+	s.Write([]byte("f"))
+	if got := fmt.Sprint(w.entries(), w.sizes()); got != "[a b c d e f] [1 2 2 1]" {
+		t.Fatal(got)
+	}
+	if spoolFiles(t, dir) != 0 {
+		t.Fatal("replayed files should be removed")
+	}
+	if err := s.Close(); err != nil || !w.closed {
+		t.Fatal(err)
+	}
+	if _, err := s.Write([]byte("g")); err != ErrorSinkClosed {
+		t.Fatal(err)
+	}
+}
+
+func TestSpoolSinkMaxSize(t *testing.T) {
+	w := &batchSink{err: errors.New("unreachable")}
+	s, dir := newTestSpool(t, w)
+	defer os.RemoveAll(dir)
+	defer s.Close()
+	//entries of 3 bytes are 7 bytes in files, 3 entries per file, 6 entries at most
+	s.FileSize, s.MaxSize = 21, 42
+	for i := 0; i < 10; i++ {
+		s.Write([]byte(fmt.Sprintf("e%02d", i)))
+	}
+	//the oldest files are removed
+	if s.Pending() != 4 || s.Dropped() != 6 || spoolFiles(t, dir) != 2 {
+		t.Fatal(s.Pending(), s.Dropped(), spoolFiles(t, dir))
+	}
+	s.Write(make([]byte, 40)) //larger than MaxSize
+	if s.Dropped() != 7 {
+		t.Fatal(s.Dropped())
+	}
+
+	w.mu.Lock()
+	w.err = nil
+	w.mu.Unlock()
+	waitFor(t, func() bool { return s.Pending() == 0 })
+	if got := fmt.Sprint(w.entries()); got != "[e06 e07 e08 e09]" {
+		t.Fatal(got)
+	}
+}
+
+func TestSpoolSinkRestart(t *testing.T) {
+	w := &batchSink{err: errors.New("unreachable")}
+	s, dir := newTestSpool(t, w)
+	defer os.RemoveAll(dir)
+	for i := 0; i < 5; i++ {
+		s.Write([]byte(fmt.Sprint(i)))
+	}
+	s.Close()
+	if spoolFiles(t, dir) != 1 {
+		t.Fatal("spool files should be kept")
+	}
+	//partial entry written by a crash is truncated
+	f, err := os.OpenFile(filepath.Join(dir, fmt.Sprintf("%020d.spool", 1)), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{0, 0, 0, 9, 'x'})
+	f.Close()
+
+	//the next process replays one batch, then the sink fails
+	l := &limitSink{limit: 1}
+	s, err = NewSpoolSink(l, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.BatchSize, s.RetryInterval, s.OnError = 2, time.Hour, func(error) {}
+	if s.Pending() != 5 {
+		t.Fatal(s.Pending())
+	}
+	s.Write([]byte("5")) //spooled after the recovered entries
+	waitFor(t, func() bool { return s.Pending() == 4 })
+	s.Close()
+	if got := fmt.Sprint(l.entries()); got != "[0 1]" {
+		t.Fatal(got)
+	}
+
+	//replayed entries are skipped by the saved offset
+	w = &batchSink{}
+	if s, err = NewSpoolSink(w, dir); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.Sync() //starts the replayer
+	waitFor(t, func() bool { return s.Pending() == 0 })
+	if got := fmt.Sprint(w.entries()); got != "[2 3 4 5]" {
+		t.Fatal(got)
+	}
+}
+
+// TestSpoolZapSinkRedis writes to redis which is unreachable at startup
+func TestSpoolZapSinkRedis(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var handled []error
+	defer func(h func(error)) { SinkErrorHandler = h }(SinkErrorHandler)
+	SinkErrorHandler = func(err error) { handled = append(handled, err) }
+	factory := SpoolZapSink(NewZapSinkRedisQueue)
+	u, _ := url.Parse("redis://" + addr + "?db=0&queue=q&op=rpush&spool_retry=20ms&spool_batch=10&spool=" + url.QueryEscape(dir))
+	sink, err := factory(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(handled) != 1 || !strings.Contains(handled[0].Error(), "redis is unreachable") {
+		t.Fatal(handled)
+	}
+	defer sink.Close()
+	s := sink.(*SpoolSink)
+	if s.RetryInterval != 20*time.Millisecond || s.BatchSize != 10 {
+		t.Fatalf("%+v", s)
+	}
+	s.OnError = func(error) {}
+	s.Write([]byte("a"))
+	s.Write([]byte("b"))
+	if s.Pending() != 2 {
+		t.Fatal(s.Pending())
+	}
+
+	r := listenFakeRedis(t, addr)
+	defer r.ln.Close()
+	waitFor(t, func() bool { return s.Pending() == 0 })
+	s.Write([]byte("c"))
+	if got := fmt.Sprint(r.list("q")); got != "[a b c]" {
+		t.Fatal(got)
+	}
+
+	for _, query := range []string{"spool_max_size=0", "spool_batch=x", "spool_retry=1"} {
+		u, _ = url.Parse("redis://" + addr + "?db=0&queue=q&op=rpush&spool=" + url.QueryEscape(dir) + "&" + query)
+		if _, err = factory(u); err == nil {
+			t.Fatal(query)
+		}
+	}
+}
+
+// TestSpoolZapSinkRabbitMQ writes to rabbitmq which is unreachable at startup, entries beyond its buffer are spooled
+func TestSpoolZapSinkRabbitMQ(t *testing.T) {
+	f := newFakeAMQP(t)
+	f.stop()
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sink, err := SpoolZapSink(NewZapSinkRabbitMQ)(f.url("exchange=zap&key=L&buffer=2&backoff=10ms&max_backoff=20ms&spool_retry=20ms&spool=" + url.QueryEscape(dir)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	s := sink.(*SpoolSink)
+	s.OnError = func(error) {}
+	for _, m := range []string{"a", "b", "c", "d"} {
+		s.Write(logLine("info", m))
+	}
+	if s.Pending() != 2 {
+		t.Fatal(s.Pending())
+	}
+
+	f.start(t)
+	defer f.stop()
+	waitFor(t, func() bool { return s.Pending() == 0 })
+	s.Write(logLine("info", "e"))
+	if err = s.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if got := f.bodies(&f.acked); got != logBodies("a", "b", "c", "d", "e") {
+		t.Fatal(got)
+	}
+}
+
+// TestSpoolZapSinkMongo creates the sink while mongodb is unreachable, failed entries are spooled
+func TestSpoolZapSinkMongo(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	u, _ := url.Parse("mongodb://" + addr + "/logs?collection=zap&dial_timeout=50ms&backoff=1h&spool_retry=1h&spool=" + url.QueryEscape(dir))
+	sink, err := SpoolZapSink(NewZapSinkMongo)(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	s := sink.(*SpoolSink)
+	s.OnError = func(error) {}
+	m := s.sink.(*ZapSinkMongo)
+	if m.DialTimeout != 50*time.Millisecond || m.Backoff != time.Hour {
+		t.Fatalf("%+v", m)
+	}
+	s.Write(logLine("info", "a"))
+	s.Write(logLine("info", "b"))
+	if s.Pending() != 2 || spoolFiles(t, dir) != 1 {
+		t.Fatal(s.Pending(), spoolFiles(t, dir))
+	}
+	//no dial until the backoff passes
+	start := time.Now()
+	if _, err = m.Write(logLine("info", "c")); err == nil || time.Since(start) > 100*time.Millisecond {
+		t.Fatal("need the last dial error", err, time.Since(start))
+	}
+
+	//concurrent writes share one dial
+	u, _ = url.Parse("mongodb://" + addr + "/logs?collection=zap&dial_timeout=50ms")
+	sink, _ = NewZapSinkMongo(u)
+	defer sink.Close()
+	m = sink.(*ZapSinkMongo)
+	var wg sync.WaitGroup
+	start = time.Now()
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.Write(logLine("info", "d"))
+		}()
+	}
+	wg.Wait()
+	//a dial takes 1.5 seconds at least by mgo, 10 dials one by one take 15 seconds
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatal("writes should share the dial", d)
+	}
+
+	for _, query := range []string{"dial_timeout=x", "backoff=0s", "max_backoff=1"} {
+		u, _ = url.Parse("mongodb://" + addr + "/logs?collection=zap&" + query)
+		if _, err = NewZapSinkMongo(u); err == nil {
+			t.Fatal(query)
+		}
+	}
+}
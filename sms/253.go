@@ -1 +1,239 @@
 package sms
+
+/**
+implement: chuanglan(253) json api, https://www.253.com/api
+*/
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const chuanglanEndpoint = "https://smssh1.253.com"
+
+// chuanglanErrors descriptions of error codes
+var chuanglanErrors = map[string]string{
+	"101": "no such account",
+	"102": "wrong password",
+	"103": "submit too fast",
+	"104": "system busy",
+	"105": "sensitive content",
+	"106": "invalid message length",
+	"107": "invalid phone number",
+	"108": "invalid count of phone numbers",
+	"109": "no credits",
+	"110": "out of sending time",
+	"116": "invalid sign name",
+	"117": "ip not allowed",
+	"118": "no permission",
+	"119": "account expired",
+	"120": "anti-theft policy rejected",
+	"123": "invalid send type",
+	"124": "template mismatch",
+	"125": "rejected template",
+	"129": "invalid json",
+}
+
+// ChuanglanSMS has no server side template, TemplateCode is the content with
+// "{name}" placeholders of TemplateParam, SignName is added as "【SignName】".
+type ChuanglanSMS struct {
+	account   string
+	password  string
+	endpoint  string
+	cli       *http.Client
+	location  *time.Location
+	templates *TemplateRegistry
+
+	//pulled reports are removed from server, keep them until queried, expired or evicted
+	mu         sync.Mutex
+	reports    map[string]chuanglanReport //msgId:phone
+	pulls      uint64
+	reportTTL  time.Duration
+	maxReports int
+}
+
+const (
+	chuanglanReportTTL  = 24 * time.Hour
+	chuanglanMaxReports = 10000
+)
+
+type chuanglanReport struct {
+	Receipt
+	pulled time.Time
+	seq    uint64 //order of pulling, the oldest are evicted first
+}
+
+// InitSMS AccessKeyId: account, AccessSecret: password
+func (s *ChuanglanSMS) InitSMS(cfg Config) (instance SMS, err error) {
+	if cfg.AccessKeyId == "" || cfg.AccessSecret == "" {
+		err = errors.New("lost account or password")
+		return
+	}
+	s.account, s.password = cfg.AccessKeyId, cfg.AccessSecret
+	if s.endpoint = strings.TrimRight(cfg.Endpoint, "/"); s.endpoint == "" {
+		s.endpoint = chuanglanEndpoint
+	}
+	s.cli = newHTTPClient(cfg.Timeout)
+	s.location = cfg.location(chinaTimezone)
+	s.reports = make(map[string]chuanglanReport)
+	s.reportTTL, s.maxReports = chuanglanReportTTL, chuanglanMaxReports
+	s.templates = cfg.Templates
+	instance = s
+	return
+}
+
+func (s *ChuanglanSMS) SendSMS(req SendRequest) (r Result, err error) {
+	if req, err = resolveRequest(s.templates, req, s.SupportBy(), true); err != nil {
+		return
+	}
+	if req.SignName == "" {
+		err = ErrorSMSNoSign
+		return
+	}
+	var resp struct {
+		Code     string `json:"code"`
+		MsgId    string `json:"msgId"`
+		ErrorMsg string `json:"errorMsg"`
+	}
+	if err = s.post("/msg/send/json", map[string]interface{}{
+		"msg":    "【" + req.SignName + "】" + renderTemplate(req.TemplateCode, req.TemplateParam),
+		"phone":  strings.Join(req.Phones, ","),
+		"report": "true",
+	}, &resp); err != nil {
+		return
+	}
+	if resp.Code != "0" {
+		r.ErrCode = resp.Code
+		err = chuanglanError(resp.Code, resp.ErrorMsg)
+		return
+	}
+	r.ReceiptId = resp.MsgId
+	return
+}
+
+// GetDetail pulls reports from server, reports of other messages are kept for later queries.
+// Pulled reports are removed from server, so they are only kept by this process,
+// for 24 hours and 10000 reports at most
+func (s *ChuanglanSMS) GetDetail(q DetailQuery) (r Receipt, err error) {
+	if err = q.Validate(); err != nil {
+		return
+	}
+	key := q.ReceiptId + ":" + q.Phone
+	if r, has := s.takeReport(key); has {
+		return r, nil
+	}
+
+	var resp struct {
+		Ret    int    `json:"ret"`
+		Error  string `json:"error"`
+		Result []struct {
+			MsgId      string `json:"msgId"`
+			ReportTime string `json:"reportTime"` //yyMMddHHmm
+			Mobile     string `json:"mobile"`
+			Status     string `json:"status"`
+			StatusDesc string `json:"statusDesc"`
+		} `json:"result"`
+	}
+	if err = s.post("/msg/pull/report", map[string]interface{}{"count": "100"}, &resp); err != nil {
+		return
+	}
+	if resp.Ret != 0 {
+		err = fmt.Errorf("pull report failed(%d): %s", resp.Ret, resp.Error)
+		return
+	}
+	pulled := make([]Receipt, 0, len(resp.Result))
+	for _, rp := range resp.Result {
+		rc := Receipt{Provider: s.SupportBy(), ReceiptId: rp.MsgId, Phone: rp.Mobile, ErrCode: rp.Status, SendStat: StatusDone}
+		if rp.Status == "DELIVRD" {
+			rc.ErrCode = "DELIVERED"
+		} else {
+			rc.SendStat, rc.ErrCategory = StatusFail, ClassifyError(rp.Status)
+		}
+		rc.ReceiveDate, _ = parseDate("0601021504", rp.ReportTime, s.location)
+		pulled = append(pulled, rc)
+	}
+	s.keepReports(pulled)
+
+	if r, has := s.takeReport(key); has {
+		return r, nil
+	}
+	err = ErrorSMSNoReceipt
+	return
+}
+
+func (s *ChuanglanSMS) SupportBy() string {
+	return "253"
+}
+
+func (s *ChuanglanSMS) takeReport(key string) (r Receipt, has bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rp, has := s.reports[key]
+	if has {
+		delete(s.reports, key)
+	}
+	return rp.Receipt, has && time.Since(rp.pulled) <= s.reportTTL
+}
+
+// keepReports adds pulled reports, removes expired ones, then evicts the oldest ones over maxReports
+func (s *ChuanglanSMS) keepReports(list []Receipt) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for _, rc := range list {
+		s.pulls++
+		s.reports[rc.ReceiptId+":"+rc.Phone] = chuanglanReport{Receipt: rc, pulled: now, seq: s.pulls}
+	}
+	for k, rp := range s.reports {
+		if now.Sub(rp.pulled) > s.reportTTL {
+			delete(s.reports, k)
+		}
+	}
+	over := len(s.reports) - s.maxReports
+	if over <= 0 {
+		return
+	}
+	keys := make([]string, 0, len(s.reports))
+	for k := range s.reports {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return s.reports[keys[i]].seq < s.reports[keys[j]].seq })
+	for _, k := range keys[:over] {
+		delete(s.reports, k)
+	}
+}
+
+func (s *ChuanglanSMS) post(path string, params map[string]interface{}, out interface{}) error {
+	params["account"] = s.account
+	params["password"] = s.password
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return doHTTP(s.cli, http.MethodPost, s.endpoint+path, "application/json", body, nil, out)
+}
+
+func chuanglanError(code, msg string) error {
+	if msg == "" {
+		msg = chuanglanErrors[code]
+	}
+	return fmt.Errorf("%s(%s)", msg, code)
+}
+
+// renderTemplate replaces "{name}" in content by params
+func renderTemplate(content string, params map[string]string) string {
+	if len(params) == 0 {
+		return content
+	}
+	pairs := make([]string, 0, len(params)*2)
+	for k, v := range params {
+		pairs = append(pairs, "{"+k+"}", v)
+	}
+	return strings.NewReplacer(pairs...).Replace(content)
+}
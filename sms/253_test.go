@@ -0,0 +1,112 @@
+package sms
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestChuanglanSMS(t *testing.T) {
+	pulls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var params map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			t.Error(err)
+		}
+		if params["account"] != "N123" || params["password"] != "pwd" {
+			w.Write([]byte(`{"code":"102","msgId":"","errorMsg":""}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/msg/send/json":
+			if params["msg"] != "【gutil】your code is 1234" || params["phone"] != "13012345678,13112345678" {
+				t.Errorf("params error: %v", params)
+			}
+			w.Write([]byte(`{"code":"0","msgId":"17041010383624511","time":"20170410103836","errorMsg":""}`))
+		case "/msg/pull/report":
+			pulls++
+			if pulls > 1 {
+				w.Write([]byte(`{"ret":0,"result":[]}`))
+				return
+			}
+			w.Write([]byte(`{"ret":0,"result":[
+				{"msgId":"17041010383624511","reportTime":"1704101038","mobile":"13012345678","status":"DELIVRD","statusDesc":"ok"},
+				{"msgId":"17041010383624511","reportTime":"1704101039","mobile":"13112345678","status":"UNDELIV","statusDesc":"failed"}]}`))
+		default:
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+
+	s, err := Using("253", Config{AccessKeyId: "N123", AccessSecret: "pwd", Endpoint: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := SendRequest{
+		Phones:        []string{"13012345678", "13112345678"},
+		SignName:      "gutil",
+		TemplateCode:  "your code is {code}",
+		TemplateParam: map[string]string{"code": "1234"},
+	}
+	r, err := s.SendSMS(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.ReceiptId != "17041010383624511" {
+		t.Fatalf("%+v", r)
+	}
+
+	q := DetailQuery{Phone: "13012345678", ReceiptId: r.ReceiptId, SendDate: time.Now()}
+	rc, err := s.GetDetail(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rc.SendStat != "DONE" || rc.ReceiveDate.Minute() != 38 {
+		t.Fatalf("%+v", rc)
+	}
+	//kept from the first pull
+	q.Phone = "13112345678"
+	if rc, err = s.GetDetail(q); err != nil || rc.SendStat != StatusFail || rc.ErrCode != "UNDELIV" || rc.ErrCategory != ErrCategoryUnreachable {
+		t.Fatalf("%+v %v", rc, err)
+	}
+	if _, err = s.GetDetail(q); err != ErrorSMSNoReceipt {
+		t.Fatal("need no receipt error", err)
+	}
+
+	s, _ = Using("chuanglan", Config{AccessKeyId: "N123", AccessSecret: "wrong", Endpoint: srv.URL})
+	if r, err = s.SendSMS(req); err == nil || r.ErrCode != "102" || err.Error() != "wrong password(102)" {
+		t.Fatalf("need vendor error: %+v %v", r, err)
+	}
+}
+
+func TestChuanglanReportsEviction(t *testing.T) {
+	instance, err := Using("253", Config{AccessKeyId: "N123", AccessSecret: "pwd"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := instance.(*ChuanglanSMS)
+	s.maxReports, s.reportTTL = 2, time.Hour
+	s.keepReports([]Receipt{{ReceiptId: "1", Phone: "p"}, {ReceiptId: "2", Phone: "p"}})
+	s.keepReports([]Receipt{{ReceiptId: "3", Phone: "p"}})
+	if _, has := s.takeReport("1:p"); has || len(s.reports) != 2 {
+		t.Fatal("the oldest report should be evicted", s.reports)
+	}
+	if r, has := s.takeReport("3:p"); !has || r.ReceiptId != "3" {
+		t.Fatal("report lost", r)
+	}
+
+	//expired reports are removed by the next pull, and not returned
+	s.reportTTL = 20 * time.Millisecond
+	time.Sleep(30 * time.Millisecond)
+	if _, has := s.takeReport("2:p"); has {
+		t.Fatal("expired report returned")
+	}
+	s.keepReports([]Receipt{{ReceiptId: "4", Phone: "p"}})
+	s.reports["5:p"] = chuanglanReport{pulled: time.Now().Add(-time.Minute)}
+	s.keepReports(nil)
+	if len(s.reports) != 1 {
+		t.Fatal(s.reports)
+	}
+}
@@ -5,46 +5,89 @@ implement: refers to aliyun sms demo
 */
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	sdkerrors "github.com/aliyun/alibaba-cloud-sdk-go/sdk/errors"
 	"github.com/aliyun/alibaba-cloud-sdk-go/services/dysmsapi"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 )
 
 type AliyunSMS struct {
-	client *dysmsapi.Client
+	client    *dysmsapi.Client
+	scheme    string
+	domain    string //"": resolved by region
+	location  *time.Location
+	templates *TemplateRegistry
 }
 
-func (s *AliyunSMS) InitSMS(params map[string]interface{}) (instance SMS, err error) {
-	regionId := params["region_id"].(string) //"cn-hangzhou"
-	accessKeyId := params["access_key_id"].(string)
-	accessSecret := params["access_secret"].(string)
+func (s *AliyunSMS) InitSMS(cfg Config) (instance SMS, err error) {
+	if cfg.RegionId == "" { //"cn-hangzhou"
+		err = errors.New("lost region id")
+		return
+	}
+	if cfg.AccessKeyId == "" || cfg.AccessSecret == "" {
+		err = errors.New("lost access key")
+		return
+	}
 
-	s.client, err = dysmsapi.NewClientWithAccessKey(regionId, accessKeyId, accessSecret)
+	s.location = cfg.location(chinaTimezone)
+	s.scheme = "https"
+	if cfg.Endpoint != "" {
+		var u *url.URL
+		if u, err = url.Parse(cfg.Endpoint); err != nil {
+			return
+		}
+		if u.Host == "" {
+			err = fmt.Errorf("invalid endpoint %s", cfg.Endpoint)
+			return
+		}
+		s.scheme, s.domain = u.Scheme, u.Host
+	}
+	s.client, err = dysmsapi.NewClientWithAccessKey(cfg.RegionId, cfg.AccessKeyId, cfg.AccessSecret)
 	if err != nil {
 		return
 	}
+	s.templates = cfg.Templates
 	instance = s
 	return
 }
 
-func (s *AliyunSMS) SendSMS(params map[string]interface{}) (r Result, err error) {
+func (s *AliyunSMS) SendSMS(req SendRequest) (r Result, err error) {
+	if req, err = resolveRequest(s.templates, req, s.SupportBy(), false); err != nil {
+		return
+	}
+	if req.SignName == "" {
+		err = ErrorSMSNoSign
+		return
+	}
 	request := dysmsapi.CreateSendSmsRequest()
 
-	request.Scheme = "https"
-	request.PhoneNumbers = params["PhoneNumber"].(string)
-	request.SignName = params["SignName"].(string)
-	request.TemplateCode = params["TemplateCode"].(string)
-	request.TemplateParam = params["TemplateParam"].(string) //json string
+	request.Scheme, request.Domain = s.scheme, s.domain
+	request.PhoneNumbers = strings.Join(req.Phones, ",")
+	request.SignName = req.SignName
+	request.TemplateCode = req.TemplateCode
+	if len(req.TemplateParam) != 0 {
+		var tp []byte
+		if tp, err = json.Marshal(req.TemplateParam); err != nil {
+			return
+		}
+		request.TemplateParam = string(tp) //json string
+	}
 
 	response, err := s.client.SendSms(request)
 	if err != nil {
+		//throttling, 5xx and timeout are errors of sdk, not response code
+		r.ErrCode = aliyunErrCode(err)
 		return
 	}
 	//fmt.Printf("response is %#v\n", response)
 
 	//error code : https://help.aliyun.com/document_detail/101346.html
-	r.ErrCode = response.Message
+	r.ErrCode = response.Code
 	if response.Code != "OK" {
 		err = errors.New(response.Message)
 		return
@@ -53,13 +96,16 @@ func (s *AliyunSMS) SendSMS(params map[string]interface{}) (r Result, err error)
 	return
 }
 
-func (s *AliyunSMS) GetDetail(params map[string]interface{}) (r Receipt, err error) {
+func (s *AliyunSMS) GetDetail(q DetailQuery) (r Receipt, err error) {
+	if err = q.Validate(); err != nil {
+		return
+	}
 	request := dysmsapi.CreateQuerySendDetailsRequest()
 
-	request.Scheme = "https"
-	request.PhoneNumber = params["PhoneNumber"].(string)
-	request.SendDate = params["SendDate"].(string)
-	request.BizId = params["BizId"].(string)
+	request.Scheme, request.Domain = s.scheme, s.domain
+	request.PhoneNumber = q.Phone
+	request.SendDate = q.SendDate.In(s.location).Format("20060102") //date of the provider timezone
+	request.BizId = q.ReceiptId
 	request.CurrentPage = "1"
 	request.PageSize = "1"
 
@@ -81,31 +127,30 @@ func (s *AliyunSMS) GetDetail(params map[string]interface{}) (r Receipt, err err
 		return
 	}
 
+	dto := response.SmsSendDetailDTOs.SmsSendDetailDTO[0]
+	r.Provider, r.ReceiptId, r.Phone, r.Content = s.SupportBy(), q.ReceiptId, dto.PhoneNum, dto.Content
+	if r.Phone == "" {
+		r.Phone = q.Phone
+	}
 	// no error: DELIVERED
 	//errors: https://help.aliyun.com/document_detail/101347.html
-	r.ErrCode = response.SmsSendDetailDTOs.SmsSendDetailDTO[0].ErrCode
+	r.ErrCode = dto.ErrCode
 
-	if r.SendDate, err = time.ParseInLocation("2006-01-02 15:04:05",
-		response.SmsSendDetailDTOs.SmsSendDetailDTO[0].SendDate,
-		time.Local); err != nil {
+	if r.SendDate, err = parseDate("2006-01-02 15:04:05", dto.SendDate, s.location); err != nil {
 		return
 	}
-	if r.ReceiveDate, err = time.ParseInLocation("2006-01-02 15:04:05",
-		response.SmsSendDetailDTOs.SmsSendDetailDTO[0].ReceiveDate,
-		time.Local); err != nil {
+	if r.ReceiveDate, err = parseDate("2006-01-02 15:04:05", dto.ReceiveDate, s.location); err != nil {
 		return
 	}
-	//fixme: support custom timezone
 
-	switch response.SmsSendDetailDTOs.SmsSendDetailDTO[0].SendStatus {
+	switch dto.SendStatus {
 	case 1:
-		r.SendStat = "WAIT" //等待回执
-	case 2:
-		r.SendStat = "FAIL" //发送失败
+		r.SendStat = StatusWait
 	case 3:
-		r.SendStat = "DONE" //发送成功
+		r.SendStat = StatusDone
 	default:
-		r.SendStat = "FAIL" //发送失败
+		r.SendStat = StatusFail
+		r.ErrCategory = ClassifyError(r.ErrCode)
 	}
 	return
 }
@@ -113,3 +158,25 @@ func (s *AliyunSMS) GetDetail(params map[string]interface{}) (r Receipt, err err
 func (s *AliyunSMS) SupportBy() string {
 	return "aliyun"
 }
+
+// aliyunErrCode returns error code of server, or http status if the body has no code,
+// ErrCodeTransport for timeout
+func aliyunErrCode(err error) string {
+	var (
+		se *sdkerrors.ServerError
+		ce *sdkerrors.ClientError
+	)
+	switch {
+	case errors.As(err, &se):
+		if se.ErrorCode() != "" {
+			return se.ErrorCode()
+		}
+		return strconv.Itoa(se.HttpStatus())
+	case errors.As(err, &ce):
+		if ce.ErrorCode() == sdkerrors.TimeoutErrorCode {
+			return ErrCodeTransport
+		}
+		return ce.ErrorCode()
+	}
+	return ""
+}
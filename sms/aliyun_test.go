@@ -1,6 +1,10 @@
 package sms
 
-import "testing"
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
 
 func TestAliyunSMS(t *testing.T) {
 	//testQueryDetail(t)
@@ -8,7 +12,7 @@ func TestAliyunSMS(t *testing.T) {
 }
 
 func testQueryDetail(t *testing.T) {
-	s, err := Using("aliyun", map[string]interface{}{
+	s, err := UsingMap("aliyun", map[string]interface{}{
 		"regionId":     "cn-hangzhou",
 		"accessKeyId":  "AK",
 		"accessSecret": "SK"})
@@ -27,7 +31,7 @@ func testQueryDetail(t *testing.T) {
 }
 
 func testSend(t *testing.T) {
-	s, err := Using("aliyun", map[string]interface{}{
+	s, err := UsingMap("aliyun", map[string]interface{}{
 		"regionId":     "cn-hangzhou",
 		"accessKeyId":  "AK",
 		"accessSecret": "SK"})
@@ -42,3 +46,51 @@ func testSend(t *testing.T) {
 	})
 	t.Log(r, err)
 }
+
+func TestAliyunSMSProviderError(t *testing.T) {
+	status, body := http.StatusBadRequest, `{"RequestId":"r1","Code":"Throttling.User","Message":"too many requests"}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("Action") != "SendSms" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	s, err := Using("aliyun", Config{RegionId: "cn-hangzhou", AccessKeyId: "id", AccessSecret: "secret", Endpoint: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := SendRequest{Phones: []string{"13012345678"}, SignName: "gutil", TemplateCode: "SMS_1"}
+	r, err := s.SendSMS(req)
+	if err == nil || r.ErrCode != "Throttling.User" || !IsProviderError(r, err) {
+		t.Fatalf("need throttling error: %+v %v", r, err)
+	}
+
+	status, body = http.StatusServiceUnavailable, "unavailable"
+	if r, err = s.SendSMS(req); err == nil || r.ErrCode != "503" || !IsProviderError(r, err) {
+		t.Fatalf("need 503 error: %+v %v", r, err)
+	}
+
+	status, body = http.StatusBadRequest, `{"RequestId":"r2","Code":"isv.MOBILE_NUMBER_ILLEGAL","Message":"invalid phone"}`
+	if r, err = s.SendSMS(req); err == nil || r.ErrCode != "isv.MOBILE_NUMBER_ILLEGAL" || IsProviderError(r, err) {
+		t.Fatalf("need request error: %+v %v", r, err)
+	}
+
+	status, body = http.StatusOK, `{"RequestId":"r3","Code":"OK","Message":"OK","BizId":"b1"}`
+	if r, err = s.SendSMS(req); err != nil || r.ReceiptId != "b1" {
+		t.Fatalf("%+v %v", r, err)
+	}
+
+	//throttled by aliyun, sent by the next provider
+	status, body = http.StatusBadRequest, `{"RequestId":"r4","Code":"Throttling.User","Message":"too many requests"}`
+	b := &fakeSMS{name: "b"}
+	m, err := NewMultiSMS(Route{SMS: s, Priority: 1}, Route{SMS: b, Priority: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, err = m.SendSMS(req); err != nil || r.Provider != "b" {
+		t.Fatalf("%+v %v", r, err)
+	}
+}
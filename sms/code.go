@@ -0,0 +1,273 @@
+package sms
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrorCodeCooldown = errors.New("code requested too frequently")
+	ErrorCodeQuota    = errors.New("daily quota of code exceeded")
+	ErrorCodeExpired  = errors.New("code expired or not requested")
+	ErrorCodeMismatch = errors.New("code mismatch")
+	ErrorCodeAttempts = errors.New("too many attempts")
+	ErrorCodeSecret   = errors.New("lost secret of code hash")
+)
+
+// CodeError is returned by CodeService, errors.Is(err, ErrorCodeCooldown) checks its kind
+type CodeError struct {
+	Err        error
+	RetryAfter time.Duration //cooldown and quota only
+}
+
+func (e *CodeError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("%v, retry after %v", e.Err, e.RetryAfter)
+	}
+	return e.Err.Error()
+}
+
+func (e *CodeError) Unwrap() error {
+	return e.Err
+}
+
+// CodeService sends verification codes by SMS, only the hash of code is stored.
+// Codes are isolated by purpose, like "login", "reset_password".
+type CodeService struct {
+	SMS          SMS
+	Store        CodeStore
+	SignName     string
+	TemplateCode string
+	ParamName    string            //template param of code, default "code"
+	ExtraParams  map[string]string //other template params
+
+	Length      int           //default 6
+	TTL         time.Duration //default 5 minutes
+	Cooldown    time.Duration //between sends to a phone, default 1 minute
+	DailyLimit  int           //sends to a phone per day, default 10, negative: unlimited
+	MaxAttempts int           //verifications of a code, default 5
+	// Secret is the hmac key of code hash, required, a random one is set by NewCodeService.
+	// Processes sharing the store need the same secret
+	Secret      string
+	Prefix      string //key prefix in store, default "sms:code:"
+	CountryCode string //for phones without country code, default "86"
+	Location    *time.Location
+}
+
+func NewCodeService(sms SMS, store CodeStore, signName, templateCode string) *CodeService {
+	c := &CodeService{
+		SMS:          sms,
+		Store:        store,
+		SignName:     signName,
+		TemplateCode: templateCode,
+		ParamName:    "code",
+		Length:       6,
+		TTL:          5 * time.Minute,
+		Cooldown:     time.Minute,
+		DailyLimit:   10,
+		MaxAttempts:  5,
+		Prefix:       "sms:code:",
+		CountryCode:  "86",
+		Location:     time.Local,
+	}
+	//Send returns ErrorCodeSecret if rand fails
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err == nil {
+		c.Secret = hex.EncodeToString(secret)
+	}
+	return c
+}
+
+// Send generates a code and sends it to phone. Phone is sent as given, e.g. national numbers for 253 and submail,
+// its E.164 form is used by keys of store and hash
+func (c *CodeService) Send(phone, purpose string) (r Result, err error) {
+	if c.SMS == nil || c.Store == nil {
+		err = errors.New("lost sms or store")
+		return
+	}
+	if c.Secret == "" {
+		err = ErrorCodeSecret
+		return
+	}
+	e164, err := NormalizeE164(phone, c.CountryCode)
+	if err != nil {
+		return
+	}
+	var (
+		now      = time.Now()
+		loc      = c.Location
+		base     = c.Prefix + purpose + ":" + e164
+		dailyKey = c.Prefix + "daily:" + e164
+	)
+	if loc == nil {
+		loc = time.Local
+	}
+	y, m, d := now.In(loc).Date()
+	endOfDay := time.Date(y, m, d+1, 0, 0, 0, 0, loc).Sub(now)
+	dailyKey += ":" + now.In(loc).Format("20060102")
+
+	if c.DailyLimit >= 0 {
+		var v string
+		if v, err = c.Store.Get(dailyKey); err != nil {
+			return
+		}
+		if n, _ := strconv.Atoi(v); n >= c.dailyLimit() {
+			err = &CodeError{Err: ErrorCodeQuota, RetryAfter: endOfDay}
+			return
+		}
+	}
+
+	ok, err := c.Store.SetNX(base+":cooldown", strconv.FormatInt(now.UnixNano(), 10), c.cooldown())
+	if err != nil {
+		return
+	}
+	if !ok {
+		var v string
+		if v, err = c.Store.Get(base + ":cooldown"); err != nil {
+			return
+		}
+		last, _ := strconv.ParseInt(v, 10, 64)
+		retry := c.cooldown() - now.Sub(time.Unix(0, last))
+		if retry < 0 || last == 0 {
+			retry = time.Second
+		}
+		err = &CodeError{Err: ErrorCodeCooldown, RetryAfter: retry}
+		return
+	}
+
+	//the code is stored before sending, a delivered code is always usable
+	code, err := randomCode(c.length())
+	if err == nil {
+		err = c.Store.Del(base + ":attempts")
+	}
+	if err == nil {
+		err = c.Store.Set(base, c.hash(e164, code), c.ttl())
+	}
+	if err != nil {
+		c.Store.Del(base + ":cooldown")
+		return
+	}
+	params := map[string]string{c.paramName(): code}
+	for k, v := range c.ExtraParams {
+		params[k] = v
+	}
+	if r, err = c.SMS.SendSMS(SendRequest{
+		Phones:        []string{phone},
+		SignName:      c.SignName,
+		TemplateCode:  c.TemplateCode,
+		TemplateParam: params,
+	}); err != nil {
+		c.Store.Del(base)
+		c.Store.Del(base + ":cooldown")
+		return
+	}
+	//the code is sent, a lost count is better than an error
+	c.Store.Incr(dailyKey, endOfDay+time.Hour)
+	return
+}
+
+// Verify checks code, the code is removed after success or too many attempts
+func (c *CodeService) Verify(phone, purpose, code string) (err error) {
+	if c.Secret == "" {
+		return ErrorCodeSecret
+	}
+	if phone, err = NormalizeE164(phone, c.CountryCode); err != nil {
+		return
+	}
+	base := c.Prefix + purpose + ":" + phone
+	h, err := c.Store.Get(base)
+	if err != nil {
+		return
+	}
+	if h == "" {
+		return &CodeError{Err: ErrorCodeExpired}
+	}
+	n, err := c.Store.Incr(base+":attempts", c.ttl())
+	if err != nil {
+		return
+	}
+	max := c.MaxAttempts
+	if max <= 0 {
+		max = 5
+	}
+	if n > int64(max) {
+		c.Store.Del(base)
+		c.Store.Del(base + ":attempts")
+		return &CodeError{Err: ErrorCodeAttempts}
+	}
+	if !hmac.Equal([]byte(h), []byte(c.hash(phone, code))) {
+		if n == int64(max) {
+			c.Store.Del(base)
+			c.Store.Del(base + ":attempts")
+			return &CodeError{Err: ErrorCodeAttempts}
+		}
+		return &CodeError{Err: ErrorCodeMismatch}
+	}
+	c.Store.Del(base)
+	c.Store.Del(base + ":attempts")
+	return nil
+}
+
+func (c *CodeService) hash(phone, code string) string {
+	h := hmac.New(sha256.New, []byte(c.Secret))
+	h.Write([]byte(phone + ":" + code))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (c *CodeService) length() int {
+	if c.Length <= 0 {
+		return 6
+	}
+	return c.Length
+}
+
+func (c *CodeService) ttl() time.Duration {
+	if c.TTL <= 0 {
+		return 5 * time.Minute
+	}
+	return c.TTL
+}
+
+func (c *CodeService) cooldown() time.Duration {
+	if c.Cooldown <= 0 {
+		return time.Minute
+	}
+	return c.Cooldown
+}
+
+func (c *CodeService) dailyLimit() int {
+	if c.DailyLimit == 0 {
+		return 10
+	}
+	return c.DailyLimit
+}
+
+func (c *CodeService) paramName() string {
+	if c.ParamName == "" {
+		return "code"
+	}
+	return c.ParamName
+}
+
+// randomCode returns n random digits
+func randomCode(n int) (string, error) {
+	b := make([]byte, n)
+	buf := make([]byte, 1)
+	for i := 0; i < n; {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		if buf[0] >= 250 {
+			continue
+		}
+		b[i] = '0' + buf[0]%10
+		i++
+	}
+	return string(b), nil
+}
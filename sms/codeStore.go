@@ -0,0 +1,145 @@
+package sms
+
+import (
+	"github.com/go-redis/redis"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// CodeStore keeps state of CodeService, keys expire after ttl
+type CodeStore interface {
+	// Get returns "" if key is not found
+	Get(key string) (string, error)
+	Set(key, value string, ttl time.Duration) error
+	// SetNX sets only if key is not found
+	SetNX(key, value string, ttl time.Duration) (bool, error)
+	// Incr adds 1, ttl is set when the key is created
+	Incr(key string, ttl time.Duration) (int64, error)
+	Del(key string) error
+}
+
+type memoryItem struct {
+	value  string
+	expire time.Time
+}
+
+// MemoryCodeStore is a CodeStore in process
+type MemoryCodeStore struct {
+	mu    sync.Mutex
+	items map[string]memoryItem
+	sets  int
+}
+
+func NewMemoryCodeStore() *MemoryCodeStore {
+	return &MemoryCodeStore{items: make(map[string]memoryItem)}
+}
+
+// get returns unexpired item, must be called with lock
+func (s *MemoryCodeStore) get(key string) (it memoryItem, has bool) {
+	if it, has = s.items[key]; has && !time.Now().Before(it.expire) {
+		delete(s.items, key)
+		it, has = memoryItem{}, false
+	}
+	return
+}
+
+// set stores item and collects expired items every 100 sets, must be called with lock
+func (s *MemoryCodeStore) set(key, value string, ttl time.Duration) {
+	s.items[key] = memoryItem{value: value, expire: time.Now().Add(ttl)}
+	if s.sets++; s.sets%100 == 0 {
+		now := time.Now()
+		for k, it := range s.items {
+			if !now.Before(it.expire) {
+				delete(s.items, k)
+			}
+		}
+	}
+}
+
+func (s *MemoryCodeStore) Get(key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	it, _ := s.get(key)
+	return it.value, nil
+}
+
+func (s *MemoryCodeStore) Set(key, value string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.set(key, value, ttl)
+	return nil
+}
+
+func (s *MemoryCodeStore) SetNX(key, value string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, has := s.get(key); has {
+		return false, nil
+	}
+	s.set(key, value, ttl)
+	return true, nil
+}
+
+func (s *MemoryCodeStore) Incr(key string, ttl time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	it, has := s.get(key)
+	if !has {
+		s.set(key, "1", ttl)
+		return 1, nil
+	}
+	n, _ := strconv.ParseInt(it.value, 10, 64)
+	n++
+	it.value = strconv.FormatInt(n, 10)
+	s.items[key] = it
+	return n, nil
+}
+
+func (s *MemoryCodeStore) Del(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.items, key)
+	return nil
+}
+
+// RedisCodeStore is a CodeStore shared by processes
+type RedisCodeStore struct {
+	RedisCli *redis.Client
+}
+
+func (s *RedisCodeStore) Get(key string) (string, error) {
+	v, err := s.RedisCli.Get(key).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return v, err
+}
+
+func (s *RedisCodeStore) Set(key, value string, ttl time.Duration) error {
+	return s.RedisCli.Set(key, value, ttl).Err()
+}
+
+func (s *RedisCodeStore) SetNX(key, value string, ttl time.Duration) (bool, error) {
+	return s.RedisCli.SetNX(key, value, ttl).Result()
+}
+
+// incrScript sets ttl when the counter is created, a counter without ttl would block the phone forever
+var incrScript = redis.NewScript(`
+local n = redis.call("INCR", KEYS[1])
+if n == 1 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return n`)
+
+func (s *RedisCodeStore) Incr(key string, ttl time.Duration) (n int64, err error) {
+	ms := ttl.Nanoseconds() / int64(time.Millisecond)
+	if ms <= 0 {
+		ms = 1
+	}
+	return incrScript.Run(s.RedisCli, []string{key}, ms).Int64()
+}
+
+func (s *RedisCodeStore) Del(key string) error {
+	return s.RedisCli.Del(key).Err()
+}
@@ -0,0 +1,163 @@
+package sms
+
+import (
+	"errors"
+	"github.com/go-redis/redis"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestCodeService(t *testing.T) {
+	testCodeService(t, NewMemoryCodeStore())
+}
+
+func TestCodeServiceRedis(t *testing.T) {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		t.Skip("REDIS_ADDR is not set")
+	}
+	cli := redis.NewClient(&redis.Options{Addr: addr})
+	defer cli.Close()
+	testCodeService(t, &RedisCodeStore{RedisCli: cli})
+}
+
+func testCodeService(t *testing.T, store CodeStore) {
+	provider := &fakeSMS{name: "fake"}
+	c := NewCodeService(provider, store, "gutil", "SMS_001")
+	c.Prefix = "test:" + time.Now().Format("150405.000000") + ":"
+	c.Cooldown = 100 * time.Millisecond
+	c.DailyLimit = 3
+	c.MaxAttempts = 2
+	c.ExtraParams = map[string]string{"minutes": "5"}
+
+	lastCode := func() string {
+		req := provider.reqs[len(provider.reqs)-1]
+		if req.TemplateParam["minutes"] != "5" || req.Phones[0] != "13012345678" {
+			t.Fatalf("%+v", req)
+		}
+		return req.TemplateParam["code"]
+	}
+
+	if _, err := c.Send("13012345678", "login"); err != nil {
+		t.Fatal(err)
+	}
+	code := lastCode()
+	if len(code) != 6 {
+		t.Fatal("code length error", code)
+	}
+	if h, _ := store.Get(c.Prefix + "login:+8613012345678"); h == "" || h == code {
+		t.Fatal("code hash not stored", h)
+	}
+
+	//cooldown
+	_, err := c.Send("+86 130 1234 5678", "login")
+	var ce *CodeError
+	if !errors.As(err, &ce) || !errors.Is(err, ErrorCodeCooldown) || ce.RetryAfter <= 0 || ce.RetryAfter > c.Cooldown {
+		t.Fatal("need cooldown error", err)
+	}
+	//other purpose is isolated
+	if err = c.Verify("13012345678", "reset", code); !errors.Is(err, ErrorCodeExpired) {
+		t.Fatal("need expired error", err)
+	}
+
+	if err = c.Verify("13012345678", "login", code+"0"); !errors.Is(err, ErrorCodeMismatch) {
+		t.Fatal("need mismatch error", err)
+	}
+	if err = c.Verify("13012345678", "login", code); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Verify("13012345678", "login", code); !errors.Is(err, ErrorCodeExpired) {
+		t.Fatal("need expired error", err)
+	}
+
+	//attempts
+	time.Sleep(c.Cooldown)
+	if _, err = c.Send("13012345678", "login"); err != nil {
+		t.Fatal(err)
+	}
+	code = lastCode()
+	c.Verify("13012345678", "login", "x")
+	if err = c.Verify("13012345678", "login", "x"); !errors.Is(err, ErrorCodeAttempts) {
+		t.Fatal("need attempts error", err)
+	}
+	if err = c.Verify("13012345678", "login", code); !errors.Is(err, ErrorCodeExpired) {
+		t.Fatal("need expired error", err)
+	}
+
+	//failed send doesn't count
+	time.Sleep(c.Cooldown)
+	provider.fail = true
+	if _, err = c.Send("13012345678", "login"); err == nil {
+		t.Fatal("need send error")
+	}
+	provider.fail = false
+
+	//quota
+	if _, err = c.Send("13012345678", "login"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(c.Cooldown)
+	if _, err = c.Send("13012345678", "login"); !errors.Is(err, ErrorCodeQuota) {
+		t.Fatal("need quota error", err)
+	}
+
+	//expiry
+	c.TTL = 50 * time.Millisecond
+	if _, err = c.Send("13112345678", "login"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if err = c.Verify("13112345678", "login", provider.reqs[len(provider.reqs)-1].TemplateParam["code"]); !errors.Is(err, ErrorCodeExpired) {
+		t.Fatal("need expired error", err)
+	}
+}
+
+// failStore fails Incr, e.g. redis is down after the code is stored
+type failStore struct {
+	*MemoryCodeStore
+	failIncr bool
+}
+
+func (s *failStore) Incr(key string, ttl time.Duration) (int64, error) {
+	if s.failIncr {
+		return 0, errors.New("store is down")
+	}
+	return s.MemoryCodeStore.Incr(key, ttl)
+}
+
+func TestCodeServiceStoreBeforeSend(t *testing.T) {
+	provider := &fakeSMS{name: "fake"}
+	store := &failStore{MemoryCodeStore: NewMemoryCodeStore()}
+	c := NewCodeService(provider, store, "gutil", "SMS_001")
+	if len(c.Secret) != 64 {
+		t.Fatal("need random secret", c.Secret)
+	}
+
+	//failed send removes the stored code and cooldown
+	provider.err = ErrorSMSNoSign
+	if _, err := c.Send("13012345678", "login"); err != ErrorSMSNoSign {
+		t.Fatal(err)
+	}
+	if h, _ := store.Get(c.Prefix + "login:+8613012345678"); h != "" {
+		t.Fatal("code of failed send is kept")
+	}
+
+	//store error after sending doesn't fail a delivered code
+	provider.err, store.failIncr = nil, true
+	if _, err := c.Send("13012345678", "login"); err != nil {
+		t.Fatal(err)
+	}
+	store.failIncr = false
+	if err := c.Verify("13012345678", "login", provider.reqs[len(provider.reqs)-1].TemplateParam["code"]); err != nil {
+		t.Fatal(err)
+	}
+
+	c.Secret = ""
+	if _, err := c.Send("13012345678", "reset"); err != ErrorCodeSecret {
+		t.Fatal("need secret error", err)
+	}
+	if err := c.Verify("13012345678", "reset", "123456"); err != ErrorCodeSecret {
+		t.Fatal("need secret error", err)
+	}
+}
@@ -0,0 +1,137 @@
+package sms
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MapSMS keeps the map based api of old version, using SMS instead.
+type MapSMS struct {
+	SMS SMS
+}
+
+// UsingMap is Using with map params, keys: region_id, access_key_id, access_secret, timezone
+func UsingMap(SMSType string, params map[string]interface{}) (s *MapSMS, err error) {
+	cfg, err := ConfigFromMap(params)
+	if err != nil {
+		return
+	}
+	sms, err := Using(SMSType, cfg)
+	if err != nil {
+		return
+	}
+	s = &MapSMS{SMS: sms}
+	return
+}
+
+// SendSMS keys: PhoneNumber(separated by comma), SignName, TemplateCode, TemplateParam(json string)
+func (s *MapSMS) SendSMS(params map[string]interface{}) (r Result, err error) {
+	req, err := SendRequestFromMap(params)
+	if err != nil {
+		return
+	}
+	return s.SMS.SendSMS(req)
+}
+
+// GetDetail keys: PhoneNumber, SendDate(20060102), BizId
+func (s *MapSMS) GetDetail(params map[string]interface{}) (r Receipt, err error) {
+	q, err := DetailQueryFromMap(params)
+	if err != nil {
+		return
+	}
+	return s.SMS.GetDetail(q)
+}
+
+func (s *MapSMS) SupportBy() string {
+	return s.SMS.SupportBy()
+}
+
+func ConfigFromMap(params map[string]interface{}) (cfg Config, err error) {
+	if cfg.RegionId, err = mapString(params, "region_id", "regionId"); err != nil {
+		return
+	}
+	if cfg.AccessKeyId, err = mapString(params, "access_key_id", "accessKeyId"); err != nil {
+		return
+	}
+	if cfg.AccessSecret, err = mapString(params, "access_secret", "accessSecret"); err != nil {
+		return
+	}
+	var tz string
+	if tz, err = mapString(params, "timezone"); err != nil || tz == "" {
+		return
+	}
+	if cfg.Location, err = time.LoadLocation(tz); err != nil {
+		err = fmt.Errorf("invalid timezone: %s", tz)
+	}
+	return
+}
+
+func SendRequestFromMap(params map[string]interface{}) (req SendRequest, err error) {
+	var phones, tp string
+	if phones, err = mapString(params, "PhoneNumber", "PhoneNumbers"); err != nil {
+		return
+	}
+	for _, p := range strings.Split(phones, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			req.Phones = append(req.Phones, p)
+		}
+	}
+	if req.SignName, err = mapString(params, "SignName"); err != nil {
+		return
+	}
+	if req.SignName == "" {
+		err = ErrorSMSNoSign
+		return
+	}
+	if req.TemplateCode, err = mapString(params, "TemplateCode"); err != nil {
+		return
+	}
+	if tp, err = mapString(params, "TemplateParam"); err != nil {
+		return
+	}
+	if tp != "" {
+		if err = json.Unmarshal([]byte(tp), &req.TemplateParam); err != nil {
+			err = fmt.Errorf("invalid TemplateParam: %v", err)
+			return
+		}
+	}
+	err = req.Validate()
+	return
+}
+
+func DetailQueryFromMap(params map[string]interface{}) (q DetailQuery, err error) {
+	var date string
+	if q.Phone, err = mapString(params, "PhoneNumber"); err != nil {
+		return
+	}
+	if q.ReceiptId, err = mapString(params, "BizId"); err != nil {
+		return
+	}
+	if date, err = mapString(params, "SendDate"); err != nil {
+		return
+	}
+	if q.SendDate, err = time.ParseInLocation("20060102", date, time.Local); err != nil {
+		err = fmt.Errorf("invalid SendDate: %s", date)
+		return
+	}
+	err = q.Validate()
+	return
+}
+
+// mapString returns the string value of the first existing key, missing key returns ""
+func mapString(params map[string]interface{}, keys ...string) (v string, err error) {
+	for _, k := range keys {
+		i, has := params[k]
+		if !has || i == nil {
+			continue
+		}
+		var ok bool
+		if v, ok = i.(string); !ok {
+			err = fmt.Errorf("param %s need string", k)
+		}
+		return
+	}
+	return
+}
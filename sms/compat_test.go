@@ -0,0 +1,93 @@
+package sms
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSendRequestFromMap(t *testing.T) {
+	req, err := SendRequestFromMap(map[string]interface{}{
+		"PhoneNumber":   "13012345678, 13112345678",
+		"SignName":      "sign",
+		"TemplateCode":  "SMS_001",
+		"TemplateParam": `{"code":"1234"}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(req.Phones) != 2 || req.Phones[1] != "13112345678" || req.TemplateParam["code"] != "1234" {
+		t.Fatalf("%+v", req)
+	}
+
+	for _, params := range []map[string]interface{}{
+		{"SignName": "sign", "TemplateCode": "SMS_001"},
+		{"PhoneNumber": 13012345678, "SignName": "sign", "TemplateCode": "SMS_001"},
+		{"PhoneNumber": "13012345678", "TemplateCode": "SMS_001"},
+		{"PhoneNumber": "13012345678", "SignName": "sign"},
+		{"PhoneNumber": "13012345678", "SignName": "sign", "TemplateCode": "SMS_001", "TemplateParam": "1234"},
+	} {
+		if _, err = SendRequestFromMap(params); err == nil {
+			t.Fatalf("need error: %v", params)
+		}
+	}
+}
+
+func TestDetailQueryFromMap(t *testing.T) {
+	q, err := DetailQueryFromMap(map[string]interface{}{
+		"PhoneNumber": "13012345678",
+		"SendDate":    "20191212",
+		"BizId":       "1231231231231231",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.ReceiptId != "1231231231231231" || !q.SendDate.Equal(time.Date(2019, 12, 12, 0, 0, 0, 0, time.Local)) {
+		t.Fatalf("%+v", q)
+	}
+	if _, err = DetailQueryFromMap(map[string]interface{}{
+		"PhoneNumber": "13012345678",
+		"SendDate":    "2019-12-12",
+		"BizId":       "1231231231231231",
+	}); err == nil {
+		t.Fatal("need date error")
+	}
+	if _, err = DetailQueryFromMap(map[string]interface{}{"PhoneNumber": "13012345678"}); err == nil {
+		t.Fatal("need error")
+	}
+}
+
+func TestUsingMap(t *testing.T) {
+	s, err := UsingMap("aliyun", map[string]interface{}{
+		"regionId":     "cn-hangzhou",
+		"accessKeyId":  "AK",
+		"accessSecret": "SK"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.SupportBy() != "aliyun" {
+		t.Fatal(s.SupportBy())
+	}
+	if _, err = s.SendSMS(map[string]interface{}{"PhoneNumber": "13012345678"}); err == nil {
+		t.Fatal("need validation error")
+	}
+
+	if _, err = UsingMap("aliyun", map[string]interface{}{"region_id": "cn-hangzhou"}); err == nil {
+		t.Fatal("need access key error")
+	}
+	if _, err = UsingMap("aliyun", map[string]interface{}{"region_id": 1}); err == nil {
+		t.Fatal("need type error")
+	}
+	if _, err = Using("unknown", Config{}); err == nil {
+		t.Fatal("need type error")
+	}
+}
+
+func TestConfigFromMap(t *testing.T) {
+	cfg, err := ConfigFromMap(map[string]interface{}{"region_id": "cn-hangzhou", "accessKeyId": "id", "access_secret": "secret", "timezone": "UTC"})
+	if err != nil || cfg.RegionId != "cn-hangzhou" || cfg.AccessKeyId != "id" || cfg.Location != time.UTC {
+		t.Fatalf("%+v %v", cfg, err)
+	}
+	if _, err = ConfigFromMap(map[string]interface{}{"timezone": "Mars/Base"}); err == nil {
+		t.Fatal("need timezone error")
+	}
+}
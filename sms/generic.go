@@ -0,0 +1,374 @@
+package sms
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// GenericHTTPSMS sends one request per phone by templates, for vendors with
+// simple REST API. It is configured by Config.Options, all templates are
+// text/template executed with GenericHTTPData, "json" func quotes a value.
+//
+//	url               send url, "": Config.Endpoint
+//	method            default POST
+//	content_type      default application/json
+//	body              body template, e.g. {"to":{{json .Phone}},"text":{{json .Text}}}
+//	header.<Name>     header template, e.g. header.Authorization=Bearer {{.AccessSecret}}
+//	id_path           json path of message id in response, e.g. data.id
+//	code_path         json path of result code, "": checks http status only
+//	success_codes     comma separated codes of success
+//	message_path      json path of error message
+//	country_code      for phones without country code
+//	detail_url        detail url template, "": GetDetail is unsupported
+//	detail_method     default GET
+//	detail_body       detail body template
+//	status_path       json path of delivery status in detail response
+//	delivered_status  comma separated values of delivered
+//	failed_status     comma separated values of failed, others are pending
+//	error_path        json path of delivery error code
+type GenericHTTPSMS struct {
+	cfg         Config
+	countryCode string
+	send        genericRequest
+	detail      *genericRequest
+
+	idPath, codePath, messagePath string
+	successCodes                  []string
+	statusPath, errorPath         string
+	deliveredStatus, failedStatus []string
+
+	cli       *http.Client
+	templates *TemplateRegistry
+}
+
+type genericRequest struct {
+	method      string
+	contentType string
+	url         *template.Template
+	body        *template.Template
+	header      map[string]*template.Template
+}
+
+// GenericHTTPData is the data of templates
+type GenericHTTPData struct {
+	Phone        string //E.164
+	PhoneDigits  string //E.164 without "+"
+	Text         string //TemplateCode rendered by TemplateParam with "{name}" placeholders
+	SignName     string
+	TemplateCode string
+	Params       map[string]string
+	AccessKeyId  string
+	AccessSecret string
+	AppId        string
+	ReceiptId    string //detail only
+	Timestamp    int64
+}
+
+var genericFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		d, err := json.Marshal(v)
+		return string(d), err
+	},
+}
+
+func (s *GenericHTTPSMS) InitSMS(cfg Config) (instance SMS, err error) {
+	opt := cfg.Options
+	s.cfg = cfg
+	s.countryCode = opt["country_code"]
+	u := opt["url"]
+	if u == "" {
+		u = cfg.Endpoint
+	}
+	if u == "" {
+		err = errors.New("lost url")
+		return
+	}
+	if s.send, err = newGenericRequest(opt, "", u, opt["method"], opt["body"], http.MethodPost); err != nil {
+		return
+	}
+	if opt["detail_url"] != "" {
+		var d genericRequest
+		if d, err = newGenericRequest(opt, "detail", opt["detail_url"], opt["detail_method"], opt["detail_body"], http.MethodGet); err != nil {
+			return
+		}
+		s.detail = &d
+		if s.statusPath = opt["status_path"]; s.statusPath == "" {
+			err = errors.New("lost status_path")
+			return
+		}
+		s.deliveredStatus = splitList(opt["delivered_status"])
+		s.failedStatus = splitList(opt["failed_status"])
+		s.errorPath = opt["error_path"]
+	}
+	s.idPath, s.codePath, s.messagePath = opt["id_path"], opt["code_path"], opt["message_path"]
+	s.successCodes = splitList(opt["success_codes"])
+	if s.codePath != "" && len(s.successCodes) == 0 {
+		err = errors.New("lost success_codes")
+		return
+	}
+	s.cli = newHTTPClient(cfg.Timeout)
+	s.templates = cfg.Templates
+	instance = s
+	return
+}
+
+func newGenericRequest(opt map[string]string, name, u, method, body, defaultMethod string) (r genericRequest, err error) {
+	if r.method = strings.ToUpper(method); r.method == "" {
+		r.method = defaultMethod
+	}
+	if r.contentType = opt["content_type"]; r.contentType == "" {
+		r.contentType = "application/json"
+	}
+	if r.url, err = template.New(name + "url").Funcs(genericFuncs).Parse(u); err != nil {
+		return
+	}
+	if body != "" {
+		if r.body, err = template.New(name + "body").Funcs(genericFuncs).Parse(body); err != nil {
+			return
+		}
+	}
+	r.header = make(map[string]*template.Template)
+	for k, v := range opt {
+		if !strings.HasPrefix(k, "header.") {
+			continue
+		}
+		if r.header[k[7:]], err = template.New(k).Funcs(genericFuncs).Parse(v); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (r *genericRequest) do(cli *http.Client, data *GenericHTTPData) (status int, resp interface{}, err error) {
+	exec := func(t *template.Template) (string, error) {
+		buf := bytes.NewBuffer(nil)
+		err := t.Execute(buf, data)
+		return buf.String(), err
+	}
+	u, err := exec(r.url)
+	if err != nil {
+		return
+	}
+	var body []byte
+	if r.body != nil {
+		var b string
+		if b, err = exec(r.body); err != nil {
+			return
+		}
+		body = []byte(b)
+	}
+	header := http.Header{}
+	for k, t := range r.header {
+		var v string
+		if v, err = exec(t); err != nil {
+			return
+		}
+		header.Set(k, v)
+	}
+	contentType := r.contentType
+	if body == nil {
+		contentType = ""
+	}
+	status, d, err := sendHTTP(cli, r.method, u, contentType, body, header)
+	if err != nil {
+		return
+	}
+	if len(bytes.TrimSpace(d)) != 0 && json.Unmarshal(d, &resp) != nil {
+		//a 2xx response which is not json is accepted, e.g. "OK"
+		resp = nil
+		if status/100 != 2 {
+			err = &HTTPError{StatusCode: status, Body: string(d)}
+		}
+	}
+	return
+}
+
+func (s *GenericHTTPSMS) newData(phone string) *GenericHTTPData {
+	return &GenericHTTPData{
+		Phone:        phone,
+		PhoneDigits:  strings.TrimPrefix(phone, "+"),
+		AccessKeyId:  s.cfg.AccessKeyId,
+		AccessSecret: s.cfg.AccessSecret,
+		AppId:        s.cfg.AppId,
+		Timestamp:    time.Now().Unix(),
+	}
+}
+
+func (s *GenericHTTPSMS) SendSMS(req SendRequest) (r Result, err error) {
+	if req, err = resolveRequest(s.templates, req, s.SupportBy(), true); err != nil {
+		return
+	}
+	phones := make([]string, len(req.Phones))
+	for i, p := range req.Phones {
+		if phones[i], err = NormalizeE164(p, s.countryCode); err != nil {
+			return
+		}
+	}
+	//phones sent before a failed one are kept in Details, or they would be sent again by MultiSMS
+	var requestErr error
+	for _, p := range phones {
+		data := s.newData(p)
+		data.Text = renderTemplate(req.TemplateCode, req.TemplateParam)
+		data.SignName, data.TemplateCode, data.Params = req.SignName, req.TemplateCode, req.TemplateParam
+
+		var (
+			status int
+			resp   interface{}
+		)
+		pr := PhoneResult{Phone: p}
+		if status, resp, err = s.send.do(s.cli, data); err != nil {
+			if requestErr == nil {
+				requestErr = err
+			}
+			failPhone(&pr, err)
+			r.Details = append(r.Details, pr)
+			continue
+		}
+		if s.codePath != "" {
+			code, _ := jsonPath(resp, s.codePath)
+			if !inList(code, s.successCodes) {
+				pr.ErrCode = code
+			}
+		} else if status/100 != 2 {
+			pr.ErrCode = strconv.Itoa(status)
+		}
+		if pr.ErrCode != "" {
+			pr.Message, _ = jsonPath(resp, s.messagePath)
+		} else {
+			pr.ReceiptId, _ = jsonPath(resp, s.idPath)
+			if r.ReceiptId == "" {
+				r.ReceiptId = pr.ReceiptId
+			}
+		}
+		r.Details = append(r.Details, pr)
+	}
+	for _, pr := range r.Details {
+		if pr.ErrCode == "" {
+			return r, nil
+		}
+	}
+	r.ErrCode = r.Details[0].ErrCode
+	if err = requestErr; err == nil {
+		err = fmt.Errorf("%s(%s)", r.Details[0].Message, r.ErrCode)
+	}
+	return
+}
+
+func (s *GenericHTTPSMS) GetDetail(q DetailQuery) (r Receipt, err error) {
+	if s.detail == nil {
+		err = errors.New("detail is unsupported")
+		return
+	}
+	if q.ReceiptId == "" {
+		err = errors.New("lost receipt id")
+		return
+	}
+	phone := q.Phone
+	if phone != "" {
+		if phone, err = NormalizeE164(phone, s.countryCode); err != nil {
+			return
+		}
+	}
+	data := s.newData(phone)
+	data.ReceiptId = q.ReceiptId
+	status, resp, err := s.detail.do(s.cli, data)
+	if err != nil {
+		return
+	}
+	if status == http.StatusNotFound {
+		err = ErrorSMSNoReceipt
+		return
+	}
+	if status/100 != 2 {
+		err = fmt.Errorf("http status %d", status)
+		return
+	}
+	st, has := jsonPath(resp, s.statusPath)
+	if !has {
+		err = ErrorSMSNoReceipt
+		return
+	}
+	r.Provider, r.ReceiptId, r.Phone = s.SupportBy(), q.ReceiptId, q.Phone
+	r.SendDate = q.SendDate
+	switch {
+	case inList(st, s.deliveredStatus):
+		r.ErrCode, r.SendStat = "DELIVERED", StatusDone
+	case inList(st, s.failedStatus):
+		r.SendStat = StatusFail
+		if r.ErrCode, _ = jsonPath(resp, s.errorPath); r.ErrCode == "" {
+			r.ErrCode = st
+		}
+		r.ErrCategory = ClassifyError(r.ErrCode)
+	default:
+		r.SendStat = StatusWait
+	}
+	return
+}
+
+func (s *GenericHTTPSMS) SupportBy() string {
+	return "http"
+}
+
+// jsonPath returns value of dotted path like "data.items.0.id" as string
+func jsonPath(v interface{}, path string) (s string, has bool) {
+	if path == "" {
+		return
+	}
+	for _, k := range strings.Split(path, ".") {
+		switch t := v.(type) {
+		case map[string]interface{}:
+			if v, has = t[k]; !has {
+				return
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(k)
+			if err != nil || i < 0 || i >= len(t) {
+				has = false
+				return
+			}
+			v = t[i]
+		default:
+			has = false
+			return
+		}
+	}
+	switch t := v.(type) {
+	case nil:
+		return "", false
+	case string:
+		s = t
+	case float64:
+		s = strconv.FormatFloat(t, 'f', -1, 64)
+	case bool:
+		s = strconv.FormatBool(t)
+	default:
+		d, _ := json.Marshal(t)
+		s = string(d)
+	}
+	return s, true
+}
+
+func splitList(s string) (l []string) {
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			l = append(l, v)
+		}
+	}
+	return
+}
+
+func inList(s string, l []string) bool {
+	for _, v := range l {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
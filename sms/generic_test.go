@@ -0,0 +1,187 @@
+package sms
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGenericHTTPSMS(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"result":{"code":401,"message":"unauthorized"}}`))
+			return
+		}
+		switch r.Method + " " + r.URL.Path {
+		case "POST /v1/messages":
+			var m map[string]string
+			if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+				t.Error(err)
+			}
+			if m["text"] != `code "1234"` || m["sender"] != "gutil" {
+				t.Errorf("body error: %v", m)
+			}
+			if m["to"] == "+4915100000000" {
+				w.Write([]byte(`{"result":{"code":22,"message":"blocked"}}`))
+				return
+			}
+			w.Write([]byte(`{"result":{"code":0},"messages":[{"id":"m-` + m["to"][1:] + `"}]}`))
+		case "GET /v1/messages/m-447700900000":
+			w.Write([]byte(`{"status":"DELIVRD"}`))
+		case "GET /v1/messages/m-2":
+			w.Write([]byte(`{"status":"REJECTD","error":"E12"}`))
+		case "GET /v1/messages/m-3":
+			w.Write([]byte(`{"status":"ENROUTE"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	s, err := Using("http", Config{
+		AccessSecret: "secret",
+		Endpoint:     srv.URL + "/v1/messages",
+		Options: map[string]string{
+			"body":                 `{"to":{{json .Phone}},"text":{{json .Text}},"sender":{{json .SignName}}}`,
+			"header.Authorization": "Bearer {{.AccessSecret}}",
+			"id_path":              "messages.0.id",
+			"code_path":            "result.code",
+			"success_codes":        "0",
+			"message_path":         "result.message",
+			"detail_url":           srv.URL + "/v1/messages/{{.ReceiptId}}",
+			"status_path":          "status",
+			"delivered_status":     "DELIVRD",
+			"failed_status":        "REJECTD,UNDELIV",
+			"error_path":           "error",
+			"country_code":         "44",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := SendRequest{
+		Phones:        []string{"07700 900000", "+49 151 00000000"},
+		SignName:      "gutil",
+		TemplateCode:  `code "{code}"`,
+		TemplateParam: map[string]string{"code": "1234"},
+	}
+	r, err := s.SendSMS(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.ReceiptId != "m-447700900000" || r.Details[1].ErrCode != "22" || r.Details[1].Message != "blocked" {
+		t.Fatalf("%+v", r)
+	}
+
+	for id, stat := range map[string]SendStatus{"m-447700900000": StatusDone, "m-2": StatusFail, "m-3": StatusWait} {
+		rc, err := s.GetDetail(DetailQuery{ReceiptId: id, SendDate: time.Now()})
+		if err != nil || rc.SendStat != stat {
+			t.Fatalf("%s: %+v %v", id, rc, err)
+		}
+		if stat == StatusFail && (rc.ErrCode != "E12" || rc.ErrCategory != ErrCategoryUnknown) {
+			t.Fatalf("%+v", rc)
+		}
+	}
+	if _, err = s.GetDetail(DetailQuery{ReceiptId: "m-4"}); err != ErrorSMSNoReceipt {
+		t.Fatal("need no receipt error", err)
+	}
+
+	//status code only
+	s, err = Using("generic", Config{
+		AccessSecret: "wrong",
+		Options: map[string]string{
+			"url":                  srv.URL + "/v1/messages",
+			"body":                 `{"to":{{json .Phone}}}`,
+			"header.Authorization": "Bearer {{.AccessSecret}}",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Phones = []string{"+447700900000"}
+	if r, err = s.SendSMS(req); err == nil || r.ErrCode != "401" {
+		t.Fatalf("need error: %+v %v", r, err)
+	}
+	if _, err = s.GetDetail(DetailQuery{ReceiptId: "m-1"}); err == nil {
+		t.Fatal("need unsupported error")
+	}
+
+	for _, opt := range []map[string]string{
+		{},
+		{"url": "{{.Phone"},
+		{"url": "http://localhost", "code_path": "code"},
+		{"url": "http://localhost", "detail_url": "http://localhost/{{.ReceiptId}}"},
+	} {
+		if _, err = Using("http", Config{Options: opt}); err == nil {
+			t.Fatalf("need error: %v", opt)
+		}
+	}
+}
+
+// TestGenericHTTPSMSPartial checks phones sent before a network failure are kept
+func TestGenericHTTPSMSPartial(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var m map[string]string
+		json.NewDecoder(r.Body).Decode(&m)
+		switch m["to"] {
+		case "+4915100000001":
+			dropConn(t, w)
+		case "+4915100000002":
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.Write([]byte(`{"id":"m-` + m["to"][1:] + `"}`))
+		}
+	}))
+	defer srv.Close()
+
+	s, err := Using("http", Config{
+		Endpoint: srv.URL,
+		Options:  map[string]string{"body": `{"to":{{json .Phone}}}`, "id_path": "id"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := s.SendSMS(SendRequest{Phones: []string{"+4915100000000", "+4915100000001", "+4915100000002", "+4915100000003"}, TemplateCode: "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes := make([]string, len(r.Details))
+	for i, d := range r.Details {
+		codes[i] = d.ErrCode + ":" + d.ReceiptId
+	}
+	if got := strings.Join(codes, ","); r.ReceiptId != "m-4915100000000" || got != ":m-4915100000000,TRANSPORT:,502:,:m-4915100000003" {
+		t.Fatal(got)
+	}
+
+	if r, err = s.SendSMS(SendRequest{Phones: []string{"+4915100000001"}, TemplateCode: "hi"}); err == nil || r.ErrCode != ErrCodeTransport {
+		t.Fatalf("need network error: %+v %v", r, err)
+	}
+}
+
+func TestGenericHTTPSMSPlainText(t *testing.T) {
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte("OK"))
+	}))
+	defer srv.Close()
+
+	s, err := Using("http", Config{Endpoint: srv.URL, Options: map[string]string{"body": `{"to":{{json .Phone}}}`}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := SendRequest{Phones: []string{"+4915100000000"}, TemplateCode: "hi"}
+	r, err := s.SendSMS(req)
+	if err != nil || len(r.Details) != 1 || r.Details[0].ErrCode != "" {
+		t.Fatalf("plain text 200 should be accepted: %+v %v", r, err)
+	}
+
+	status = http.StatusServiceUnavailable
+	if r, err = s.SendSMS(req); err == nil || r.ErrCode != "503" || !IsProviderError(r, err) {
+		t.Fatalf("need 503 error: %+v %v", r, err)
+	}
+}
@@ -0,0 +1,85 @@
+package sms
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const defaultHTTPTimeout = 10 * time.Second
+
+func newHTTPClient(timeout time.Duration) *http.Client {
+	if timeout <= 0 {
+		timeout = defaultHTTPTimeout
+	}
+	return &http.Client{Timeout: timeout}
+}
+
+// doHTTP sends request and decodes json response into out, out could be nil.
+// Non 2xx response is an error only if the body can't be decoded.
+func doHTTP(cli *http.Client, method, url, contentType string, body []byte, header http.Header, out interface{}) (err error) {
+	status, data, err := sendHTTP(cli, method, url, contentType, body, header)
+	if err != nil {
+		return
+	}
+	if out != nil && len(data) != 0 {
+		if err = json.Unmarshal(data, out); err == nil {
+			return
+		}
+	}
+	if status/100 != 2 {
+		err = &HTTPError{StatusCode: status, Body: string(data)}
+	}
+	return
+}
+
+// sendHTTP sends request and returns status code and body
+func sendHTTP(cli *http.Client, method, url, contentType string, body []byte, header http.Header) (status int, data []byte, err error) {
+	var rd io.Reader
+	if body != nil {
+		rd = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, url, rd)
+	if err != nil {
+		return
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := cli.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if data, err = ioutil.ReadAll(resp.Body); err != nil {
+		return
+	}
+	status = resp.StatusCode
+	return
+}
+
+// HTTPError is returned when provider responds non 2xx status with unknown body
+type HTTPError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("http status %d: %s", e.StatusCode, e.Body)
+}
+
+// failPhone sets ErrCode and Message of a phone failed by request error
+func failPhone(pr *PhoneResult, err error) {
+	pr.ErrCode, pr.Message = ErrCodeTransport, err.Error()
+	if he, ok := err.(*HTTPError); ok {
+		pr.ErrCode = strconv.Itoa(he.StatusCode)
+	}
+}
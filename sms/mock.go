@@ -0,0 +1,209 @@
+package sms
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MockSMS keeps messages in memory instead of sending, for tests
+type MockSMS struct {
+	name      string
+	status    SendStatus //default status of receipts
+	templates *TemplateRegistry
+
+	mu       sync.Mutex
+	seq      int
+	sent     []MockMessage
+	fails    []mockFail
+	phones   map[string]string //phone: error code
+	respond  func(SendRequest) (Result, error)
+	receipts map[string]Receipt //receiptId:phone
+}
+
+// MockMessage is a message sent to one phone
+type MockMessage struct {
+	Phone     string
+	ReceiptId string
+	Content   string //TemplateCode rendered with TemplateParam
+	Request   SendRequest
+	Time      time.Time
+}
+
+type mockFail struct {
+	code string
+	err  error
+}
+
+func NewMockSMS() *MockSMS {
+	s, _ := (&MockSMS{}).InitSMS(Config{})
+	return s.(*MockSMS)
+}
+
+// InitSMS Options: name(default mock), status(WAIT, FAIL, DONE of receipts, default DONE)
+func (s *MockSMS) InitSMS(cfg Config) (instance SMS, err error) {
+	if s.name = cfg.Options["name"]; s.name == "" {
+		s.name = "mock"
+	}
+	s.status = StatusDone
+	if st, has := cfg.Options["status"]; has {
+		switch s.status = SendStatus(strings.ToUpper(st)); s.status {
+		case StatusWait, StatusFail, StatusDone:
+		default:
+			err = fmt.Errorf("invalid status %s", st)
+			return
+		}
+	}
+	s.phones = make(map[string]string)
+	s.receipts = make(map[string]Receipt)
+	s.templates = cfg.Templates
+	instance = s
+	return
+}
+
+func (s *MockSMS) SendSMS(req SendRequest) (r Result, err error) {
+	if req, err = resolveRequest(s.templates, req, s.SupportBy(), true); err != nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r.Provider = s.name
+	if len(s.fails) != 0 {
+		f := s.fails[0]
+		s.fails = s.fails[1:]
+		r.ErrCode, err = f.code, f.err
+		return
+	}
+	if s.respond != nil {
+		if r, err = s.respond(req); err != nil {
+			return
+		}
+	}
+
+	now := time.Now()
+	for _, phone := range req.Phones {
+		if code, has := s.phones[phone]; has {
+			r.Details = append(r.Details, PhoneResult{Phone: phone, ErrCode: code, Message: "scripted failure", Provider: s.name})
+			continue
+		}
+		s.seq++
+		m := MockMessage{
+			Phone:     phone,
+			ReceiptId: fmt.Sprintf("%s-%d", s.name, s.seq),
+			Content:   renderTemplate(req.TemplateCode, req.TemplateParam),
+			Request:   req,
+			Time:      now,
+		}
+		s.sent = append(s.sent, m)
+		r.Details = append(r.Details, PhoneResult{Phone: phone, ReceiptId: m.ReceiptId, Provider: s.name})
+		if r.ReceiptId == "" {
+			r.ReceiptId = m.ReceiptId
+		}
+	}
+	if r.ReceiptId == "" {
+		r.ErrCode = r.Details[0].ErrCode
+		err = fmt.Errorf("%s(%s)", r.Details[0].Message, r.ErrCode)
+	}
+	return
+}
+
+// GetDetail returns scripted receipt, or receipt with default status of sent message
+func (s *MockSMS) GetDetail(q DetailQuery) (r Receipt, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if rc, has := s.receipts[q.ReceiptId+":"+q.Phone]; has {
+		return rc, nil
+	}
+	for _, m := range s.sent {
+		if m.ReceiptId != q.ReceiptId || (q.Phone != "" && m.Phone != q.Phone) {
+			continue
+		}
+		r = Receipt{
+			Provider:  s.name,
+			ReceiptId: m.ReceiptId,
+			Phone:     m.Phone,
+			Content:   m.Content,
+			SendDate:  m.Time,
+			SendStat:  s.status,
+		}
+		switch s.status {
+		case StatusDone:
+			r.ErrCode, r.ReceiveDate = "DELIVERED", m.Time
+		case StatusFail:
+			r.ErrCode, r.ErrCategory, r.ReceiveDate = "UNDELIV", ErrCategoryUnreachable, m.Time
+		}
+		return
+	}
+	err = ErrorSMSNoReceipt
+	return
+}
+
+func (s *MockSMS) SupportBy() string {
+	return s.name
+}
+
+// FailNext makes the next send fail with err, calls are queued
+func (s *MockSMS) FailNext(errCode string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fails = append(s.fails, mockFail{code: errCode, err: err})
+}
+
+// FailPhone makes sends to the phone fail with errCode, "" to recover
+func (s *MockSMS) FailPhone(phone, errCode string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if errCode == "" {
+		delete(s.phones, phone)
+		return
+	}
+	s.phones[phone] = errCode
+}
+
+// Respond is called before recording messages, returning error fails the send, nil to remove
+func (s *MockSMS) Respond(fn func(SendRequest) (Result, error)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.respond = fn
+}
+
+// SetReceipt scripts the receipt of a message
+func (s *MockSMS) SetReceipt(receiptId, phone string, r Receipt) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r.Provider == "" {
+		r.Provider = s.name
+	}
+	r.ReceiptId, r.Phone = receiptId, phone
+	s.receipts[receiptId+":"+phone] = r
+}
+
+// Sent returns a copy of sent messages in order
+func (s *MockSMS) Sent() []MockMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]MockMessage(nil), s.sent...)
+}
+
+// Last returns the latest message sent to the phone
+func (s *MockSMS) Last(phone string) (m MockMessage, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.sent) - 1; i >= 0; i-- {
+		if s.sent[i].Phone == phone {
+			return s.sent[i], true
+		}
+	}
+	return
+}
+
+// Reset clears messages and scripts
+func (s *MockSMS) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq = 0
+	s.sent, s.fails, s.respond = nil, nil, nil
+	s.phones = make(map[string]string)
+	s.receipts = make(map[string]Receipt)
+}
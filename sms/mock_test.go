@@ -0,0 +1,105 @@
+package sms
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMockSMS(t *testing.T) {
+	sms, err := Using("mock", Config{Options: map[string]string{"name": "fake"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := sms.(*MockSMS)
+
+	req := SendRequest{Phones: []string{"13012345678", "13112345678"}, TemplateCode: "code {code}", TemplateParam: map[string]string{"code": "1234"}}
+	r, err := s.SendSMS(req)
+	if err != nil || r.Provider != "fake" || r.ReceiptId != "fake-1" || len(r.Details) != 2 {
+		t.Fatalf("%+v %v", r, err)
+	}
+	m, ok := s.Last("13112345678")
+	if !ok || m.Content != "code 1234" || m.ReceiptId != "fake-2" {
+		t.Fatalf("%+v", m)
+	}
+	if _, ok = s.Last("13212345678"); ok {
+		t.Fatal("need no message")
+	}
+
+	rc, err := s.GetDetail(DetailQuery{Phone: "13112345678", ReceiptId: "fake-2", SendDate: time.Now()})
+	if err != nil || rc.SendStat != StatusDone || rc.Content != "code 1234" {
+		t.Fatalf("%+v %v", rc, err)
+	}
+	s.SetReceipt("fake-2", "13112345678", Receipt{SendStat: StatusFail, ErrCode: "REJECTD", ErrCategory: ErrCategoryBlocked})
+	if rc, err = s.GetDetail(DetailQuery{Phone: "13112345678", ReceiptId: "fake-2"}); err != nil || rc.SendStat != StatusFail || rc.Provider != "fake" {
+		t.Fatalf("%+v %v", rc, err)
+	}
+	if _, err = s.GetDetail(DetailQuery{Phone: "13112345678", ReceiptId: "fake-9"}); err != ErrorSMSNoReceipt {
+		t.Fatal("need no receipt error", err)
+	}
+
+	//scripted failures
+	throttled := errors.New("throttled")
+	s.FailNext("THROTTLED", throttled)
+	if r, err = s.SendSMS(req); err != throttled || r.ErrCode != "THROTTLED" {
+		t.Fatalf("%+v %v", r, err)
+	}
+	s.FailPhone("13012345678", "isv.MOBILE_NUMBER_ILLEGAL")
+	if r, err = s.SendSMS(req); err != nil || r.Details[0].ErrCode == "" || r.ReceiptId != "fake-3" {
+		t.Fatalf("%+v %v", r, err)
+	}
+	if r, err = s.SendSMS(SendRequest{Phones: []string{"13012345678"}, TemplateCode: "T"}); err == nil {
+		t.Fatal("need phone error")
+	}
+	s.FailPhone("13012345678", "")
+	s.Respond(func(SendRequest) (Result, error) { return Result{}, throttled })
+	if _, err = s.SendSMS(req); err != throttled {
+		t.Fatal("need respond error", err)
+	}
+	if len(s.Sent()) != 3 {
+		t.Fatal("sent", len(s.Sent()))
+	}
+
+	s.Reset()
+	if _, err = s.SendSMS(req); err != nil || len(s.Sent()) != 2 {
+		t.Fatal(err, s.Sent())
+	}
+	if _, err = Using("mock", Config{Options: map[string]string{"status": "lost"}}); err == nil {
+		t.Fatal("need status error")
+	}
+}
+
+func TestMockSMSConcurrent(t *testing.T) {
+	s := NewMockSMS()
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r, err := s.SendSMS(testSendRequest("13012345678"))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			s.GetDetail(DetailQuery{Phone: "13012345678", ReceiptId: r.ReceiptId})
+			s.Last("13012345678")
+		}()
+	}
+	wg.Wait()
+	if len(s.Sent()) != 20 {
+		t.Fatal("sent", len(s.Sent()))
+	}
+}
+
+func TestMockSMSWithCodeService(t *testing.T) {
+	s := NewMockSMS()
+	c := NewCodeService(s, NewMemoryCodeStore(), "gutil", "your code is {code}")
+	if _, err := c.Send("13012345678", "login"); err != nil {
+		t.Fatal(err)
+	}
+	m, _ := s.Last("13012345678")
+	if err := c.Verify("13012345678", "login", m.Request.TemplateParam["code"]); err != nil {
+		t.Fatal(err, m)
+	}
+}
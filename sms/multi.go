@@ -0,0 +1,351 @@
+package sms
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrorSMSNoProvider  = errors.New("no provider for the phone")
+	ErrorSMSUnavailable = errors.New("all providers are unavailable")
+)
+
+const (
+	defaultFailureThreshold = 3
+	defaultCoolDown         = time.Minute
+)
+
+// Route is a provider of MultiSMS
+type Route struct {
+	Name     string //unique, "": SMS.SupportBy()
+	SMS      SMS
+	Priority int      //lower is tried first
+	Weight   int      //spreads load among the same priority, 0: 1
+	Prefixes []string //E.164 prefixes of destination, like "+86"; empty: all
+}
+
+// MultiSMS sends by several providers. Providers matching the phone prefix are
+// tried in priority order on retryable errors, and spread by weight in the same
+// priority. A provider failed FailureThreshold times in a row is skipped for
+// CoolDown. Result.Provider tells which provider sent, set it to
+// DetailQuery.Provider to query the receipt.
+type MultiSMS struct {
+	FailureThreshold int
+	CoolDown         time.Duration
+	CountryCode      string //for phones without country code, default "86"
+	// IsRetryable decides whether to try next provider, only retryable errors count to the circuit breaker.
+	// nil: IsProviderError, errors of request such as sign, phone or template are not retried
+	IsRetryable func(r Result, err error) bool
+
+	routes []*route
+	mu     sync.Mutex
+	rnd    *rand.Rand
+	now    func() time.Time
+}
+
+type route struct {
+	Route
+	failures  int
+	openUntil time.Time
+}
+
+func NewMultiSMS(routes ...Route) (s *MultiSMS, err error) {
+	if len(routes) == 0 {
+		err = errors.New("lost providers")
+		return
+	}
+	s = &MultiSMS{
+		FailureThreshold: defaultFailureThreshold,
+		CoolDown:         defaultCoolDown,
+		CountryCode:      "86",
+		rnd:              rand.New(rand.NewSource(time.Now().UnixNano())),
+		now:              time.Now,
+	}
+	names := make(map[string]bool)
+	for _, r := range routes {
+		if r.SMS == nil {
+			err = errors.New("lost sms of route")
+			return nil, err
+		}
+		if r.Name == "" {
+			r.Name = r.SMS.SupportBy()
+		}
+		if names[r.Name] {
+			err = fmt.Errorf("duplicate route name %s", r.Name)
+			return nil, err
+		}
+		names[r.Name] = true
+		if r.Weight <= 0 {
+			r.Weight = 1
+		}
+		s.routes = append(s.routes, &route{Route: r})
+	}
+	return
+}
+
+// InitSMS applies Options: failure_threshold, cool_down(time.Duration string), country_code
+func (s *MultiSMS) InitSMS(cfg Config) (instance SMS, err error) {
+	if v := cfg.Options["failure_threshold"]; v != "" {
+		if s.FailureThreshold, err = strconv.Atoi(v); err != nil {
+			return
+		}
+	}
+	if v := cfg.Options["cool_down"]; v != "" {
+		if s.CoolDown, err = time.ParseDuration(v); err != nil {
+			return
+		}
+	}
+	if v := cfg.Options["country_code"]; v != "" {
+		s.CountryCode = v
+	}
+	instance = s
+	return
+}
+
+func (s *MultiSMS) SendSMS(req SendRequest) (r Result, err error) {
+	if err = req.Validate(); err != nil {
+		return
+	}
+	//group phones by candidate routes
+	var (
+		groups []*phoneGroup
+		index  = make(map[string]*phoneGroup)
+	)
+	for _, p := range req.Phones {
+		e164, err := NormalizeE164(p, s.CountryCode)
+		if err != nil {
+			return r, err
+		}
+		rs := s.candidates(e164)
+		if len(rs) == 0 {
+			return r, fmt.Errorf("%v: %s", ErrorSMSNoProvider, p)
+		}
+		key := routesKey(rs)
+		g := index[key]
+		if g == nil {
+			g = &phoneGroup{routes: rs}
+			index[key] = g
+			groups = append(groups, g)
+		}
+		g.phones = append(g.phones, p)
+	}
+
+	var (
+		firstErr            error
+		firstCode, provider string
+	)
+	for _, g := range groups {
+		gr := req
+		gr.Phones = g.phones
+		res, err := s.sendGroup(g.routes, gr)
+		if err != nil {
+			if firstErr == nil {
+				firstErr, firstCode, provider = err, res.ErrCode, res.Provider
+			}
+			for _, p := range g.phones {
+				r.Details = append(r.Details, PhoneResult{Phone: p, Provider: res.Provider, ErrCode: res.ErrCode, Message: err.Error()})
+			}
+			continue
+		}
+		if r.ReceiptId == "" {
+			r.ReceiptId, r.Provider = res.ReceiptId, res.Provider
+		}
+		if len(res.Details) != 0 {
+			for _, d := range res.Details {
+				d.Provider = res.Provider
+				r.Details = append(r.Details, d)
+			}
+			continue
+		}
+		for _, p := range g.phones {
+			r.Details = append(r.Details, PhoneResult{Phone: p, Provider: res.Provider, ReceiptId: res.ReceiptId})
+		}
+	}
+	if r.ReceiptId == "" {
+		r.ErrCode, r.Provider, err = firstCode, provider, firstErr
+	}
+	return
+}
+
+type phoneGroup struct {
+	routes []*route
+	phones []string
+}
+
+// sendGroup tries routes in order until success or non-retryable error
+func (s *MultiSMS) sendGroup(routes []*route, req SendRequest) (r Result, err error) {
+	tried := 0
+	for _, rt := range s.order(routes) {
+		if !s.available(rt) {
+			continue
+		}
+		tried++
+		r, err = rt.SMS.SendSMS(req)
+		r.Provider = rt.Name
+		if err == nil {
+			s.report(rt, true)
+			return
+		}
+		if !s.retryable(r, err) {
+			//the provider works, the request is wrong
+			return
+		}
+		s.report(rt, false)
+	}
+	if tried == 0 {
+		r, err = Result{}, ErrorSMSUnavailable
+	}
+	return
+}
+
+// GetDetail queries the provider of DetailQuery.Provider
+func (s *MultiSMS) GetDetail(q DetailQuery) (r Receipt, err error) {
+	if q.Provider == "" {
+		err = errors.New("lost provider")
+		return
+	}
+	for _, rt := range s.routes {
+		if rt.Name == q.Provider {
+			r, err = rt.SMS.GetDetail(q)
+			return
+		}
+	}
+	err = fmt.Errorf("unknown provider %s", q.Provider)
+	return
+}
+
+func (s *MultiSMS) SupportBy() string {
+	return "multi"
+}
+
+func (s *MultiSMS) retryable(r Result, err error) bool {
+	if s.IsRetryable != nil {
+		return s.IsRetryable(r, err)
+	}
+	return IsProviderError(r, err)
+}
+
+// throttlingCodes of providers, the request could be sent by another provider
+var throttlingCodes = map[string]bool{
+	"103": true, "104": true, //253: submit too fast, system busy
+	"20429":                true, //twilio: too many requests
+	"RequestLimitExceeded": true, //tencent
+	"isp.SYSTEM_ERROR":     true, //aliyun
+	"ServiceUnavailable":   true, //aliyun
+}
+
+// IsProviderError returns true for errors of provider side: network errors, 5xx or 429 responses and throttling
+func IsProviderError(r Result, err error) bool {
+	if err == nil {
+		return false
+	}
+	var (
+		ne net.Error
+		he *HTTPError
+		se interface{ HttpStatus() int } //errors of aliyun sdk
+	)
+	switch {
+	case errors.As(err, &ne), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return true
+	case errors.As(err, &he):
+		return he.StatusCode/100 == 5 || he.StatusCode == http.StatusTooManyRequests
+	case errors.As(err, &se) && (se.HttpStatus()/100 == 5 || se.HttpStatus() == http.StatusTooManyRequests):
+		return true
+	}
+	return r.ErrCode == ErrCodeTransport || throttlingCodes[r.ErrCode] ||
+		strings.HasPrefix(r.ErrCode, "Throttling") || strings.HasPrefix(r.ErrCode, "InternalError")
+}
+
+// candidates returns routes matching the phone, sorted by priority
+func (s *MultiSMS) candidates(e164 string) (rs []*route) {
+	for _, rt := range s.routes {
+		if len(rt.Prefixes) == 0 {
+			rs = append(rs, rt)
+			continue
+		}
+		for _, p := range rt.Prefixes {
+			if strings.HasPrefix(e164, p) {
+				rs = append(rs, rt)
+				break
+			}
+		}
+	}
+	sort.SliceStable(rs, func(i, j int) bool {
+		return rs[i].Priority < rs[j].Priority
+	})
+	return
+}
+
+// order shuffles routes of the same priority by weight
+func (s *MultiSMS) order(rs []*route) (ordered []*route) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i < len(rs); {
+		j := i
+		for j < len(rs) && rs[j].Priority == rs[i].Priority {
+			j++
+		}
+		same := append([]*route(nil), rs[i:j]...)
+		for len(same) > 0 {
+			total := 0
+			for _, rt := range same {
+				total += rt.Weight
+			}
+			n := s.rnd.Intn(total)
+			for k, rt := range same {
+				if n -= rt.Weight; n < 0 {
+					ordered = append(ordered, rt)
+					same = append(same[:k], same[k+1:]...)
+					break
+				}
+			}
+		}
+		i = j
+	}
+	return
+}
+
+// available returns false while the circuit is open
+func (s *MultiSMS) available(rt *route) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !s.now().Before(rt.openUntil)
+}
+
+func (s *MultiSMS) report(rt *route, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ok {
+		rt.failures, rt.openUntil = 0, time.Time{}
+		return
+	}
+	threshold := s.FailureThreshold
+	if threshold <= 0 {
+		threshold = defaultFailureThreshold
+	}
+	if rt.failures++; rt.failures >= threshold {
+		cd := s.CoolDown
+		if cd <= 0 {
+			cd = defaultCoolDown
+		}
+		//half open after cool down, one more failure opens it again
+		rt.failures, rt.openUntil = threshold-1, s.now().Add(cd)
+	}
+}
+
+func routesKey(rs []*route) string {
+	names := make([]string, len(rs))
+	for i, rt := range rs {
+		names[i] = rt.Name
+	}
+	return strings.Join(names, "\x00")
+}
@@ -0,0 +1,208 @@
+package sms
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSMS fails by provider while fail is set, returns err of request while err is set
+type fakeSMS struct {
+	name  string
+	fail  bool
+	err   error
+	sent  []string
+	reqs  []SendRequest
+	query []string
+}
+
+func (s *fakeSMS) InitSMS(Config) (SMS, error) { return s, nil }
+func (s *fakeSMS) SupportBy() string           { return s.name }
+
+func (s *fakeSMS) SendSMS(req SendRequest) (r Result, err error) {
+	if s.fail {
+		r.ErrCode = "THROTTLED"
+		err = &HTTPError{StatusCode: 503, Body: "throttled"}
+		return
+	}
+	if s.err != nil {
+		err = s.err
+		return
+	}
+	s.sent = append(s.sent, req.Phones...)
+	s.reqs = append(s.reqs, req)
+	r.ReceiptId = s.name + "-" + strings.Join(req.Phones, ",")
+	return
+}
+
+func (s *fakeSMS) GetDetail(q DetailQuery) (r Receipt, err error) {
+	s.query = append(s.query, q.ReceiptId)
+	r.SendStat = "DONE"
+	return
+}
+
+func testSendRequest(phones ...string) SendRequest {
+	return SendRequest{Phones: phones, SignName: "gutil", TemplateCode: "T1"}
+}
+
+func TestMultiSMSFailover(t *testing.T) {
+	a, b := &fakeSMS{name: "a", fail: true}, &fakeSMS{name: "b"}
+	s, err := NewMultiSMS(Route{SMS: a, Priority: 1}, Route{SMS: b, Priority: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1000, 0)
+	s.now = func() time.Time { return now }
+	if _, err = s.InitSMS(Config{Options: map[string]string{"failure_threshold": "2", "cool_down": "30s"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := s.SendSMS(testSendRequest("13012345678"))
+	if err != nil || r.Provider != "b" || r.ReceiptId != "b-13012345678" || r.Details[0].Provider != "b" {
+		t.Fatalf("%+v %v", r, err)
+	}
+	rc, err := s.GetDetail(DetailQuery{Phone: "13012345678", ReceiptId: r.ReceiptId, SendDate: now, Provider: r.Provider})
+	if err != nil || rc.SendStat != "DONE" || len(b.query) != 1 {
+		t.Fatalf("%+v %v", rc, err)
+	}
+	if _, err = s.GetDetail(DetailQuery{ReceiptId: r.ReceiptId}); err == nil {
+		t.Fatal("need provider error")
+	}
+
+	//second failure opens circuit of a
+	s.SendSMS(testSendRequest("13012345678"))
+	a.fail = false
+	if r, _ = s.SendSMS(testSendRequest("13012345678")); r.Provider != "b" {
+		t.Fatal("open circuit not skipped", r.Provider)
+	}
+	//half open after cool down
+	now = now.Add(31 * time.Second)
+	if r, _ = s.SendSMS(testSendRequest("13012345678")); r.Provider != "a" {
+		t.Fatal("circuit not closed", r.Provider)
+	}
+
+	//non retryable
+	a.fail = true
+	s.IsRetryable = func(r Result, err error) bool { return r.ErrCode != "THROTTLED" }
+	if r, err = s.SendSMS(testSendRequest("13012345678")); err == nil || r.Provider != "a" || r.ErrCode != "THROTTLED" {
+		t.Fatalf("%+v %v", r, err)
+	}
+
+	//all open
+	b.fail = true
+	s.IsRetryable = nil
+	for i := 0; i < 3; i++ {
+		s.SendSMS(testSendRequest("13012345678"))
+	}
+	if _, err = s.SendSMS(testSendRequest("13012345678")); err != ErrorSMSUnavailable {
+		t.Fatal("need unavailable error", err)
+	}
+}
+
+func TestMultiSMSRouting(t *testing.T) {
+	cn, us, intl := &fakeSMS{name: "cn"}, &fakeSMS{name: "us"}, &fakeSMS{name: "intl"}
+	s, err := NewMultiSMS(
+		Route{SMS: cn, Prefixes: []string{"+86"}},
+		Route{SMS: us, Prefixes: []string{"+1"}},
+		Route{SMS: intl, Priority: 10},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := s.SendSMS(testSendRequest("13012345678", "+14155550100", "+447700900000", "+8613112345678"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(cn.sent, ",") != "13012345678,+8613112345678" || len(us.sent) != 1 || len(intl.sent) != 1 {
+		t.Fatalf("%v %v %v", cn.sent, us.sent, intl.sent)
+	}
+	if r.Provider != "cn" || len(r.Details) != 4 {
+		t.Fatalf("%+v", r)
+	}
+	providers := map[string]string{}
+	for _, d := range r.Details {
+		providers[d.Phone] = d.Provider
+	}
+	if providers["+447700900000"] != "intl" || providers["+14155550100"] != "us" {
+		t.Fatalf("%v", providers)
+	}
+
+	//fallback to intl
+	cn.fail = true
+	if r, err = s.SendSMS(testSendRequest("13012345678")); err != nil || r.Provider != "intl" {
+		t.Fatalf("%+v %v", r, err)
+	}
+
+	only, _ := NewMultiSMS(Route{SMS: cn, Prefixes: []string{"+86"}})
+	if _, err = only.SendSMS(testSendRequest("+14155550100")); err == nil {
+		t.Fatal("need no provider error")
+	}
+	if _, err = NewMultiSMS(Route{SMS: cn}, Route{SMS: cn}); err == nil {
+		t.Fatal("need duplicate name error")
+	}
+}
+
+func TestMultiSMSWeight(t *testing.T) {
+	a, b := &fakeSMS{name: "a"}, &fakeSMS{name: "b"}
+	s, err := NewMultiSMS(Route{SMS: a, Weight: 3}, Route{SMS: b, Weight: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4000; i++ {
+		s.SendSMS(testSendRequest("13012345678"))
+	}
+	if ratio := float64(len(a.sent)) / float64(len(b.sent)); ratio < 2.5 || ratio > 3.5 {
+		t.Fatalf("weight not respected: %d %d", len(a.sent), len(b.sent))
+	}
+}
+
+func TestMultiSMSRequestError(t *testing.T) {
+	a, b := &fakeSMS{name: "a", err: ErrorSMSNoSign}, &fakeSMS{name: "b"}
+	s, err := NewMultiSMS(Route{SMS: a, Priority: 1}, Route{SMS: b, Priority: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.FailureThreshold = 1
+	for i := 0; i < 3; i++ {
+		if r, err := s.SendSMS(testSendRequest("13012345678")); err != ErrorSMSNoSign || r.Provider != "a" {
+			t.Fatalf("request error should not fail over: %+v %v", r, err)
+		}
+	}
+	if len(b.sent) != 0 {
+		t.Fatal("sent by b", b.sent)
+	}
+	a.err = nil
+	if r, err := s.SendSMS(testSendRequest("13012345678")); err != nil || r.Provider != "a" {
+		t.Fatalf("circuit opened by request errors: %+v %v", r, err)
+	}
+}
+
+func TestIsProviderError(t *testing.T) {
+	cases := []struct {
+		r    Result
+		err  error
+		want bool
+	}{
+		{Result{}, nil, false},
+		{Result{}, ErrorSMSNoSign, false},
+		{Result{}, ErrorSMSNoTemplate, false},
+		{Result{ErrCode: "isv.MOBILE_NUMBER_ILLEGAL"}, errors.New("invalid phone"), false},
+		{Result{}, &HTTPError{StatusCode: 400}, false},
+		{Result{}, &HTTPError{StatusCode: 502}, true},
+		{Result{}, &HTTPError{StatusCode: 429}, true},
+		{Result{}, &url.Error{Op: "Post", URL: "http://x", Err: io.EOF}, true},
+		{Result{}, &net.OpError{Op: "dial", Err: errors.New("connection refused")}, true},
+		{Result{ErrCode: "Throttling.User"}, errors.New("throttled"), true},
+		{Result{ErrCode: "104"}, errors.New("system busy(104)"), true},
+		{Result{ErrCode: ErrCodeTransport}, errors.New("EOF"), true},
+	}
+	for i, c := range cases {
+		if got := IsProviderError(c.r, c.err); got != c.want {
+			t.Errorf("%d: %v %v", i, c.err, got)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package sms
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NormalizeE164 formats phone as E.164 (+8613012345678). Spaces, dashes,
+// dots and brackets are removed, "00" prefix is taken as "+". A phone without
+// international prefix gets countryCode ("86", "1"...), leading trunk "0" of
+// national number is removed.
+func NormalizeE164(phone, countryCode string) (e164 string, err error) {
+	var b strings.Builder
+	for i, c := range strings.TrimSpace(phone) {
+		switch {
+		case c >= '0' && c <= '9':
+			b.WriteRune(c)
+		case c == '+' && i == 0:
+			b.WriteRune(c)
+		case c == ' ' || c == '-' || c == '.' || c == '(' || c == ')':
+		default:
+			err = fmt.Errorf("invalid phone number %s", phone)
+			return
+		}
+	}
+	n := b.String()
+	switch {
+	case strings.HasPrefix(n, "+"):
+		n = n[1:]
+	case strings.HasPrefix(n, "00"):
+		n = n[2:]
+	default:
+		countryCode = strings.TrimPrefix(countryCode, "+")
+		if countryCode == "" {
+			err = fmt.Errorf("phone number %s lost country code", phone)
+			return
+		}
+		n = countryCode + strings.TrimLeft(n, "0")
+	}
+	if len(n) < 8 || len(n) > 15 || n[0] == '0' {
+		err = fmt.Errorf("invalid phone number %s", phone)
+		return
+	}
+	e164 = "+" + n
+	return
+}
@@ -0,0 +1,31 @@
+package sms
+
+import "testing"
+
+func TestNormalizeE164(t *testing.T) {
+	for _, c := range []struct {
+		phone, cc, e164 string
+	}{
+		{"13012345678", "86", "+8613012345678"},
+		{"+86 130-1234-5678", "", "+8613012345678"},
+		{"0086 13012345678", "1", "+8613012345678"},
+		{"(415) 555-0100", "+1", "+14155550100"},
+		{"020 7946 0018", "44", "+442079460018"},
+	} {
+		e164, err := NormalizeE164(c.phone, c.cc)
+		if err != nil || e164 != c.e164 {
+			t.Fatalf("%s: %s %v", c.phone, e164, err)
+		}
+	}
+	for _, c := range [][2]string{
+		{"13012345678", ""},
+		{"+86-130x12345678", ""},
+		{"+123", ""},
+		{"+1234567890123456", ""},
+		{"86+13012345678", "86"},
+	} {
+		if e164, err := NormalizeE164(c[0], c[1]); err == nil {
+			t.Fatalf("%s: need error, got %s", c[0], e164)
+		}
+	}
+}
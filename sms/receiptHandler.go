@@ -0,0 +1,123 @@
+package sms
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const maxReportSize = 1 << 20
+
+// ReportParser parses the body of delivery reports pushed by provider
+type ReportParser func(body []byte) ([]Receipt, error)
+
+// ReceiptHandler accepts delivery reports pushed by provider, each receipt is sent to Callback
+type ReceiptHandler struct {
+	Parse    ReportParser
+	Callback func(Receipt)
+	// Reply writes response to provider, nil: aliyun style {"code":0,"msg":"..."}
+	Reply func(w http.ResponseWriter, err error)
+}
+
+// NewAliyunReceiptHandler accepts aliyun SmsReport by http batch push
+func NewAliyunReceiptHandler(callback func(Receipt)) *ReceiptHandler {
+	return &ReceiptHandler{Parse: ParseAliyunReport, Callback: callback}
+}
+
+func (h *ReceiptHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxReportSize))
+	var receipts []Receipt
+	if err == nil {
+		receipts, err = h.Parse(body)
+	}
+	if err == nil && h.Callback != nil {
+		for _, rc := range receipts {
+			h.Callback(rc)
+		}
+	}
+	if h.Reply != nil {
+		h.Reply(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"code": 1, "msg": err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"code": 0, "msg": "success"})
+}
+
+type aliyunReport struct {
+	PhoneNumber string `json:"phone_number"`
+	SendTime    string `json:"send_time"`
+	ReportTime  string `json:"report_time"`
+	Success     bool   `json:"success"`
+	ErrCode     string `json:"err_code"`
+	ErrMsg      string `json:"err_msg"`
+	BizId       string `json:"biz_id"`
+	OutId       string `json:"out_id"`
+}
+
+// ParseAliyunReport parses SmsReport of http batch push (array), or a message of MNS queue (object),
+// dates are in china timezone
+func ParseAliyunReport(body []byte) ([]Receipt, error) {
+	return parseAliyunReport(body, chinaTimezone)
+}
+
+// AliyunReportParser is ParseAliyunReport with custom timezone
+func AliyunReportParser(loc *time.Location) ReportParser {
+	return func(body []byte) ([]Receipt, error) {
+		return parseAliyunReport(body, loc)
+	}
+}
+
+func parseAliyunReport(body []byte, loc *time.Location) (receipts []Receipt, err error) {
+	var reports []aliyunReport
+	body = []byte(strings.TrimSpace(string(body)))
+	switch {
+	case len(body) == 0:
+		err = errors.New("empty report")
+		return
+	case body[0] == '[':
+		err = json.Unmarshal(body, &reports)
+	default:
+		var rp aliyunReport
+		err = json.Unmarshal(body, &rp)
+		reports = append(reports, rp)
+	}
+	if err != nil {
+		return
+	}
+	for _, rp := range reports {
+		if rp.BizId == "" {
+			err = errors.New("lost biz_id of report")
+			return nil, err
+		}
+		rc := Receipt{
+			Provider:  "aliyun",
+			ReceiptId: rp.BizId,
+			Phone:     rp.PhoneNumber,
+			ErrCode:   rp.ErrCode,
+			SendStat:  StatusDone,
+		}
+		if !rp.Success {
+			rc.SendStat, rc.ErrCategory = StatusFail, ClassifyError(rp.ErrCode)
+		}
+		if rc.SendDate, err = parseDate("2006-01-02 15:04:05", rp.SendTime, loc); err != nil {
+			return nil, err
+		}
+		if rc.ReceiveDate, err = parseDate("2006-01-02 15:04:05", rp.ReportTime, loc); err != nil {
+			return nil, err
+		}
+		receipts = append(receipts, rc)
+	}
+	return
+}
@@ -0,0 +1,57 @@
+package sms
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAliyunReceiptHandler(t *testing.T) {
+	var receipts []Receipt
+	h := NewAliyunReceiptHandler(func(r Receipt) { receipts = append(receipts, r) })
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	body := `[{"phone_number":"13012345678","send_time":"2020-01-02 10:00:00","report_time":"2020-01-02 10:00:05","success":true,"err_code":"DELIVERED","err_msg":"用户接收成功","sms_size":"1","biz_id":"b-1","out_id":""},
+{"phone_number":"13112345678","send_time":"2020-01-02 10:00:00","report_time":"2020-01-02 10:00:07","success":false,"err_code":"MK:0001","err_msg":"","sms_size":"1","biz_id":"b-1","out_id":""}]`
+	resp, err := http.Post(srv.URL, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || len(receipts) != 2 {
+		t.Fatal(resp.StatusCode, receipts)
+	}
+	if r := receipts[0]; r.Provider != "aliyun" || r.ReceiptId != "b-1" || r.Phone != "13012345678" ||
+		r.SendStat != "DONE" || r.ErrCode != "DELIVERED" || r.ReceiveDate.Sub(r.SendDate).Seconds() != 5 {
+		t.Fatalf("%+v", r)
+	}
+	if r := receipts[1]; r.SendStat != "FAIL" || r.ErrCode != "MK:0001" {
+		t.Fatalf("%+v", r)
+	}
+
+	resp, err = http.Post(srv.URL, "application/json", strings.NewReader(`[{"phone_number":"1"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest || len(receipts) != 2 {
+		t.Fatal("need bad request", resp.StatusCode)
+	}
+}
+
+func TestParseAliyunReportMNS(t *testing.T) {
+	rs, err := ParseAliyunReport([]byte(`{"phone_number":"13012345678","send_time":"2020-01-02 10:00:00","report_time":"2020-01-02 10:00:05","success":true,"err_code":"DELIVERED","biz_id":"b-2"}`))
+	if err != nil || len(rs) != 1 || rs[0].ReceiptId != "b-2" || rs[0].SendDate.Unix() != 1577930400 {
+		t.Fatal(rs, err)
+	}
+
+	//pending report without report time, parsed in utc
+	rs, err = AliyunReportParser(time.UTC)([]byte(`[{"phone_number":"13012345678","send_time":"2020-01-02 10:00:00","report_time":"","success":false,"err_code":"MN:0001","biz_id":"b-3"}]`))
+	if err != nil || len(rs) != 1 || !rs[0].ReceiveDate.IsZero() || rs[0].SendDate.Unix() != 1577959200 ||
+		rs[0].SendStat != StatusFail || rs[0].ErrCategory != ErrCategoryInvalidNumber {
+		t.Fatal(rs, err)
+	}
+}
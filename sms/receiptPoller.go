@@ -0,0 +1,157 @@
+package sms
+
+import (
+	"sync"
+	"time"
+)
+
+// ReceiptPoller tracks sends and queries their receipts until resolved
+type ReceiptPoller struct {
+	SMS      SMS
+	Interval time.Duration //default 30 seconds
+	MaxAge   time.Duration //stops tracking after, default 72 hours
+	Callback func(Receipt)
+	// Expired is called when a send is not resolved in MaxAge, could be nil
+	Expired func(DetailQuery)
+
+	mu      sync.Mutex
+	pending map[string]*pendingQuery
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+type pendingQuery struct {
+	DetailQuery
+	since time.Time
+}
+
+func NewReceiptPoller(sms SMS, callback func(Receipt)) *ReceiptPoller {
+	return &ReceiptPoller{
+		SMS:      sms,
+		Interval: 30 * time.Second,
+		MaxAge:   72 * time.Hour,
+		Callback: callback,
+		pending:  make(map[string]*pendingQuery),
+	}
+}
+
+// Track adds a send to poll
+func (p *ReceiptPoller) Track(q DetailQuery) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pending[q.Provider+":"+q.ReceiptId+":"+q.Phone] = &pendingQuery{DetailQuery: q, since: time.Now()}
+}
+
+// TrackResult adds all succeeded phones of a send
+func (p *ReceiptPoller) TrackResult(req SendRequest, r Result, sendDate time.Time) {
+	if len(r.Details) == 0 {
+		for _, phone := range req.Phones {
+			p.Track(DetailQuery{Phone: phone, ReceiptId: r.ReceiptId, SendDate: sendDate, Provider: r.Provider})
+		}
+		return
+	}
+	for _, d := range r.Details {
+		if d.ErrCode != "" || d.ReceiptId == "" {
+			continue
+		}
+		provider := d.Provider
+		if provider == "" {
+			provider = r.Provider
+		}
+		p.Track(DetailQuery{Phone: d.Phone, ReceiptId: d.ReceiptId, SendDate: sendDate, Provider: provider})
+	}
+}
+
+// Pending returns count of unresolved sends
+func (p *ReceiptPoller) Pending() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.pending)
+}
+
+// Poll queries all pending sends once
+func (p *ReceiptPoller) Poll() {
+	p.mu.Lock()
+	queries := make(map[string]*pendingQuery, len(p.pending))
+	for k, q := range p.pending {
+		queries[k] = q
+	}
+	p.mu.Unlock()
+
+	maxAge := p.MaxAge
+	if maxAge <= 0 {
+		maxAge = 72 * time.Hour
+	}
+	for k, q := range queries {
+		rc, err := p.SMS.GetDetail(q.DetailQuery)
+		if err == nil && rc.SendStat != StatusWait {
+			p.remove(k)
+			if rc.ReceiptId == "" {
+				rc.ReceiptId = q.ReceiptId
+			}
+			if rc.Phone == "" {
+				rc.Phone = q.Phone
+			}
+			if rc.Provider == "" {
+				rc.Provider = q.Provider
+			}
+			if p.Callback != nil {
+				p.Callback(rc)
+			}
+			continue
+		}
+		//pending or failed to query, try again later
+		if time.Since(q.since) > maxAge {
+			p.remove(k)
+			if p.Expired != nil {
+				p.Expired(q.DetailQuery)
+			}
+		}
+	}
+}
+
+func (p *ReceiptPoller) remove(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.pending, key)
+}
+
+// Start polls in background until Stop
+func (p *ReceiptPoller) Start() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stop != nil {
+		return
+	}
+	interval := p.Interval
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	p.stop, p.done = make(chan struct{}), make(chan struct{})
+	go func(stop, done chan struct{}) {
+		defer close(done)
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-t.C:
+				p.Poll()
+			}
+		}
+	}(p.stop, p.done)
+}
+
+// Stop waits for the running poll to finish
+func (p *ReceiptPoller) Stop() {
+	p.mu.Lock()
+	stop, done := p.stop, p.done
+	p.stop, p.done = nil, nil
+	p.mu.Unlock()
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+}
@@ -0,0 +1,99 @@
+package sms
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// pollSMS answers WAIT for the first waits queries
+type pollSMS struct {
+	fakeSMS
+	mu    sync.Mutex
+	waits int
+}
+
+func (s *pollSMS) GetDetail(q DetailQuery) (r Receipt, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.query = append(s.query, q.ReceiptId)
+	switch {
+	case q.ReceiptId == "lost":
+		err = ErrorSMSNoReceipt
+	case s.waits > 0:
+		s.waits--
+		r.SendStat = "WAIT"
+	default:
+		r.SendStat = "DONE"
+	}
+	return
+}
+
+func TestReceiptPoller(t *testing.T) {
+	s := &pollSMS{fakeSMS: fakeSMS{name: "fake"}, waits: 1}
+	var (
+		mu       sync.Mutex
+		receipts []Receipt
+		expired  []DetailQuery
+	)
+	p := NewReceiptPoller(s, func(r Receipt) {
+		mu.Lock()
+		defer mu.Unlock()
+		receipts = append(receipts, r)
+	})
+	p.Expired = func(q DetailQuery) { expired = append(expired, q) }
+
+	req := testSendRequest("13012345678", "13112345678")
+	p.TrackResult(req, Result{ReceiptId: "r-1", Provider: "fake"}, time.Now())
+	p.Track(DetailQuery{Phone: "13012345678", ReceiptId: "lost", SendDate: time.Now(), Provider: "fake"})
+	if p.Pending() != 3 {
+		t.Fatal("pending", p.Pending())
+	}
+
+	p.Poll()
+	if p.Pending() != 2 || len(receipts) != 1 {
+		t.Fatal("pending", p.Pending(), receipts)
+	}
+	if r := receipts[0]; r.ReceiptId != "r-1" || r.Provider != "fake" || r.SendStat != "DONE" {
+		t.Fatalf("%+v", r)
+	}
+
+	p.MaxAge = time.Nanosecond
+	p.Poll()
+	if p.Pending() != 0 || len(receipts) != 2 || len(expired) != 1 || expired[0].ReceiptId != "lost" {
+		t.Fatal("pending", p.Pending(), receipts, expired)
+	}
+}
+
+func TestReceiptPollerMulti(t *testing.T) {
+	p := NewReceiptPoller(&fakeSMS{name: "fake"}, nil)
+	p.TrackResult(testSendRequest("13012345678", "13112345678"), Result{
+		Provider: "fake",
+		Details: []PhoneResult{
+			{Phone: "13012345678", ReceiptId: "r-1"},
+			{Phone: "13112345678", ErrCode: "THROTTLED"},
+		},
+	}, time.Now())
+	if p.Pending() != 1 {
+		t.Fatal("pending", p.Pending())
+	}
+}
+
+func TestReceiptPollerStart(t *testing.T) {
+	s := &pollSMS{fakeSMS: fakeSMS{name: "fake"}}
+	done := make(chan Receipt, 1)
+	p := NewReceiptPoller(s, func(r Receipt) { done <- r })
+	p.Interval = 10 * time.Millisecond
+	p.Track(DetailQuery{Phone: "13012345678", ReceiptId: "r-1", SendDate: time.Now(), Provider: "fake"})
+	p.Start()
+	defer p.Stop()
+	select {
+	case r := <-done:
+		if r.Phone != "13012345678" {
+			t.Fatalf("%+v", r)
+		}
+	case <-time.After(time.Second):
+		t.Fatal(errors.New("poller timeout"))
+	}
+}
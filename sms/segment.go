@@ -0,0 +1,61 @@
+package sms
+
+import "unicode/utf16"
+
+// Encoding of message on air
+type Encoding string
+
+const (
+	EncodingGSM7 Encoding = "GSM-7"
+	EncodingUCS2 Encoding = "UCS-2"
+)
+
+const (
+	gsm7Basic     = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+	gsm7Extension = "\f^{}\\[~]|€" //escaped, 2 septets
+)
+
+var gsm7Septets = func() map[rune]int {
+	m := make(map[rune]int)
+	for _, c := range gsm7Basic {
+		m[c] = 1
+	}
+	for _, c := range gsm7Extension {
+		m[c] = 2
+	}
+	return m
+}()
+
+// SegmentInfo is the length of message for cost estimation
+type SegmentInfo struct {
+	Encoding Encoding
+	Units    int //septets of GSM-7, or utf-16 code units of UCS-2
+	Segments int
+}
+
+// CountSegments counts segments of concatenated sms,
+// GSM-7: 160 septets for single, 153 for each part; UCS-2: 70 and 67
+func CountSegments(text string) (info SegmentInfo) {
+	info.Encoding = EncodingGSM7
+	for _, c := range text {
+		n, ok := gsm7Septets[c]
+		if !ok {
+			info.Encoding = EncodingUCS2
+			break
+		}
+		info.Units += n
+	}
+	single, multi := 160, 153
+	if info.Encoding == EncodingUCS2 {
+		info.Units = len(utf16.Encode([]rune(text)))
+		single, multi = 70, 67
+	}
+	switch {
+	case info.Units == 0:
+	case info.Units <= single:
+		info.Segments = 1
+	default:
+		info.Segments = (info.Units + multi - 1) / multi
+	}
+	return
+}
@@ -0,0 +1,31 @@
+package sms
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCountSegments(t *testing.T) {
+	for _, c := range []struct {
+		text     string
+		encoding Encoding
+		units    int
+		segments int
+	}{
+		{"", EncodingGSM7, 0, 0},
+		{"Your code is 1234", EncodingGSM7, 17, 1},
+		{"price: 5€ [ok]", EncodingGSM7, 17, 1},
+		{strings.Repeat("a", 160), EncodingGSM7, 160, 1},
+		{strings.Repeat("a", 161), EncodingGSM7, 161, 2},
+		{strings.Repeat("a", 307), EncodingGSM7, 307, 3},
+		{"【gutil】验证码1234", EncodingUCS2, 14, 1},
+		{strings.Repeat("码", 70), EncodingUCS2, 70, 1},
+		{strings.Repeat("码", 71), EncodingUCS2, 71, 2},
+		{"ok 😀", EncodingUCS2, 5, 1},
+	} {
+		info := CountSegments(c.text)
+		if info.Encoding != c.encoding || info.Units != c.units || info.Segments != c.segments {
+			t.Errorf("%q: %+v", c.text, info)
+		}
+	}
+}
@@ -8,43 +8,132 @@ import (
 )
 
 type SMS interface {
-	InitSMS(map[string]interface{}) (SMS, error)
-	SendSMS(map[string]interface{}) (Result, error)
-	GetDetail(map[string]interface{}) (Receipt, error)
+	InitSMS(Config) (SMS, error)
+	SendSMS(SendRequest) (Result, error)
+	GetDetail(DetailQuery) (Receipt, error)
 	SupportBy() string
 	//others
 }
 
 var (
 	ErrorSMSNoReceipt = errors.New("no receipt found")
+	ErrorSMSNoSign    = errors.New("lost sign name")
 )
 
+// ErrCodeTransport is PhoneResult.ErrCode of a phone failed by network, the error is in PhoneResult.Message
+const ErrCodeTransport = "TRANSPORT"
+
+// Config of provider, fields are used by providers as needed
+type Config struct {
+	RegionId     string //aliyun: cn-hangzhou
+	AccessKeyId  string
+	AccessSecret string
+	AppId        string            //tencent: SmsSdkAppId
+	Endpoint     string            //api address, "": provider default
+	Timeout      time.Duration     //http timeout
+	Location     *time.Location    //timezone of provider dates, nil: provider default
+	Templates    *TemplateRegistry //nil: DefaultTemplates
+
+	Options map[string]string //provider specific options
+}
+
+// SendRequest sends the same template to one or more phones
+type SendRequest struct {
+	Phones        []string
+	SignName      string //required by chinese providers
+	TemplateCode  string //template id, or content for providers without template
+	Template      string //logical name in TemplateRegistry, overrides TemplateCode
+	TemplateParam map[string]string
+}
+
+// Validate checks phones and template, SignName is checked by providers using it
+func (r *SendRequest) Validate() error {
+	if len(r.Phones) == 0 {
+		return errors.New("lost phone numbers")
+	}
+	for _, p := range r.Phones {
+		if strings.TrimSpace(p) == "" {
+			return errors.New("empty phone number")
+		}
+	}
+	if r.TemplateCode == "" && r.Template == "" {
+		return errors.New("lost template code")
+	}
+	return nil
+}
+
+// DetailQuery queries the receipt of one phone of a send
+type DetailQuery struct {
+	Phone     string
+	ReceiptId string //Result.ReceiptId
+	SendDate  time.Time
+	Provider  string //Result.Provider, used by MultiSMS
+}
+
+func (q *DetailQuery) Validate() error {
+	if q.Phone == "" {
+		return errors.New("lost phone number")
+	}
+	if q.ReceiptId == "" {
+		return errors.New("lost receipt id")
+	}
+	if q.SendDate.IsZero() {
+		return errors.New("lost send date")
+	}
+	return nil
+}
+
 type Result struct {
 	ReceiptId string
 	ErrCode   string
+	Provider  string //set by MultiSMS
+
+	Details []PhoneResult //for providers responding each phone
+}
+
+type PhoneResult struct {
+	Phone     string
+	ReceiptId string
+	ErrCode   string //"": success
+	Message   string
+	Provider  string //set by MultiSMS
 }
 
 // Detail result of query detail
 type Receipt struct {
-	ErrCode string
-	// no error: DELIVERED
-	//errors: https://help.aliyun.com/document_detail/101347.html
+	Provider  string
+	ReceiptId string
+	Phone     string
+
+	Content string //could be empty if provider doesn't return
+
+	ErrCode     string        //raw code of provider, no error: DELIVERED
+	ErrCategory ErrorCategory //normalised by ClassifyError
 
 	SendDate    time.Time
-	ReceiveDate time.Time
+	ReceiveDate time.Time //zero while WAIT
 
-	SendStat string
-	//WAIT：等待回执。
-	//FAIL：发送失败。
-	//DONE：发送成功。
+	SendStat SendStatus
 }
 
-func Using(SMSType string, params map[string]interface{}) (sms SMS, err error) {
+func Using(SMSType string, cfg Config) (sms SMS, err error) {
 	switch strings.ToLower(SMSType) {
 	case "aliyun":
-		sms, err = (&AliyunSMS{}).InitSMS(params)
+		sms, err = (&AliyunSMS{}).InitSMS(cfg)
+	case "tencent":
+		sms, err = (&TencentSMS{}).InitSMS(cfg)
+	case "253", "chuanglan":
+		sms, err = (&ChuanglanSMS{}).InitSMS(cfg)
+	case "submail":
+		sms, err = (&SubmailSMS{}).InitSMS(cfg)
+	case "twilio":
+		sms, err = (&TwilioSMS{}).InitSMS(cfg)
+	case "http", "generic":
+		sms, err = (&GenericHTTPSMS{}).InitSMS(cfg)
+	case "mock":
+		sms, err = (&MockSMS{}).InitSMS(cfg)
 	default:
-		err = fmt.Errorf("unsupported captcha type %s", SMSType)
+		err = fmt.Errorf("unsupported sms type %s", SMSType)
 	}
 	return
 }
@@ -0,0 +1,118 @@
+package sms
+
+import (
+	"strings"
+	"time"
+)
+
+// SendStatus of receipt
+type SendStatus string
+
+const (
+	StatusWait SendStatus = "WAIT" //等待回执
+	StatusFail SendStatus = "FAIL" //发送失败
+	StatusDone SendStatus = "DONE" //发送成功
+)
+
+// ErrorCategory is the normalised reason of failed send, "" for no error
+type ErrorCategory string
+
+const (
+	ErrCategoryNone          ErrorCategory = ""
+	ErrCategoryInvalidNumber ErrorCategory = "invalid_number" //wrong, empty or landline number
+	ErrCategoryUnreachable   ErrorCategory = "unreachable"    //power off, out of service, roaming
+	ErrCategoryBlocked       ErrorCategory = "blocked"        //blacklist, unsubscribed, filtered by carrier
+	ErrCategoryContent       ErrorCategory = "content"        //sign, template or sensitive words
+	ErrCategoryRateLimited   ErrorCategory = "rate_limited"   //too many sends to the phone
+	ErrCategoryBalance       ErrorCategory = "balance"        //balance or package of account is not enough
+	ErrCategoryExpired       ErrorCategory = "expired"        //not delivered in validity period
+	ErrCategoryUnknown       ErrorCategory = "unknown"
+)
+
+// chinaTimezone is default of chinese providers, no daylight saving time
+var chinaTimezone = time.FixedZone("CST", 8*3600)
+
+// errorCategories maps raw error codes of providers and carriers, the codes don't conflict between providers
+var errorCategories = map[string]ErrorCategory{
+	//carriers, cmpp/smgp status
+	"EXPIRED": ErrCategoryExpired,
+	"DELETED": ErrCategoryExpired,
+	"UNDELIV": ErrCategoryUnreachable,
+	"REJECTD": ErrCategoryBlocked,
+	"MN:0001": ErrCategoryInvalidNumber, //空号
+
+	//aliyun
+	"isv.MOBILE_NUMBER_ILLEGAL":   ErrCategoryInvalidNumber,
+	"isv.BLACK_KEY_CONTROL_LIMIT": ErrCategoryContent,
+	"isv.SMS_SIGNATURE_ILLEGAL":   ErrCategoryContent,
+	"isv.SMS_TEMPLATE_ILLEGAL":    ErrCategoryContent,
+	"isv.BUSINESS_LIMIT_CONTROL":  ErrCategoryRateLimited,
+	"isv.DAY_LIMIT_CONTROL":       ErrCategoryRateLimited,
+	"isv.AMOUNT_NOT_ENOUGH":       ErrCategoryBalance,
+	"isv.OUT_OF_SERVICE":          ErrCategoryBalance,
+
+	//tencent
+	"InvalidParameterValue.IncorrectPhoneNumber":         ErrCategoryInvalidNumber,
+	"FailedOperation.PhoneNumberInBlacklist":             ErrCategoryBlocked,
+	"FailedOperation.ContainSensitiveWord":               ErrCategoryContent,
+	"FailedOperation.SignatureIncorrectOrUnapproved":     ErrCategoryContent,
+	"FailedOperation.TemplateIncorrectOrUnapproved":      ErrCategoryContent,
+	"LimitExceeded.PhoneNumberDailyLimit":                ErrCategoryRateLimited,
+	"LimitExceeded.PhoneNumberOneHourLimit":              ErrCategoryRateLimited,
+	"LimitExceeded.PhoneNumberThirtySecondLimit":         ErrCategoryRateLimited,
+	"FailedOperation.InsufficientBalanceInSmsPackage":    ErrCategoryBalance,
+	"InvalidParameterValue.TemplateParameterFormatError": ErrCategoryContent,
+	"InvalidParameterValue.TemplateParameterLengthLimit": ErrCategoryContent,
+
+	//twilio
+	"21211": ErrCategoryInvalidNumber,
+	"21614": ErrCategoryInvalidNumber,
+	"30005": ErrCategoryInvalidNumber,
+	"30006": ErrCategoryInvalidNumber,
+	"30003": ErrCategoryUnreachable,
+	"30004": ErrCategoryBlocked,
+	"30007": ErrCategoryBlocked,
+	"21610": ErrCategoryBlocked,
+	"30001": ErrCategoryRateLimited,
+	"30008": ErrCategoryUnknown,
+}
+
+// ClassifyError returns category of raw error code
+func ClassifyError(code string) ErrorCategory {
+	switch code {
+	case "", "OK", "DELIVERED", "DELIVRD":
+		return ErrCategoryNone
+	}
+	if c, ok := errorCategories[code]; ok {
+		return c
+	}
+	lower := strings.ToLower(code)
+	switch {
+	case strings.Contains(code, "空号") || strings.Contains(lower, "invalid number"):
+		return ErrCategoryInvalidNumber
+	case strings.Contains(code, "黑名单") || strings.Contains(lower, "blacklist"):
+		return ErrCategoryBlocked
+	case strings.Contains(code, "关机") || strings.Contains(code, "停机"):
+		return ErrCategoryUnreachable
+	}
+	return ErrCategoryUnknown
+}
+
+// parseDate returns zero time for empty value, receipts in WAIT have no receive date
+func parseDate(layout, value string, loc *time.Location) (t time.Time, err error) {
+	if value = strings.TrimSpace(value); value == "" {
+		return
+	}
+	if loc == nil {
+		loc = time.Local
+	}
+	return time.ParseInLocation(layout, value, loc)
+}
+
+// location returns cfg.Location, or def if not set
+func (c Config) location(def *time.Location) *time.Location {
+	if c.Location != nil {
+		return c.Location
+	}
+	return def
+}
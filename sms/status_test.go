@@ -0,0 +1,34 @@
+package sms
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClassifyError(t *testing.T) {
+	for code, c := range map[string]ErrorCategory{
+		"":                                       ErrCategoryNone,
+		"DELIVERED":                              ErrCategoryNone,
+		"isv.MOBILE_NUMBER_ILLEGAL":              ErrCategoryInvalidNumber,
+		"FailedOperation.PhoneNumberInBlacklist": ErrCategoryBlocked,
+		"30003":                                  ErrCategoryUnreachable,
+		"EXPIRED":                                ErrCategoryExpired,
+		"用户黑名单":                                  ErrCategoryBlocked,
+		"X:1234":                                 ErrCategoryUnknown,
+	} {
+		if got := ClassifyError(code); got != c {
+			t.Errorf("%s: %s != %s", code, got, c)
+		}
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	d, err := parseDate("2006-01-02 15:04:05", "", chinaTimezone)
+	if err != nil || !d.IsZero() {
+		t.Fatal(d, err)
+	}
+	d, err = parseDate("2006-01-02 15:04:05", "2020-01-02 08:00:00", chinaTimezone)
+	if err != nil || !d.Equal(time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Fatal(d, err)
+	}
+}
@@ -1 +1,234 @@
 package sms
+
+/**
+implement: submail, https://www.mysubmail.com/documents
+*/
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const submailEndpoint = "https://api.mysubmail.com"
+
+// SubmailSMS TemplateCode is the project id of template
+type SubmailSMS struct {
+	appId     string
+	appKey    string
+	signType  string //normal, md5, sha1
+	endpoint  string
+	cli       *http.Client
+	now       func() time.Time
+	templates *TemplateRegistry
+}
+
+// InitSMS AppId: appid, AccessSecret: appkey, Options["sign_type"]: normal, md5(default), sha1
+func (s *SubmailSMS) InitSMS(cfg Config) (instance SMS, err error) {
+	if cfg.AppId == "" || cfg.AccessSecret == "" {
+		err = errors.New("lost appid or appkey")
+		return
+	}
+	s.appId, s.appKey = cfg.AppId, cfg.AccessSecret
+	switch s.signType = cfg.Options["sign_type"]; s.signType {
+	case "":
+		s.signType = "md5"
+	case "normal", "md5", "sha1":
+	default:
+		err = fmt.Errorf("unsupported sign type %s", s.signType)
+		return
+	}
+	if s.endpoint = strings.TrimRight(cfg.Endpoint, "/"); s.endpoint == "" {
+		s.endpoint = submailEndpoint
+	}
+	s.cli = newHTTPClient(cfg.Timeout)
+	s.now = time.Now
+	s.templates = cfg.Templates
+	instance = s
+	return
+}
+
+type submailSendResponse struct {
+	Status string      `json:"status"`
+	SendId string      `json:"send_id"`
+	To     string      `json:"to"`
+	Code   json.Number `json:"code"`
+	Msg    string      `json:"msg"`
+}
+
+// SendSMS SignName is ignored, it is bound with project in submail
+func (s *SubmailSMS) SendSMS(req SendRequest) (r Result, err error) {
+	if req, err = resolveRequest(s.templates, req, s.SupportBy(), false); err != nil {
+		return
+	}
+	vars := req.TemplateParam
+	if vars == nil {
+		vars = map[string]string{}
+	}
+
+	if len(req.Phones) == 1 {
+		v, _ := json.Marshal(vars)
+		var resp submailSendResponse
+		if err = s.post("/message/xsend", url.Values{
+			"to":      {req.Phones[0]},
+			"project": {req.TemplateCode},
+			"vars":    {string(v)},
+		}, &resp); err != nil {
+			return
+		}
+		if resp.Status != "success" {
+			r.ErrCode = resp.Code.String()
+			err = fmt.Errorf("%s(%s)", resp.Msg, resp.Code)
+			return
+		}
+		r.ReceiptId = resp.SendId
+		return
+	}
+
+	multi := make([]map[string]interface{}, len(req.Phones))
+	for i, p := range req.Phones {
+		multi[i] = map[string]interface{}{"to": p, "vars": vars}
+	}
+	m, _ := json.Marshal(multi)
+	//responds an array, or an object if the request failed as a whole
+	var (
+		raw  json.RawMessage
+		resp []submailSendResponse
+	)
+	if err = s.post("/message/multixsend", url.Values{
+		"project": {req.TemplateCode},
+		"multi":   {string(m)},
+	}, &raw); err != nil {
+		return
+	}
+	if strings.HasPrefix(strings.TrimSpace(string(raw)), "{") {
+		var e submailSendResponse
+		if err = json.Unmarshal(raw, &e); err != nil {
+			return
+		}
+		r.ErrCode = e.Code.String()
+		err = fmt.Errorf("%s(%s)", e.Msg, e.Code)
+		return
+	}
+	if err = json.Unmarshal(raw, &resp); err != nil {
+		return
+	}
+	for _, st := range resp {
+		pr := PhoneResult{Phone: st.To, ReceiptId: st.SendId}
+		if st.Status != "success" {
+			pr.ErrCode, pr.Message = st.Code.String(), st.Msg
+		}
+		r.Details = append(r.Details, pr)
+		if pr.ErrCode == "" && r.ReceiptId == "" {
+			r.ReceiptId = pr.ReceiptId
+		}
+	}
+	if len(r.Details) == 0 {
+		err = errors.New("empty send status")
+	} else if r.ReceiptId == "" {
+		r.ErrCode = r.Details[0].ErrCode
+		err = fmt.Errorf("%s(%s)", r.Details[0].Message, r.ErrCode)
+	}
+	return
+}
+
+func (s *SubmailSMS) GetDetail(q DetailQuery) (r Receipt, err error) {
+	if err = q.Validate(); err != nil {
+		return
+	}
+	var resp struct {
+		Status string      `json:"status"`
+		Code   json.Number `json:"code"`
+		Msg    string      `json:"msg"`
+		Data   []struct {
+			SendId      string `json:"sendID"`
+			To          string `json:"to"`
+			SendAt      int64  `json:"send_at"`
+			ReportAt    int64  `json:"report_at"`
+			ReportState string `json:"report_state"` //delivered, dropped, pending
+			ReportDesc  string `json:"report_desc"`
+			Content     string `json:"content"`
+		} `json:"data"`
+	}
+	if err = s.post("/log/message", url.Values{
+		"to":         {q.Phone},
+		"send_id":    {q.ReceiptId},
+		"start_date": {strconv.FormatInt(q.SendDate.Unix(), 10)},
+	}, &resp); err != nil {
+		return
+	}
+	if resp.Status != "success" {
+		err = fmt.Errorf("%s(%s)", resp.Msg, resp.Code)
+		return
+	}
+	for _, d := range resp.Data {
+		if d.SendId != q.ReceiptId {
+			continue
+		}
+		r.Provider, r.ReceiptId, r.Phone, r.Content = s.SupportBy(), d.SendId, d.To, d.Content
+		r.SendDate = time.Unix(d.SendAt, 0)
+		switch d.ReportState {
+		case "delivered":
+			r.ErrCode, r.SendStat = "DELIVERED", StatusDone
+		case "dropped":
+			r.ErrCode, r.SendStat = d.ReportDesc, StatusFail
+			r.ErrCategory = ClassifyError(r.ErrCode)
+		default:
+			r.SendStat = StatusWait
+			return
+		}
+		r.ReceiveDate = time.Unix(d.ReportAt, 0)
+		return
+	}
+	err = ErrorSMSNoReceipt
+	return
+}
+
+func (s *SubmailSMS) SupportBy() string {
+	return "submail"
+}
+
+func (s *SubmailSMS) post(path string, params url.Values, out interface{}) error {
+	params.Set("appid", s.appId)
+	params.Set("timestamp", strconv.FormatInt(s.now().Unix(), 10))
+	params.Set("sign_type", s.signType)
+	params.Set("signature", submailSignature(params, s.appId, s.appKey, s.signType))
+	return doHTTP(s.cli, http.MethodPost, s.endpoint+path, "application/x-www-form-urlencoded",
+		[]byte(params.Encode()), nil, out)
+}
+
+// submailSignature signs params sorted by key, excluding vars, multi, tag and signature
+func submailSignature(params url.Values, appId, appKey, signType string) string {
+	if signType == "normal" {
+		return appKey
+	}
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		switch k {
+		case "vars", "multi", "tag", "signature":
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + params.Get(k)
+	}
+	src := appId + appKey + strings.Join(pairs, "&") + appId + appKey
+	if signType == "sha1" {
+		h := sha1.Sum([]byte(src))
+		return hex.EncodeToString(h[:])
+	}
+	h := md5.Sum([]byte(src))
+	return hex.EncodeToString(h[:])
+}
@@ -0,0 +1,116 @@
+package sms
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestSubmailSignature(t *testing.T) {
+	params := url.Values{
+		"appid":     {"10001"},
+		"to":        {"13012345678"},
+		"project":   {"abc"},
+		"timestamp": {"1414253462"},
+		"sign_type": {"md5"},
+		"vars":      {`{"code":"1234"}`},
+	}
+	//md5("10001key" + "appid=10001&project=abc&sign_type=md5&timestamp=1414253462&to=13012345678" + "10001key")
+	if s := submailSignature(params, "10001", "key", "md5"); s != "3106dc65b246faefcf389ff19ab7c968" {
+		t.Fatal(s)
+	}
+	if s := submailSignature(params, "10001", "key", "normal"); s != "key" {
+		t.Fatal(s)
+	}
+}
+
+func fakeSubmail(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		p := r.PostForm
+		if p.Get("signature") != submailSignature(p, "10001", "key", p.Get("sign_type")) {
+			w.Write([]byte(`{"status":"error","code":"106","msg":"Incorrect signature"}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/message/xsend":
+			var vars map[string]string
+			json.Unmarshal([]byte(p.Get("vars")), &vars)
+			if p.Get("project") != "abc" || vars["code"] != "1234" {
+				t.Errorf("params error: %v", p)
+			}
+			w.Write([]byte(`{"status":"success","send_id":"093c0a7df143c087d6cba9cdf0cf3738","fee":1,"sms_credits":14197}`))
+		case "/message/multixsend":
+			var multi []map[string]interface{}
+			json.Unmarshal([]byte(p.Get("multi")), &multi)
+			if len(multi) != 2 {
+				t.Errorf("params error: %v", p)
+			}
+			w.Write([]byte(`[{"status":"success","to":"13012345678","send_id":"s1","fee":1},
+				{"status":"error","to":"13112345678","code":252,"msg":"Mobile number is incorrect"}]`))
+		case "/log/message":
+			if p.Get("send_id") != "s1" {
+				w.Write([]byte(`{"status":"success","data":[{"sendID":"` + p.Get("send_id") + `","report_state":"pending"}]}`))
+				return
+			}
+			w.Write([]byte(`{"status":"success","total":1,"data":[{"sendID":"s1","to":"13012345678",
+				"send_at":1479195839,"report_at":1479195840,"report_state":"delivered","report_desc":"DELIVRD"}]}`))
+		}
+	}))
+}
+
+func TestSubmailSMS(t *testing.T) {
+	srv := fakeSubmail(t)
+	defer srv.Close()
+
+	for _, signType := range []string{"md5", "sha1", "normal"} {
+		s, err := Using("submail", Config{AppId: "10001", AccessSecret: "key", Endpoint: srv.URL,
+			Options: map[string]string{"sign_type": signType}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := s.SendSMS(SendRequest{
+			Phones:        []string{"13012345678"},
+			SignName:      "gutil",
+			TemplateCode:  "abc",
+			TemplateParam: map[string]string{"code": "1234"},
+		})
+		if err != nil || r.ReceiptId != "093c0a7df143c087d6cba9cdf0cf3738" {
+			t.Fatalf("%s: %+v %v", signType, r, err)
+		}
+	}
+
+	s, _ := Using("submail", Config{AppId: "10001", AccessSecret: "key", Endpoint: srv.URL})
+	r, err := s.SendSMS(SendRequest{
+		Phones:       []string{"13012345678", "13112345678"},
+		SignName:     "gutil",
+		TemplateCode: "abc",
+	})
+	if err != nil || r.ReceiptId != "s1" || len(r.Details) != 2 || r.Details[1].ErrCode != "252" {
+		t.Fatalf("%+v %v", r, err)
+	}
+
+	rc, err := s.GetDetail(DetailQuery{Phone: "13012345678", ReceiptId: "s1", SendDate: time.Unix(1479195800, 0)})
+	if err != nil || rc.SendStat != "DONE" || rc.ReceiveDate.Unix() != 1479195840 {
+		t.Fatalf("%+v %v", rc, err)
+	}
+	if rc, err = s.GetDetail(DetailQuery{Phone: "13012345678", ReceiptId: "s2", SendDate: time.Now()}); err != nil || rc.SendStat != "WAIT" {
+		t.Fatalf("%+v %v", rc, err)
+	}
+
+	s, _ = Using("submail", Config{AppId: "10001", AccessSecret: "wrong", Endpoint: srv.URL})
+	if r, err = s.SendSMS(SendRequest{Phones: []string{"13012345678"}, SignName: "gutil", TemplateCode: "abc"}); err == nil || r.ErrCode != "106" {
+		t.Fatalf("need signature error: %+v %v", r, err)
+	}
+	if r, err = s.SendSMS(SendRequest{Phones: []string{"1", "2"}, SignName: "gutil", TemplateCode: "abc"}); err == nil || r.ErrCode != "106" {
+		t.Fatalf("need signature error: %+v %v", r, err)
+	}
+	if _, err = Using("submail", Config{AppId: "10001", AccessSecret: "key", Options: map[string]string{"sign_type": "rsa"}}); err == nil {
+		t.Fatal("need sign type error")
+	}
+}
@@ -0,0 +1,167 @@
+package sms
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+)
+
+var ErrorSMSNoTemplate = errors.New("template is not registered")
+
+// DefaultTemplates is used by providers without Config.Templates
+var DefaultTemplates = NewTemplateRegistry()
+
+var templateVar = regexp.MustCompile(`\{(\w+)\}`)
+
+// Template maps a logical name to template ids of providers
+type Template struct {
+	Name string
+	// Text is the local content with "{name}" variables, sent as content by providers without code,
+	// e.g. 253, twilio, http
+	Text string
+	// Codes template id by provider name(SupportBy), e.g. {"aliyun": "SMS_001", "tencent": "1001"}
+	Codes map[string]string
+	// Vars are required variables besides ones in Text
+	Vars []string
+}
+
+// required returns all required variables
+func (t *Template) required() []string {
+	vars := append([]string(nil), t.Vars...)
+	for _, m := range templateVar.FindAllStringSubmatch(t.Text, -1) {
+		vars = append(vars, m[1])
+	}
+	return vars
+}
+
+// check returns error if a required variable is lost or empty
+func (t *Template) check(params map[string]string) error {
+	for _, v := range t.required() {
+		if params[v] == "" {
+			return fmt.Errorf("lost param %s of template %s", v, t.Name)
+		}
+	}
+	return nil
+}
+
+// TemplateRegistry is safe for concurrent use
+type TemplateRegistry struct {
+	mu        sync.RWMutex
+	templates map[string]Template
+}
+
+func NewTemplateRegistry() *TemplateRegistry {
+	return &TemplateRegistry{templates: make(map[string]Template)}
+}
+
+// Register adds or replaces template
+func (r *TemplateRegistry) Register(t Template) error {
+	if t.Name == "" {
+		return errors.New("lost template name")
+	}
+	if t.Text == "" && len(t.Codes) == 0 {
+		return fmt.Errorf("template %s needs text or codes", t.Name)
+	}
+	codes := make(map[string]string, len(t.Codes))
+	for k, v := range t.Codes {
+		codes[k] = v
+	}
+	t.Codes, t.Vars = codes, append([]string(nil), t.Vars...)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.templates[t.Name] = t
+	return nil
+}
+
+func (r *TemplateRegistry) Get(name string) (t Template, ok bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, ok = r.templates[name]
+	return
+}
+
+func (r *TemplateRegistry) get(name string) (t Template, err error) {
+	var ok bool
+	if t, ok = r.Get(name); !ok {
+		err = fmt.Errorf("%w: %s", ErrorSMSNoTemplate, name)
+	}
+	return
+}
+
+// Render checks params and returns the local text
+func (r *TemplateRegistry) Render(name string, params map[string]string) (text string, err error) {
+	t, err := r.get(name)
+	if err != nil {
+		return
+	}
+	if t.Text == "" {
+		err = fmt.Errorf("template %s has no text", name)
+		return
+	}
+	if err = t.check(params); err != nil {
+		return
+	}
+	text = renderTemplate(t.Text, params)
+	return
+}
+
+// Preview is the final text received by phone
+type Preview struct {
+	Text string
+	SegmentInfo
+}
+
+// Preview renders template with sign name of chinese providers("【sign】text"), signName could be empty
+func (r *TemplateRegistry) Preview(name, signName string, params map[string]string) (p Preview, err error) {
+	if p.Text, err = r.Render(name, params); err != nil {
+		return
+	}
+	if signName != "" {
+		p.Text = "【" + signName + "】" + p.Text
+	}
+	p.SegmentInfo = CountSegments(p.Text)
+	return
+}
+
+// contentProviders send the text, others(aliyun, tencent, submail) need template id of server
+var contentProviders = map[string]bool{"253": true, "twilio": true, "http": true, "mock": true}
+
+// Resolve validates req and sets TemplateCode by req.Template for provider, req without Template is kept.
+// Text of template is used if Codes has no provider, only for providers sending the text
+func (r *TemplateRegistry) Resolve(req SendRequest, provider string) (SendRequest, error) {
+	return r.resolve(req, provider, contentProviders[provider])
+}
+
+func (r *TemplateRegistry) resolve(req SendRequest, provider string, content bool) (SendRequest, error) {
+	if err := req.Validate(); err != nil {
+		return req, err
+	}
+	if req.Template == "" {
+		return req, nil
+	}
+	t, err := r.get(req.Template)
+	if err != nil {
+		return req, err
+	}
+	if err = t.check(req.TemplateParam); err != nil {
+		return req, err
+	}
+	if req.TemplateCode = t.Codes[provider]; req.TemplateCode == "" && content {
+		req.TemplateCode = t.Text
+	}
+	if req.TemplateCode == "" {
+		return req, fmt.Errorf("template %s has no code for %s", t.Name, provider)
+	}
+	return req, nil
+}
+
+// resolveRequest resolves req by templates, or DefaultTemplates if templates is nil.
+// content is true for providers sending the text
+func resolveRequest(templates *TemplateRegistry, req SendRequest, provider string, content bool) (SendRequest, error) {
+	if templates == nil {
+		templates = DefaultTemplates
+	}
+	return templates.resolve(req, provider, content)
+}
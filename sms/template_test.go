@@ -0,0 +1,111 @@
+package sms
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestTemplateRegistry(t *testing.T) {
+	r := NewTemplateRegistry()
+	if err := r.Register(Template{Name: "empty"}); err == nil {
+		t.Fatal("need text or codes error")
+	}
+	err := r.Register(Template{
+		Name:  "login",
+		Text:  "验证码{code}，{minutes}分钟内有效",
+		Codes: map[string]string{"aliyun": "SMS_001", "tencent": "1001"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Register(Template{Name: "coded", Codes: map[string]string{"aliyun": "SMS_002"}, Vars: []string{"name"}})
+
+	params := map[string]string{"code": "1234", "minutes": "5"}
+	text, err := r.Render("login", params)
+	if err != nil || text != "验证码1234，5分钟内有效" {
+		t.Fatal(text, err)
+	}
+	if _, err = r.Render("login", map[string]string{"code": "1234"}); err == nil || !strings.Contains(err.Error(), "minutes") {
+		t.Fatal("need lost param error", err)
+	}
+	if _, err = r.Render("coded", map[string]string{"name": "a"}); err == nil {
+		t.Fatal("need no text error")
+	}
+	if _, err = r.Render("lost", nil); !errors.Is(err, ErrorSMSNoTemplate) {
+		t.Fatal("need no template error", err)
+	}
+
+	p, err := r.Preview("login", "gutil", params)
+	if err != nil || p.Text != "【gutil】验证码1234，5分钟内有效" || p.Encoding != EncodingUCS2 || p.Units != 21 || p.Segments != 1 {
+		t.Fatalf("%+v %v", p, err)
+	}
+
+	req := SendRequest{Phones: []string{"13012345678"}, Template: "login", TemplateParam: params}
+	for provider, code := range map[string]string{"aliyun": "SMS_001", "tencent": "1001", "twilio": "验证码{code}，{minutes}分钟内有效"} {
+		got, err := r.Resolve(req, provider)
+		if err != nil || got.TemplateCode != code {
+			t.Fatal(provider, got.TemplateCode, err)
+		}
+	}
+	req.Template = "coded"
+	if _, err = r.Resolve(req, "aliyun"); err == nil {
+		t.Fatal("need lost param error")
+	}
+	req.TemplateParam = map[string]string{"name": "a"}
+	if _, err = r.Resolve(req, "twilio"); err == nil {
+		t.Fatal("need no code error")
+	}
+	req.Template, req.TemplateCode = "", "SMS_009"
+	if got, err := r.Resolve(req, "aliyun"); err != nil || got.TemplateCode != "SMS_009" {
+		t.Fatal(got.TemplateCode, err)
+	}
+}
+
+func TestTemplateWithProviders(t *testing.T) {
+	templates := NewTemplateRegistry()
+	templates.Register(Template{Name: "login", Text: "code {code}", Codes: map[string]string{"a": "T_A"}})
+	a, _ := Using("mock", Config{Templates: templates, Options: map[string]string{"name": "a"}})
+	b, _ := Using("mock", Config{Templates: templates, Options: map[string]string{"name": "b"}})
+	a.(*MockSMS).FailNext("503", &HTTPError{StatusCode: 503})
+	s, err := NewMultiSMS(Route{SMS: a, Priority: 1}, Route{SMS: b, Priority: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := SendRequest{Phones: []string{"13012345678"}, Template: "login", TemplateParam: map[string]string{"code": "1234"}}
+	if _, err = s.SendSMS(req); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.SendSMS(req); err != nil {
+		t.Fatal(err)
+	}
+	mb, _ := b.(*MockSMS).Last("13012345678")
+	ma, _ := a.(*MockSMS).Last("13012345678")
+	if mb.Content != "code 1234" || ma.Request.TemplateCode != "T_A" {
+		t.Fatalf("%+v %+v", ma, mb)
+	}
+}
+
+func TestTemplateResolveText(t *testing.T) {
+	r := NewTemplateRegistry()
+	r.Register(Template{Name: "notice", Text: "hello {name}"})
+	req := SendRequest{Phones: []string{"13012345678"}, Template: "notice", TemplateParam: map[string]string{"name": "a"}}
+	for _, provider := range []string{"253", "twilio", "http", "mock"} {
+		if got, err := r.Resolve(req, provider); err != nil || got.TemplateCode != "hello {name}" {
+			t.Fatal(provider, got.TemplateCode, err)
+		}
+	}
+	//text is not a template id of server
+	for _, provider := range []string{"aliyun", "tencent", "submail"} {
+		if got, err := r.Resolve(req, provider); err == nil {
+			t.Fatal("need no code error", provider, got.TemplateCode)
+		}
+	}
+	s, err := Using("aliyun", Config{RegionId: "cn-hangzhou", AccessKeyId: "id", AccessSecret: "secret", Templates: r})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.SendSMS(req); err == nil || !strings.Contains(err.Error(), "no code for aliyun") {
+		t.Fatal("need no code error", err)
+	}
+}
@@ -0,0 +1,295 @@
+package sms
+
+/**
+implement: tencent cloud sms api v3, https://cloud.tencent.com/document/product/382/55981
+*/
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	tencentEndpoint = "https://sms.tencentcloudapi.com"
+	tencentService  = "sms"
+	tencentVersion  = "2021-01-11"
+	tencentPageSize = 100
+)
+
+type TencentSMS struct {
+	secretId  string
+	secretKey string
+	appId     string
+	region    string
+	endpoint  string
+	//phones without country code
+	countryCode string
+	host        string
+	cli         *http.Client
+	now         func() time.Time
+	templates   *TemplateRegistry
+}
+
+// InitSMS AccessKeyId: SecretId, AccessSecret: SecretKey, AppId: SmsSdkAppId, RegionId: ap-guangzhou,
+// Options["country_code"]: default "86"
+func (s *TencentSMS) InitSMS(cfg Config) (instance SMS, err error) {
+	if cfg.AccessKeyId == "" || cfg.AccessSecret == "" {
+		err = errors.New("lost secret id or secret key")
+		return
+	}
+	if cfg.AppId == "" {
+		err = errors.New("lost sms sdk app id")
+		return
+	}
+	s.secretId, s.secretKey, s.appId, s.region = cfg.AccessKeyId, cfg.AccessSecret, cfg.AppId, cfg.RegionId
+	if s.region == "" {
+		s.region = "ap-guangzhou"
+	}
+	if s.countryCode = cfg.Options["country_code"]; s.countryCode == "" {
+		s.countryCode = "86"
+	}
+	if s.endpoint = cfg.Endpoint; s.endpoint == "" {
+		s.endpoint = tencentEndpoint
+	}
+	u, err := url.Parse(s.endpoint)
+	if err != nil {
+		return
+	}
+	if u.Host == "" {
+		err = fmt.Errorf("invalid endpoint %s", s.endpoint)
+		return
+	}
+	s.host = u.Host
+	s.cli = newHTTPClient(cfg.Timeout)
+	s.now = time.Now
+	s.templates = cfg.Templates
+	instance = s
+	return
+}
+
+type tencentError struct {
+	Code    string
+	Message string
+}
+
+type tencentSendResponse struct {
+	Response struct {
+		Error         *tencentError
+		RequestId     string
+		SendStatusSet []struct {
+			SerialNo    string
+			PhoneNumber string
+			Fee         int
+			Code        string
+			Message     string
+		}
+	}
+}
+
+// SendSMS TemplateParam keys are positions of template params: "1", "2", ...
+func (s *TencentSMS) SendSMS(req SendRequest) (r Result, err error) {
+	if req, err = resolveRequest(s.templates, req, s.SupportBy(), false); err != nil {
+		return
+	}
+	phones := make([]string, len(req.Phones))
+	for i, p := range req.Phones {
+		if phones[i], err = NormalizeE164(p, s.countryCode); err != nil {
+			return
+		}
+	}
+	var resp tencentSendResponse
+	if err = s.call("SendSms", map[string]interface{}{
+		"PhoneNumberSet":   phones,
+		"SmsSdkAppId":      s.appId,
+		"SignName":         req.SignName,
+		"TemplateId":       req.TemplateCode,
+		"TemplateParamSet": orderedParams(req.TemplateParam),
+	}, &resp); err != nil {
+		return
+	}
+	if e := resp.Response.Error; e != nil {
+		r.ErrCode = e.Code
+		err = errors.New(e.Message)
+		return
+	}
+
+	var failed *PhoneResult
+	for _, st := range resp.Response.SendStatusSet {
+		pr := PhoneResult{Phone: st.PhoneNumber, ReceiptId: st.SerialNo}
+		if st.Code != "Ok" {
+			pr.ErrCode, pr.Message = st.Code, st.Message
+		}
+		r.Details = append(r.Details, pr)
+		if pr.ErrCode == "" && r.ReceiptId == "" {
+			r.ReceiptId = pr.ReceiptId
+		}
+		if pr.ErrCode != "" && failed == nil {
+			failed = &r.Details[len(r.Details)-1]
+		}
+	}
+	if len(r.Details) == 0 {
+		err = errors.New("empty send status")
+		return
+	}
+	if r.ReceiptId == "" {
+		//all failed
+		r.ErrCode = failed.ErrCode
+		err = errors.New(failed.Message)
+	}
+	return
+}
+
+type tencentPullResponse struct {
+	Response struct {
+		Error                *tencentError
+		RequestId            string
+		PullSmsSendStatusSet []struct {
+			UserReceiveTime int64
+			PhoneNumber     string
+			SerialNo        string
+			ReportStatus    string
+			Description     string
+		}
+	}
+}
+
+// GetDetail pulls send status of the phone from SendDate, matching serial no
+func (s *TencentSMS) GetDetail(q DetailQuery) (r Receipt, err error) {
+	if err = q.Validate(); err != nil {
+		return
+	}
+	phone, err := NormalizeE164(q.Phone, s.countryCode)
+	if err != nil {
+		return
+	}
+	for offset := 0; ; offset += tencentPageSize {
+		var resp tencentPullResponse
+		if err = s.call("PullSmsSendStatusByPhoneNumber", map[string]interface{}{
+			"BeginTime":   q.SendDate.Unix(),
+			"Offset":      offset,
+			"Limit":       tencentPageSize,
+			"PhoneNumber": phone,
+			"SmsSdkAppId": s.appId,
+		}, &resp); err != nil {
+			return
+		}
+		if e := resp.Response.Error; e != nil {
+			err = fmt.Errorf("%s: %s", e.Code, e.Message)
+			return
+		}
+		for _, st := range resp.Response.PullSmsSendStatusSet {
+			if st.SerialNo != q.ReceiptId {
+				continue
+			}
+			r.Provider, r.ReceiptId, r.Phone = s.SupportBy(), st.SerialNo, st.PhoneNumber
+			r.SendDate = q.SendDate
+			r.ReceiveDate = time.Unix(st.UserReceiveTime, 0)
+			if st.ReportStatus == "SUCCESS" {
+				r.ErrCode, r.SendStat = "DELIVERED", StatusDone
+			} else {
+				r.ErrCode, r.SendStat = st.Description, StatusFail
+				r.ErrCategory = ClassifyError(r.ErrCode)
+			}
+			return
+		}
+		if len(resp.Response.PullSmsSendStatusSet) < tencentPageSize {
+			break
+		}
+	}
+	err = ErrorSMSNoReceipt
+	return
+}
+
+func (s *TencentSMS) SupportBy() string {
+	return "tencent"
+}
+
+// call signs the request by TC3-HMAC-SHA256 and posts it
+func (s *TencentSMS) call(action string, params map[string]interface{}, out interface{}) (err error) {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return
+	}
+	now := s.now()
+	header := http.Header{}
+	header.Set("Host", s.host)
+	header.Set("X-TC-Action", action)
+	header.Set("X-TC-Version", tencentVersion)
+	header.Set("X-TC-Timestamp", strconv.FormatInt(now.Unix(), 10))
+	header.Set("X-TC-Region", s.region)
+	header.Set("Authorization", tc3Authorization(s.secretId, s.secretKey, s.host, tencentService, body, now))
+	return doHTTP(s.cli, http.MethodPost, s.endpoint, tc3ContentType, body, header, out)
+}
+
+const tc3ContentType = "application/json; charset=utf-8"
+
+// tc3Authorization https://cloud.tencent.com/document/api/382/52072
+func tc3Authorization(secretId, secretKey, host, service string, payload []byte, t time.Time) string {
+	date := t.UTC().Format("2006-01-02")
+	canonicalRequest := strings.Join([]string{
+		http.MethodPost,
+		"/",
+		"",
+		"content-type:" + tc3ContentType + "\nhost:" + host + "\n",
+		"content-type;host",
+		sha256Hex(payload),
+	}, "\n")
+	scope := date + "/" + service + "/tc3_request"
+	stringToSign := strings.Join([]string{
+		"TC3-HMAC-SHA256",
+		strconv.FormatInt(t.Unix(), 10),
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+	secretDate := hmacSHA256([]byte("TC3"+secretKey), date)
+	secretService := hmacSHA256(secretDate, service)
+	secretSigning := hmacSHA256(secretService, "tc3_request")
+	signature := hex.EncodeToString(hmacSHA256(secretSigning, stringToSign))
+	return fmt.Sprintf("TC3-HMAC-SHA256 Credential=%s/%s, SignedHeaders=content-type;host, Signature=%s",
+		secretId, scope, signature)
+}
+
+func sha256Hex(d []byte) string {
+	h := sha256.Sum256(d)
+	return hex.EncodeToString(h[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// orderedParams sorts params by key, numeric keys by number
+func orderedParams(params map[string]string) []string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, errA := strconv.Atoi(keys[i])
+		b, errB := strconv.Atoi(keys[j])
+		if errA == nil && errB == nil {
+			return a < b
+		}
+		if (errA == nil) != (errB == nil) {
+			return errA == nil
+		}
+		return keys[i] < keys[j]
+	})
+	vs := make([]string, len(keys))
+	for i, k := range keys {
+		vs[i] = params[k]
+	}
+	return vs
+}
@@ -0,0 +1,155 @@
+package sms
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTC3Authorization(t *testing.T) {
+	//expected signature computed by an independent implementation
+	auth := tc3Authorization("AKIDz8krbsJ5yKBZQpn74WFkmLPx3EXAMPLE", "Gu5t9xGARNpq86cd98joQYCN3EXAMPLE",
+		"sms.tencentcloudapi.com", "sms", []byte(`{"Limit":1,"Offset":0}`), time.Unix(1551113065, 0))
+	expected := "TC3-HMAC-SHA256 Credential=AKIDz8krbsJ5yKBZQpn74WFkmLPx3EXAMPLE/2019-02-25/sms/tc3_request, " +
+		"SignedHeaders=content-type;host, Signature=ef044870005d2aa1ad7da03d3eae34ef1492b034457b1e5d260a60b4b5ed28b4"
+	if auth != expected {
+		t.Fatal(auth)
+	}
+}
+
+// fakeTencent checks headers and signature, then responds by action
+func fakeTencent(t *testing.T, handle func(action string, params map[string]interface{}) interface{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		ts := r.Header.Get("X-TC-Timestamp")
+		if r.Header.Get("X-TC-Version") != tencentVersion || ts == "" || r.Header.Get("X-TC-Region") != "ap-guangzhou" {
+			t.Errorf("header error: %v", r.Header)
+		}
+		if r.Header.Get("Content-Type") != tc3ContentType {
+			t.Errorf("content type error: %s", r.Header.Get("Content-Type"))
+		}
+		tsv, _ := strconv.ParseInt(ts, 10, 64)
+		if auth := tc3Authorization("SID", "SKEY", r.Host, "sms", body, time.Unix(tsv, 0)); auth != r.Header.Get("Authorization") {
+			w.Write([]byte(`{"Response":{"Error":{"Code":"AuthFailure.SignatureFailure","Message":"signature error"},"RequestId":"r0"}}`))
+			return
+		}
+		var params map[string]interface{}
+		if err := json.Unmarshal(body, &params); err != nil {
+			t.Error(err)
+		}
+		d, _ := json.Marshal(handle(r.Header.Get("X-TC-Action"), params))
+		w.Write(d)
+	}))
+}
+
+func newTestTencent(t *testing.T, endpoint, secret string) *TencentSMS {
+	s, err := Using("tencent", Config{
+		AccessKeyId:  "SID",
+		AccessSecret: secret,
+		AppId:        "1400006666",
+		Endpoint:     endpoint,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s.(*TencentSMS)
+}
+
+func TestTencentSendSMS(t *testing.T) {
+	srv := fakeTencent(t, func(action string, params map[string]interface{}) interface{} {
+		if action != "SendSms" {
+			t.Errorf("action error: %s", action)
+		}
+		tp := params["TemplateParamSet"].([]interface{})
+		if len(tp) != 3 || tp[0] != "a" || tp[1] != "b" || tp[2] != "c" || params["SmsSdkAppId"] != "1400006666" {
+			t.Errorf("params error: %v", params)
+		}
+		var set []map[string]interface{}
+		for _, p := range params["PhoneNumberSet"].([]interface{}) {
+			st := map[string]interface{}{"PhoneNumber": p, "SerialNo": "2019:" + p.(string), "Code": "Ok", "Message": "send success"}
+			if strings.HasSuffix(p.(string), "0") {
+				st["Code"], st["Message"], st["SerialNo"] = "LimitExceeded.PhoneNumberDailyLimit", "daily limit", ""
+			}
+			set = append(set, st)
+		}
+		return map[string]interface{}{"Response": map[string]interface{}{"SendStatusSet": set, "RequestId": "r1"}}
+	})
+	defer srv.Close()
+	s := newTestTencent(t, srv.URL, "SKEY")
+
+	req := SendRequest{
+		Phones:        []string{"13012345670", "+8613012345671"},
+		SignName:      "sign",
+		TemplateCode:  "1234",
+		TemplateParam: map[string]string{"10": "c", "2": "b", "1": "a"},
+	}
+	r, err := s.SendSMS(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.ReceiptId != "2019:+8613012345671" || len(r.Details) != 2 {
+		t.Fatalf("%+v", r)
+	}
+	if d := r.Details[0]; d.Phone != "+8613012345670" || d.ErrCode != "LimitExceeded.PhoneNumberDailyLimit" {
+		t.Fatalf("%+v", d)
+	}
+
+	//all failed
+	req.Phones = []string{"13012345670"}
+	if r, err = s.SendSMS(req); err == nil || r.ErrCode != "LimitExceeded.PhoneNumberDailyLimit" {
+		t.Fatalf("need error: %+v", r)
+	}
+
+	//wrong secret
+	s = newTestTencent(t, srv.URL, "WRONG")
+	if r, err = s.SendSMS(req); err == nil || r.ErrCode != "AuthFailure.SignatureFailure" {
+		t.Fatalf("need signature error: %+v", r)
+	}
+}
+
+func TestTencentGetDetail(t *testing.T) {
+	var offsets []float64
+	srv := fakeTencent(t, func(action string, params map[string]interface{}) interface{} {
+		if action != "PullSmsSendStatusByPhoneNumber" || params["PhoneNumber"] != "+8613012345678" {
+			t.Errorf("params error: %s %v", action, params)
+		}
+		offset := params["Offset"].(float64)
+		offsets = append(offsets, offset)
+		var set []map[string]interface{}
+		if offset == 0 {
+			for i := 0; i < tencentPageSize; i++ {
+				set = append(set, map[string]interface{}{"SerialNo": "other", "ReportStatus": "SUCCESS"})
+			}
+		} else {
+			set = append(set,
+				map[string]interface{}{"SerialNo": "sn-ok", "ReportStatus": "SUCCESS", "UserReceiveTime": 1576137600},
+				map[string]interface{}{"SerialNo": "sn-fail", "ReportStatus": "FAIL", "Description": "MK:0001"})
+		}
+		return map[string]interface{}{"Response": map[string]interface{}{"PullSmsSendStatusSet": set}}
+	})
+	defer srv.Close()
+	s := newTestTencent(t, srv.URL, "SKEY")
+
+	q := DetailQuery{Phone: "13012345678", ReceiptId: "sn-ok", SendDate: time.Unix(1576137000, 0)}
+	r, err := s.GetDetail(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.SendStat != "DONE" || r.ReceiveDate.Unix() != 1576137600 || len(offsets) != 2 || offsets[1] != tencentPageSize {
+		t.Fatalf("%+v %v", r, offsets)
+	}
+
+	q.ReceiptId = "sn-fail"
+	if r, err = s.GetDetail(q); err != nil || r.SendStat != "FAIL" || r.ErrCode != "MK:0001" {
+		t.Fatalf("%+v %v", r, err)
+	}
+	q.ReceiptId = "sn-none"
+	if _, err = s.GetDetail(q); err != ErrorSMSNoReceipt {
+		t.Fatal("need no receipt error", err)
+	}
+}
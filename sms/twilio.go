@@ -0,0 +1,200 @@
+package sms
+
+/**
+implement: twilio messages api, https://www.twilio.com/docs/sms/api/message-resource
+*/
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const twilioEndpoint = "https://api.twilio.com"
+
+// TwilioSMS has no server side template, TemplateCode is the content with
+// "{name}" placeholders of TemplateParam.
+type TwilioSMS struct {
+	accountSid  string
+	authToken   string
+	from        string
+	serviceSid  string
+	countryCode string
+	endpoint    string
+	cli         *http.Client
+	templates   *TemplateRegistry
+}
+
+type twilioMessage struct {
+	Sid          string       `json:"sid"`
+	To           string       `json:"to"`
+	Body         string       `json:"body"`
+	Status       twilioStatus `json:"status"`
+	ErrorCode    *int         `json:"error_code"`
+	ErrorMessage string       `json:"error_message"`
+	DateCreated  string       `json:"date_created"`
+	DateSent     string       `json:"date_sent"`
+	DateUpdated  string       `json:"date_updated"`
+
+	//error response
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// InitSMS AccessKeyId: account sid, AccessSecret: auth token,
+// Options["from"]: sender number or alphanumeric id, Options["messaging_service_sid"]: used instead of from,
+// Options["country_code"]: for phones without country code
+func (s *TwilioSMS) InitSMS(cfg Config) (instance SMS, err error) {
+	if cfg.AccessKeyId == "" || cfg.AccessSecret == "" {
+		err = errors.New("lost account sid or auth token")
+		return
+	}
+	s.accountSid, s.authToken = cfg.AccessKeyId, cfg.AccessSecret
+	s.from, s.serviceSid = cfg.Options["from"], cfg.Options["messaging_service_sid"]
+	if s.from == "" && s.serviceSid == "" {
+		err = errors.New("lost from or messaging service sid")
+		return
+	}
+	s.countryCode = cfg.Options["country_code"]
+	if s.endpoint = strings.TrimRight(cfg.Endpoint, "/"); s.endpoint == "" {
+		s.endpoint = twilioEndpoint
+	}
+	s.cli = newHTTPClient(cfg.Timeout)
+	s.templates = cfg.Templates
+	instance = s
+	return
+}
+
+// SendSMS sends a message to each phone
+func (s *TwilioSMS) SendSMS(req SendRequest) (r Result, err error) {
+	if req, err = resolveRequest(s.templates, req, s.SupportBy(), true); err != nil {
+		return
+	}
+	phones := make([]string, len(req.Phones))
+	for i, p := range req.Phones {
+		if phones[i], err = NormalizeE164(p, s.countryCode); err != nil {
+			return
+		}
+	}
+	body := renderTemplate(req.TemplateCode, req.TemplateParam)
+	//phones sent before a failed one are kept in Details, or they would be sent again by MultiSMS
+	var requestErr error
+	for _, p := range phones {
+		pr := PhoneResult{Phone: p}
+		params := url.Values{"To": {p}, "Body": {body}}
+		if s.serviceSid != "" {
+			params.Set("MessagingServiceSid", s.serviceSid)
+		} else {
+			params.Set("From", s.from)
+		}
+		var m twilioMessage
+		if e := s.call(http.MethodPost, "/Messages.json", params, &m); e != nil {
+			if requestErr == nil {
+				requestErr = e
+			}
+			failPhone(&pr, e)
+		} else if m.Sid == "" {
+			pr.ErrCode, pr.Message = strconv.Itoa(m.Code), m.Message
+		} else {
+			pr.ReceiptId = m.Sid
+			if r.ReceiptId == "" {
+				r.ReceiptId = m.Sid
+			}
+		}
+		r.Details = append(r.Details, pr)
+	}
+	if r.ReceiptId == "" {
+		r.ErrCode = r.Details[0].ErrCode
+		if err = requestErr; err == nil {
+			err = fmt.Errorf("%s(%s)", r.Details[0].Message, r.ErrCode)
+		}
+	}
+	return
+}
+
+// GetDetail fetches message by sid, only ReceiptId is used
+func (s *TwilioSMS) GetDetail(q DetailQuery) (r Receipt, err error) {
+	if q.ReceiptId == "" {
+		err = errors.New("lost receipt id")
+		return
+	}
+	var m twilioMessage
+	if err = s.call(http.MethodGet, "/Messages/"+url.PathEscape(q.ReceiptId)+".json", nil, &m); err != nil {
+		return
+	}
+	if m.Sid == "" {
+		if m.Code == 20404 {
+			err = ErrorSMSNoReceipt
+		} else {
+			err = fmt.Errorf("%s(%d)", m.Message, m.Code)
+		}
+		return
+	}
+	r.Provider, r.ReceiptId, r.Phone, r.Content = s.SupportBy(), m.Sid, m.To, m.Body
+	if r.SendDate, err = parseTwilioDate(m.DateSent); err != nil {
+		return
+	}
+	switch m.Status {
+	case "delivered", "read":
+		r.ErrCode, r.SendStat = "DELIVERED", StatusDone
+		r.ReceiveDate, err = parseTwilioDate(m.DateUpdated)
+	case "failed", "undelivered":
+		r.SendStat = StatusFail
+		if m.ErrorCode != nil {
+			r.ErrCode = strconv.Itoa(*m.ErrorCode)
+		}
+		r.ErrCategory = ClassifyError(r.ErrCode)
+	default:
+		r.SendStat = StatusWait
+	}
+	return
+}
+
+func (s *TwilioSMS) SupportBy() string {
+	return "twilio"
+}
+
+func (s *TwilioSMS) call(method, path string, params url.Values, out interface{}) error {
+	var (
+		body        []byte
+		contentType string
+	)
+	if params != nil {
+		body, contentType = []byte(params.Encode()), "application/x-www-form-urlencoded"
+	}
+	header := http.Header{"Authorization": {"Basic " +
+		base64.StdEncoding.EncodeToString([]byte(s.accountSid+":"+s.authToken))}}
+	return doHTTP(s.cli, method, s.endpoint+"/2010-04-01/Accounts/"+s.accountSid+path,
+		contentType, body, header, out)
+}
+
+// twilioStatus is a string of message, or a number of error response
+type twilioStatus string
+
+func (s *twilioStatus) UnmarshalJSON(d []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(d, &v); err != nil {
+		return err
+	}
+	switch t := v.(type) {
+	case string:
+		*s = twilioStatus(t)
+	case float64:
+		*s = twilioStatus(strconv.FormatFloat(t, 'f', -1, 64))
+	}
+	return nil
+}
+
+// parseTwilioDate parses RFC 2822 date, empty date is zero time
+func parseTwilioDate(d string) (t time.Time, err error) {
+	if d == "" {
+		return
+	}
+	return time.Parse(time.RFC1123Z, d)
+}
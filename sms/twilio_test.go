@@ -0,0 +1,140 @@
+package sms
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTwilioSMS(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pwd, ok := r.BasicAuth(); !ok || user != "AC123" || pwd != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"code":20003,"message":"Authenticate","status":401}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/2010-04-01/Accounts/AC123/Messages.json":
+			r.ParseForm()
+			if r.PostForm.Get("From") != "+15005550006" || r.PostForm.Get("Body") != "your code is 1234" {
+				t.Errorf("params error: %v", r.PostForm)
+			}
+			if r.PostForm.Get("To") == "+15005550001" {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"code":21211,"message":"The 'To' number is not a valid phone number.","status":400}`))
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"sid":"SM` + r.PostForm.Get("To")[1:] + `","status":"queued","to":"` + r.PostForm.Get("To") + `",
+				"error_code":null,"date_created":"Thu, 30 Jul 2015 20:12:31 +0000"}`))
+		case "/2010-04-01/Accounts/AC123/Messages/SM14155550100.json":
+			w.Write([]byte(`{"sid":"SM14155550100","status":"delivered","error_code":null,
+				"date_sent":"Thu, 30 Jul 2015 20:12:33 +0000","date_updated":"Thu, 30 Jul 2015 20:12:40 +0000"}`))
+		case "/2010-04-01/Accounts/AC123/Messages/SM2.json":
+			w.Write([]byte(`{"sid":"SM2","status":"undelivered","error_code":30003,"date_sent":"Thu, 30 Jul 2015 20:12:33 +0000"}`))
+		case "/2010-04-01/Accounts/AC123/Messages/SM3.json":
+			w.Write([]byte(`{"sid":"SM3","status":"sent","error_code":null,"date_sent":"Thu, 30 Jul 2015 20:12:33 +0000"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"code":20404,"message":"not found","status":404}`))
+		}
+	}))
+	defer srv.Close()
+
+	s, err := Using("twilio", Config{AccessKeyId: "AC123", AccessSecret: "token", Endpoint: srv.URL,
+		Options: map[string]string{"from": "+15005550006", "country_code": "1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := SendRequest{
+		Phones:        []string{"(415) 555-0100", "+1 500 555 0001"},
+		TemplateCode:  "your code is {code}",
+		TemplateParam: map[string]string{"code": "1234"},
+	}
+	r, err := s.SendSMS(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.ReceiptId != "SM14155550100" || len(r.Details) != 2 || r.Details[1].ErrCode != "21211" {
+		t.Fatalf("%+v", r)
+	}
+
+	rc, err := s.GetDetail(DetailQuery{ReceiptId: "SM14155550100"})
+	if err != nil || rc.SendStat != "DONE" || rc.ReceiveDate.Unix()-rc.SendDate.Unix() != 7 {
+		t.Fatalf("%+v %v", rc, err)
+	}
+	if rc, err = s.GetDetail(DetailQuery{ReceiptId: "SM2"}); err != nil || rc.SendStat != "FAIL" || rc.ErrCode != "30003" {
+		t.Fatalf("%+v %v", rc, err)
+	}
+	if rc, err = s.GetDetail(DetailQuery{ReceiptId: "SM3"}); err != nil || rc.SendStat != "WAIT" {
+		t.Fatalf("%+v %v", rc, err)
+	}
+	if _, err = s.GetDetail(DetailQuery{ReceiptId: "SM4"}); err != ErrorSMSNoReceipt {
+		t.Fatal("need no receipt error", err)
+	}
+
+	req.Phones = []string{"5005550001"}
+	if r, err = s.SendSMS(req); err == nil || r.ErrCode != "21211" {
+		t.Fatalf("need error: %+v %v", r, err)
+	}
+	req.Phones = []string{"abc"}
+	if _, err = s.SendSMS(req); err == nil {
+		t.Fatal("need phone error")
+	}
+
+	s, _ = Using("twilio", Config{AccessKeyId: "AC123", AccessSecret: "wrong", Endpoint: srv.URL,
+		Options: map[string]string{"from": "+15005550006"}})
+	req.Phones = []string{"+14155550100"}
+	if r, err = s.SendSMS(req); err == nil || r.ErrCode != "20003" {
+		t.Fatalf("need auth error: %+v %v", r, err)
+	}
+	if _, err = Using("twilio", Config{AccessKeyId: "AC123", AccessSecret: "token"}); err == nil {
+		t.Fatal("need from error")
+	}
+}
+
+// dropConn closes the connection without response, like a network failure
+func dropConn(t *testing.T, w http.ResponseWriter) {
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+}
+
+// TestTwilioSMSPartial checks phones sent before a network failure are kept
+func TestTwilioSMSPartial(t *testing.T) {
+	down := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		to := r.PostForm.Get("To")
+		if down || to == "+14155550101" {
+			dropConn(t, w)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"sid":"SM` + to[1:] + `","status":"queued"}`))
+	}))
+	defer srv.Close()
+
+	s, err := Using("twilio", Config{AccessKeyId: "AC123", AccessSecret: "token", Endpoint: srv.URL,
+		Options: map[string]string{"from": "+15005550006"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := SendRequest{Phones: []string{"+14155550100", "+14155550101", "+14155550102"}, TemplateCode: "hi"}
+	r, err := s.SendSMS(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.ReceiptId != "SM14155550100" || len(r.Details) != 3 || r.Details[1].ErrCode != ErrCodeTransport || r.Details[2].ReceiptId != "SM14155550102" {
+		t.Fatalf("%+v", r)
+	}
+
+	down = true
+	if r, err = s.SendSMS(req); err == nil || len(r.Details) != 3 || r.ErrCode != ErrCodeTransport || !strings.Contains(r.Details[2].Message, "EOF") {
+		t.Fatalf("need network error: %+v %v", r, err)
+	}
+}